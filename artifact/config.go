@@ -0,0 +1,20 @@
+package artifact
+
+import (
+	"fmt"
+	"jinovatka/config"
+	"net/http"
+)
+
+// Storage described by the configuration. Returns nil Storage if the backend is not set.
+func NewStorage(config *config.ArtifactsConfig, client *http.Client) (Storage, error) {
+	switch config.Backend {
+	case "":
+		return nil, nil
+	case "filesystem":
+		return NewFilesystemStorage(config.Dir), nil
+	case "s3":
+		return NewS3Storage(client, config.S3.Endpoint, config.S3.Region, config.S3.Bucket, config.S3.Prefix, config.S3.AccessKey, config.S3.SecretKey)
+	}
+	return nil, fmt.Errorf("artifact.NewStorage recieved unknown backend %q", config.Backend)
+}
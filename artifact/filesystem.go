@@ -0,0 +1,192 @@
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"jinovatka/assert"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Prefix of files that are being written. They are skipped by List.
+const temporaryPrefix = ".tmp-"
+
+// Artifacts stored as files in directory. The key is the path of the file relative to Dir.
+type FilesystemStorage struct {
+	Dir string
+}
+
+// The directory is created on first Put.
+func NewFilesystemStorage(dir string) *FilesystemStorage {
+	assert.Must(dir != "", "NewFilesystemStorage: dir can't be empty")
+	return &FilesystemStorage{Dir: dir}
+}
+
+func (storage *FilesystemStorage) Put(ctx context.Context, key string, content io.Reader) (*Info, error) {
+	path, err := storage.path(key)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("FilesystemStorage.Put failed to create directory: %w", err)
+	}
+	// Write to temporary file first, so readers never see half written artifact.
+	temporary, err := os.CreateTemp(filepath.Dir(path), temporaryPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("FilesystemStorage.Put failed to create file: %w", err)
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(temporary, hasher), contextReader{ctx: ctx, Reader: content})
+	if err == nil {
+		err = temporary.Chmod(0o644)
+	}
+	err = errors.Join(err, temporary.Close())
+	if err == nil {
+		err = os.Rename(temporary.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(temporary.Name())
+		return nil, fmt.Errorf("FilesystemStorage.Put failed to write %s: %w", key, err)
+	}
+	info, err := storage.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	info.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return info, nil
+}
+
+func (storage *FilesystemStorage) Get(ctx context.Context, key string) (io.ReadSeekCloser, *Info, error) {
+	path, err := storage.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("FilesystemStorage.Get: %w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("FilesystemStorage.Get failed to open %s: %w", key, err)
+	}
+	fileInfo, err := file.Stat()
+	if err == nil && !fileInfo.Mode().IsRegular() {
+		err = fmt.Errorf("%w: %s is not regular file", ErrNotFound, key)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, fmt.Errorf("FilesystemStorage.Get failed to stat %s: %w", key, err)
+	}
+	return file, storage.info(key, path, fileInfo), nil
+}
+
+func (storage *FilesystemStorage) Stat(ctx context.Context, key string) (*Info, error) {
+	path, err := storage.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !fileInfo.Mode().IsRegular()) {
+		return nil, fmt.Errorf("FilesystemStorage.Stat: %w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("FilesystemStorage.Stat failed to stat %s: %w", key, err)
+	}
+	return storage.info(key, path, fileInfo), nil
+}
+
+func (storage *FilesystemStorage) Delete(ctx context.Context, key string) error {
+	path, err := storage.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("FilesystemStorage.Delete: %w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return fmt.Errorf("FilesystemStorage.Delete failed to remove %s: %w", key, err)
+	}
+	return nil
+}
+
+func (storage *FilesystemStorage) List(ctx context.Context, prefix string) ([]*Info, error) {
+	infos := make([]*Info, 0)
+	err := filepath.WalkDir(storage.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == storage.Dir {
+			return fs.SkipAll // Nothing was stored yet.
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), temporaryPrefix) {
+			return nil
+		}
+		relative, err := filepath.Rel(storage.Dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, storage.info(key, path, fileInfo))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("FilesystemStorage.List failed to walk directory: %w", err)
+	}
+	// WalkDir goes in lexical order of the names, that is not the order of the keys ("a/b" and "a.b").
+	slices.SortFunc(infos, func(a, b *Info) int { return strings.Compare(a.Key, b.Key) })
+	return infos, nil
+}
+
+// Path of the file with the key.
+func (storage *FilesystemStorage) path(key string) (string, error) {
+	err := ValidateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storage.Dir, filepath.FromSlash(key)), nil
+}
+
+func (storage *FilesystemStorage) info(key string, path string, fileInfo fs.FileInfo) *Info {
+	location := path
+	if absolute, err := filepath.Abs(path); err == nil {
+		location = (&url.URL{Scheme: "file", Path: filepath.ToSlash(absolute)}).String()
+	}
+	return &Info{
+		Key:      key,
+		Size:     fileInfo.Size(),
+		ModTime:  fileInfo.ModTime(),
+		Location: location,
+	}
+}
+
+// Stops long copies when the context is done.
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func (reader contextReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return reader.Reader.Read(p)
+}
@@ -0,0 +1,408 @@
+package artifact
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"jinovatka/assert"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata header with SHA-256 of the content, so Stat can return it without reading the object.
+const s3HashHeader = "X-Amz-Meta-Sha256"
+
+// SHA-256 of empty payload, used for requests without body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Artifacts stored in S3 compatible object storage (AWS S3, MinIO, Ceph...).
+// Only path-style addressing (https://endpoint/bucket/key) is used, all compatible storages support it.
+// Requests are signed by AWS Signature Version 4.
+type S3Storage struct {
+	Client *http.Client
+	// URL of the service, for example http://localhost:9000 for local MinIO.
+	Endpoint *url.URL
+	Region   string
+	Bucket   string
+	// Prepended to all keys. Optional, for example "captures/".
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+func NewS3Storage(client *http.Client, endpoint string, region string, bucket string, prefix string, accessKey string, secretKey string) (*S3Storage, error) {
+	assert.Must(client != nil, "NewS3Storage: client can't be nil")
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("NewS3Storage recieved invalid endpoint %q", endpoint)
+	}
+	if bucket == "" || strings.Contains(bucket, "/") {
+		return nil, fmt.Errorf("NewS3Storage recieved invalid bucket %q", bucket)
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Storage{
+		Client:    client,
+		Endpoint:  parsed,
+		Region:    region,
+		Bucket:    bucket,
+		Prefix:    prefix,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}, nil
+}
+
+func (storage *S3Storage) Put(ctx context.Context, key string, content io.Reader) (*Info, error) {
+	err := ValidateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	// S3 needs the length and the signature needs the hash before sending, so the content is spooled to disk.
+	spool, err := os.CreateTemp("", "jinovatka-artifact-*")
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage.Put failed to create temporary file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hasher), contextReader{ctx: ctx, Reader: content})
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage.Put failed to read content: %w", err)
+	}
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage.Put failed to rewind temporary file: %w", err)
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	request, err := storage.newRequest(ctx, http.MethodPut, storage.objectURL(key), io.NopCloser(spool), hash)
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = size
+	request.Header.Set(s3HashHeader, hash)
+	response, err := storage.do(request)
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage.Put failed to upload %s: %w", key, err)
+	}
+	_ = response.Body.Close()
+	return &Info{
+		Key:      key,
+		Size:     size,
+		SHA256:   hash,
+		ModTime:  parseHTTPTime(response.Header.Get("Last-Modified")),
+		Location: storage.location(key),
+	}, nil
+}
+
+func (storage *S3Storage) Get(ctx context.Context, key string) (io.ReadSeekCloser, *Info, error) {
+	info, err := storage.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &s3Object{ctx: ctx, storage: storage, key: key, size: info.Size}, info, nil
+}
+
+func (storage *S3Storage) Stat(ctx context.Context, key string) (*Info, error) {
+	err := ValidateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	request, err := storage.newRequest(ctx, http.MethodHead, storage.objectURL(key), nil, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	response, err := storage.do(request)
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage.Stat failed to stat %s: %w", key, err)
+	}
+	_ = response.Body.Close()
+	return &Info{
+		Key:      key,
+		Size:     response.ContentLength,
+		SHA256:   response.Header.Get(s3HashHeader),
+		ModTime:  parseHTTPTime(response.Header.Get("Last-Modified")),
+		Location: storage.location(key),
+	}, nil
+}
+
+func (storage *S3Storage) Delete(ctx context.Context, key string) error {
+	// S3 deletes missing objects without complaining, so check first.
+	_, err := storage.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	request, err := storage.newRequest(ctx, http.MethodDelete, storage.objectURL(key), nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	response, err := storage.do(request)
+	if err != nil {
+		return fmt.Errorf("S3Storage.Delete failed to delete %s: %w", key, err)
+	}
+	_ = response.Body.Close()
+	return nil
+}
+
+// Response of ListObjectsV2 https://docs.aws.amazon.com/AmazonS3/latest/API/API_ListObjectsV2.html
+type s3ListResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (storage *S3Storage) List(ctx context.Context, prefix string) ([]*Info, error) {
+	infos := make([]*Info, 0)
+	token := ""
+	for {
+		listURL := storage.bucketURL()
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", storage.Prefix+prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		listURL.RawQuery = query.Encode()
+		request, err := storage.newRequest(ctx, http.MethodGet, listURL, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		response, err := storage.do(request)
+		if err != nil {
+			return nil, fmt.Errorf("S3Storage.List failed to list objects: %w", err)
+		}
+		result := new(s3ListResult)
+		err = xml.NewDecoder(response.Body).Decode(result)
+		_ = response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("S3Storage.List failed to parse response: %w", err)
+		}
+		for _, object := range result.Contents {
+			key := strings.TrimPrefix(object.Key, storage.Prefix)
+			modTime, _ := time.Parse(time.RFC3339, object.LastModified)
+			infos = append(infos, &Info{
+				Key:      key,
+				Size:     object.Size,
+				ModTime:  modTime,
+				Location: storage.location(key),
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	slices.SortFunc(infos, func(a, b *Info) int { return strings.Compare(a.Key, b.Key) })
+	return infos, nil
+}
+
+func (storage *S3Storage) bucketURL() *url.URL {
+	return storage.Endpoint.JoinPath(storage.Bucket)
+}
+
+func (storage *S3Storage) objectURL(key string) *url.URL {
+	return storage.Endpoint.JoinPath(storage.Bucket, storage.Prefix+key)
+}
+
+func (storage *S3Storage) location(key string) string {
+	return "s3://" + storage.Bucket + "/" + storage.Prefix + key
+}
+
+// Create signed request. payloadHash is hex SHA-256 of the body.
+func (storage *S3Storage) newRequest(ctx context.Context, method string, target *url.URL, body io.ReadCloser, payloadHash string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("S3Storage.newRequest failed to create request: %w", err)
+	}
+	request.Body = body
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	return request, nil
+}
+
+// Sign and send the request. Responses other than 2xx are returned as errors, 404 as ErrNotFound.
+func (storage *S3Storage) do(request *http.Request) (*http.Response, error) {
+	signV4(request, storage.AccessKey, storage.SecretKey, storage.Region, "s3", time.Now())
+	response, err := storage.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	// The body has XML with error code and message, it is useful for debugging.
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return nil, fmt.Errorf("storage responded with %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
+
+// Object read by range requests, so seeking (replay of large WACZ) doesn't download the whole object.
+type s3Object struct {
+	ctx     context.Context
+	storage *S3Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (object *s3Object) Read(p []byte) (int, error) {
+	if object.offset >= object.size {
+		return 0, io.EOF
+	}
+	if object.body == nil {
+		request, err := object.storage.newRequest(object.ctx, http.MethodGet, object.storage.objectURL(object.key), nil, emptyPayloadHash)
+		if err != nil {
+			return 0, err
+		}
+		request.Header.Set("Range", "bytes="+strconv.FormatInt(object.offset, 10)+"-")
+		response, err := object.storage.do(request)
+		if err != nil {
+			return 0, fmt.Errorf("s3Object.Read failed to get %s: %w", object.key, err)
+		}
+		object.body = response.Body
+	}
+	n, err := object.body.Read(p)
+	object.offset += int64(n)
+	if errors.Is(err, io.EOF) && object.offset < object.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (object *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += object.offset
+	case io.SeekEnd:
+		offset += object.size
+	}
+	if offset < 0 {
+		return 0, errors.New("s3Object.Seek: negative position")
+	}
+	if offset != object.offset && object.body != nil {
+		_ = object.body.Close()
+		object.body = nil
+	}
+	object.offset = offset
+	return offset, nil
+}
+
+func (object *s3Object) Close() error {
+	if object.body == nil {
+		return nil
+	}
+	err := object.body.Close()
+	object.body = nil
+	return err
+}
+
+// Sign the request by AWS Signature Version 4 https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv.html
+// Signed are the Host, Range and all X-Amz-* headers. X-Amz-Content-Sha256 must already be set.
+func signV4(request *http.Request, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	canonicalHeaders := new(strings.Builder)
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		uriEncode(request.URL.EscapedPath(), false),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		request.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Query sorted by name with names and values encoded by the rules of the signature.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// Percent-encode everything except unreserved characters. The path is given escaped, so it is unescaped first.
+// Slashes are kept in paths and encoded in query values.
+func uriEncode(value string, encodeSlash bool) string {
+	if !encodeSlash {
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+	}
+	builder := new(strings.Builder)
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			builder.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(builder, "%%%02X", c)
+	}
+	return builder.String()
+}
+
+func parseHTTPTime(value string) time.Time {
+	parsed, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
@@ -0,0 +1,112 @@
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Package artifact stores files created by captures (WACZ, WARC) somewhere both workers and the server can reach them.
+// Artifacts are addressed by keys like "<SeedShadowID>/<timestamp>.wacz", the backend decides where the key really is.
+
+var (
+	ErrNotFound   = errors.New("artifact not found")
+	ErrInvalidKey = errors.New("invalid artifact key")
+)
+
+// Longest allowed key. S3 has the same limit.
+const MaxKeyLength = 1024
+
+// Information about stored artifact.
+type Info struct {
+	Key  string
+	Size int64
+	// Lowercase hex SHA-256 of the content. Empty if the backend can't tell it without reading the content, see Hash.
+	SHA256  string
+	ModTime time.Time
+	// Where the artifact is, for people and logs. For example file:///data/captures/x.wacz or s3://bucket/x.wacz.
+	Location string
+}
+
+// Storage of artifacts. Implementations must be safe for concurrent use.
+type Storage interface {
+	// Store the content under the key. Existing artifact is replaced. The returned Info always has SHA256.
+	Put(ctx context.Context, key string, content io.Reader) (*Info, error)
+	// Open the artifact for reading. The caller must close it. Returns ErrNotFound if there is no such artifact.
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, *Info, error)
+	// Information about the artifact. Returns ErrNotFound if there is no such artifact.
+	Stat(ctx context.Context, key string) (*Info, error)
+	// Remove the artifact. Returns ErrNotFound if there is no such artifact.
+	Delete(ctx context.Context, key string) error
+	// All artifacts with key starting with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]*Info, error)
+}
+
+// Check that the key is relative slash separated path without empty, "." and ".." parts.
+func ValidateKey(key string) error {
+	if key == "" || len(key) > MaxKeyLength || strings.ContainsAny(key, "\\\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for part := range strings.SplitSeq(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+// SHA-256 of the artifact. Uses the stored hash if the backend has it, reads the whole artifact otherwise.
+func Hash(ctx context.Context, storage Storage, key string) (string, error) {
+	info, err := storage.Stat(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if info.SHA256 != "" {
+		return info.SHA256, nil
+	}
+	return Rehash(ctx, storage, key)
+}
+
+// SHA-256 of the artifact computed from its content, never from the stored hash. Used to detect corrupted artifacts.
+func Rehash(ctx context.Context, storage Storage, key string) (string, error) {
+	content, _, err := storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, contextReader{ctx: ctx, Reader: content})
+	if err != nil {
+		return "", fmt.Errorf("artifact.Rehash failed to read %s: %w", key, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Random access to the content. Files already have it, other contents are read by seeking.
+func ReaderAt(content io.ReadSeeker) io.ReaderAt {
+	if readerAt, ok := content.(io.ReaderAt); ok {
+		return readerAt
+	}
+	return &seekingReaderAt{content: content}
+}
+
+type seekingReaderAt struct {
+	mutex   sync.Mutex
+	content io.ReadSeeker
+}
+
+func (reader *seekingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	_, err := reader.content.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(reader.content, p)
+}
@@ -0,0 +1,255 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"jinovatka/artifact"
+	"jinovatka/assert"
+	"jinovatka/cdxj"
+	"jinovatka/entities"
+	"jinovatka/wacz"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Package capture implements lightweight capture of web pages without browser.
+// It downloads the page and its direct requisites (images, stylesheets, scripts...) and stores them as WACZ.
+// It is the worker side of the queue, see Capturer.Capture.
+
+const Software = "Jinovatka go-worker"
+
+// Capturer captures the requested pages and stores them as <SeedShadowID>/<timestamp>.wacz artifacts into Storage.
+type Capturer struct {
+	Log *slog.Logger
+	// Client used for all downloads. Redirects are handled by Capturer, so CheckRedirect of the client is overridden.
+	Client *http.Client
+	// Where the WACZ files are stored. Shared with the server.
+	Storage artifact.Storage
+
+	// Maximum size of one downloaded resource. Larger resources are truncated.
+	MaxResourceSize int64
+	// Maximum number of requisites downloaded for one page.
+	MaxRequisites int
+	// Maximum number of redirects followed for one resource.
+	MaxRedirects int
+	// Maximum duration of whole capture.
+	Timeout time.Duration
+	// User-Agent header sent with requests.
+	UserAgent string
+	// Identifier of the worker reported in results. Optional.
+	WorkerID string
+
+	// Optional check of every URL before it is downloaded. If it returns error, the URL is not downloaded.
+	CheckURL func(ctx context.Context, u *url.URL) error
+}
+
+func NewCapturer(log *slog.Logger, client *http.Client, storage artifact.Storage) *Capturer {
+	assert.Must(log != nil, "NewCapturer: log can't be nil")
+	assert.Must(client != nil, "NewCapturer: client can't be nil")
+	assert.Must(storage != nil, "NewCapturer: storage can't be nil")
+	// Copy the client, so we don't change the callers client.
+	clientCopy := *client
+	clientCopy.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Capturer{
+		Log:             log,
+		Client:          &clientCopy,
+		Storage:         storage,
+		MaxResourceSize: 50 << 20,
+		MaxRequisites:   200,
+		MaxRedirects:    10,
+		Timeout:         5 * time.Minute,
+		UserAgent:       "Mozilla/5.0 (compatible; " + Software + ")",
+	}
+}
+
+// Capture the requested page. Never returns nil. Errors are reported in the result.
+// The signature matches memoryq.CaptureFunc, so Capturer can be used as in-process worker.
+func (capturer *Capturer) Capture(ctx context.Context, request *entities.CaptureRequest) *entities.CaptureResult {
+	// The result is done even if the capture fails. The failure is described by ErrorMessages.
+	result := &entities.CaptureResult{
+		SeedShadowID:  request.SeedShadowID,
+		Done:          true,
+		ErrorMessages: []string{},
+		WorkerID:      capturer.WorkerID,
+	}
+
+	if capturer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, capturer.Timeout)
+		defer cancel()
+	}
+
+	writer := wacz.NewWriter(request.SeedURL, Software, time.Now())
+	page, redirects, err := capturer.fetchWithRedirects(ctx, writer, request.SeedURL)
+	if err != nil {
+		result.ErrorMessages = append(result.ErrorMessages, "Capture error: "+err.Error())
+		result.ErrorCategory = errorCategory(err)
+		return result
+	}
+	result.PageMetadata = &entities.PageMetadata{}
+	if page.Response.StatusCode >= 400 {
+		result.ErrorMessages = append(result.ErrorMessages, "Capture error: server responded with HTTP status "+page.Response.Status)
+		result.ErrorCategory = entities.HTTPClientError
+		if page.Response.StatusCode >= 500 {
+			result.ErrorCategory = entities.HTTPServerError
+		}
+		result.PageMetadata.StatusCode = page.Response.StatusCode
+		result.PageMetadata.RedirectChain = redirects
+		return result
+	}
+
+	if isHTML(page.Response) {
+		baseURL, _ := url.Parse(page.URL) // Already parsed during fetch.
+		metadata, requisites := parsePage(baseURL, page.Body)
+		result.PageMetadata = metadata
+		writer.MainPageTitle = metadata.Title
+		capturer.fetchRequisites(ctx, writer, requisites)
+	}
+	result.PageMetadata.StatusCode = page.Response.StatusCode
+	result.PageMetadata.RedirectChain = redirects
+
+	// Every capture has its own file, older captures of the seed must stay as they were.
+	timestamp := cdxj.FormatTimestamp(writer.MainPageTimestamp())
+	key := request.SeedShadowID + "/" + timestamp + ".wacz"
+	info, err := capturer.store(ctx, key, writer)
+	if err != nil {
+		result.ErrorMessages = append(result.ErrorMessages, fmt.Sprintf("failed to store %s, got error: %s", key, err.Error()))
+		result.ErrorCategory = entities.WriteError
+		return result
+	}
+	result.WaczKey = info.Key
+	result.WaczLocation = info.Location
+	result.WaczSize = info.Size
+	result.WaczSHA256 = info.SHA256
+
+	result.CaptureMetadata = &entities.CaptureMetadata{
+		Timestamp:   timestamp,
+		CapturedUrl: request.SeedURL,
+	}
+	return result
+}
+
+// Download requisites one after another. Failures are only logged, the page is still usable without them.
+func (capturer *Capturer) fetchRequisites(ctx context.Context, writer *wacz.Writer, requisites []string) {
+	if len(requisites) > capturer.MaxRequisites {
+		capturer.Log.Warn("Capturer skipped requisites over limit", "count", len(requisites), "limit", capturer.MaxRequisites)
+		requisites = requisites[:capturer.MaxRequisites]
+	}
+	for _, requisite := range requisites {
+		if ctx.Err() != nil {
+			return
+		}
+		_, _, err := capturer.fetchWithRedirects(ctx, writer, requisite)
+		if err != nil {
+			capturer.Log.Info("Capturer failed to fetch requisite", "url", requisite, "error", err.Error())
+		}
+	}
+}
+
+// Download the URL and all its redirects. Every response is added to the writer.
+// Returns the final exchange and the URLs that redirected to it.
+func (capturer *Capturer) fetchWithRedirects(ctx context.Context, writer *wacz.Writer, rawURL string) (*wacz.Exchange, []string, error) {
+	redirects := make([]string, 0)
+	for range capturer.MaxRedirects + 1 {
+		exchange, err := capturer.fetch(ctx, rawURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = writer.AddExchange(exchange)
+		if err != nil {
+			return nil, nil, err
+		}
+		location, err := exchange.Response.Location()
+		if !isRedirect(exchange.Response.StatusCode) || err != nil {
+			return exchange, redirects, nil
+		}
+		redirects = append(redirects, rawURL)
+		rawURL = location.String()
+	}
+	return nil, nil, fmt.Errorf("too many redirects when fetching %s", rawURL)
+}
+
+func (capturer *Capturer) fetch(ctx context.Context, rawURL string) (*wacz.Exchange, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", target.Scheme)
+	}
+	if capturer.CheckURL != nil {
+		err = capturer.CheckURL(ctx, target)
+		if err != nil {
+			return nil, fmt.Errorf("URL %s was refused: %w", rawURL, err)
+		}
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", capturer.UserAgent)
+	request.Header.Set("Accept", "*/*")
+
+	date := time.Now()
+	response, err := capturer.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, capturer.MaxResourceSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body of %s: %w", rawURL, err)
+	}
+	return &wacz.Exchange{
+		URL:      rawURL,
+		Date:     date,
+		Request:  request,
+		Response: response,
+		Body:     body,
+	}, nil
+}
+
+// Write WACZ into temporary file and rename it, so partially written files are never visible.
+func (capturer *Capturer) store(ctx context.Context, key string, writer *wacz.Writer) (*artifact.Info, error) {
+	buffer := new(bytes.Buffer)
+	_, err := writer.WriteTo(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return capturer.Storage.Put(ctx, key, buffer)
+}
+
+// Category of download error. Unknown errors are left for the server to classify.
+func errorCategory(err error) entities.CaptureErrorCategory {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return entities.DNSError
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return entities.TimeoutError
+	}
+	return entities.NoCaptureError
+}
+
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+func isHTML(response *http.Response) bool {
+	contentType := strings.ToLower(response.Header.Get("Content-Type"))
+	return strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "application/xhtml+xml")
+}
@@ -0,0 +1,96 @@
+package capture
+
+import (
+	"bytes"
+	"jinovatka/entities"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Parse HTML page and return its metadata and absolute URLs of its direct requisites.
+// Requisites are resources needed to display the page: images, stylesheets, scripts, icons, media and frames.
+// Links to other pages are not requisites.
+func parsePage(pageURL *url.URL, body []byte) (*entities.PageMetadata, []string) {
+	document, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		// The parser is very forgiving, this should not happen.
+		return new(entities.PageMetadata), nil
+	}
+
+	base := pageURL
+	seen := make(map[string]bool)
+	requisites := make([]string, 0)
+	add := func(reference string) {
+		reference = strings.TrimSpace(reference)
+		if reference == "" || strings.HasPrefix(reference, "data:") || strings.HasPrefix(reference, "#") {
+			return
+		}
+		resolved, err := base.Parse(reference)
+		if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+			return
+		}
+		resolved.Fragment = ""
+		absolute := resolved.String()
+		if !seen[absolute] && absolute != pageURL.String() {
+			seen[absolute] = true
+			requisites = append(requisites, absolute)
+		}
+	}
+
+	for node := range document.Descendants() {
+		if node.Type != html.ElementNode {
+			continue
+		}
+		switch node.Data {
+		case "base":
+			if href := attribute(node, "href"); href != "" {
+				if parsed, err := pageURL.Parse(href); err == nil {
+					base = parsed
+				}
+			}
+		case "img", "script", "iframe", "embed", "input", "track":
+			add(attribute(node, "src"))
+			addSrcset(attribute(node, "srcset"), add)
+		case "source":
+			add(attribute(node, "src"))
+			addSrcset(attribute(node, "srcset"), add)
+		case "audio":
+			add(attribute(node, "src"))
+		case "video":
+			add(attribute(node, "src"))
+			add(attribute(node, "poster"))
+		case "object":
+			add(attribute(node, "data"))
+		case "link":
+			rel := strings.ToLower(attribute(node, "rel"))
+			for _, value := range strings.Fields(rel) {
+				switch value {
+				case "stylesheet", "icon", "apple-touch-icon", "preload", "modulepreload", "manifest":
+					add(attribute(node, "href"))
+				}
+			}
+		}
+	}
+	return extractMetadata(document, pageURL), requisites
+}
+
+// Srcset is comma separated list of URLs followed by optional size descriptor.
+func addSrcset(srcset string, add func(string)) {
+	for candidate := range strings.SplitSeq(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			add(fields[0])
+		}
+	}
+}
+
+func attribute(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package capture
+
+import (
+	"encoding/json"
+	"jinovatka/entities"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Maximum number of authors taken from one page. Some pages list every contributor.
+const maxAuthors = 20
+
+// Meta tag names (name, property or itemprop attribute, lowercase) for each metadata field.
+var (
+	authorMetaNames    = []string{"author", "dc.creator", "dcterms.creator", "article:author", "citation_author", "book:author"}
+	publishedMetaNames = []string{"article:published_time", "datepublished", "dc.date", "dc.date.issued", "dcterms.issued", "dcterms.created", "dcterms.date", "citation_publication_date", "date"}
+	modifiedMetaNames  = []string{"article:modified_time", "og:updated_time", "datemodified", "dc.date.modified", "dcterms.modified"}
+	titleMetaNames     = []string{"og:title", "dc.title", "dcterms.title", "twitter:title"}
+	languageMetaNames  = []string{"dc.language", "dcterms.language", "og:locale"}
+)
+
+// Extract bibliographic metadata from the parsed HTML document.
+// Values from explicit meta tags have priority over schema.org JSON-LD.
+func extractMetadata(document *html.Node, pageURL *url.URL) *entities.PageMetadata {
+	metadata := new(entities.PageMetadata)
+	meta := make(map[string][]string)
+	canonical := ""
+	jsonLD := make([]any, 0)
+
+	for node := range document.Descendants() {
+		if node.Type != html.ElementNode {
+			continue
+		}
+		switch node.Data {
+		case "html":
+			metadata.Language = strings.TrimSpace(attribute(node, "lang"))
+		case "title":
+			if metadata.Title == "" && node.FirstChild != nil && node.FirstChild.Type == html.TextNode {
+				metadata.Title = normalizeSpace(node.FirstChild.Data)
+			}
+		case "meta", "time":
+			content := attribute(node, "content")
+			if node.Data == "time" || content == "" {
+				content = attribute(node, "datetime")
+			}
+			if content = normalizeSpace(content); content == "" {
+				continue
+			}
+			for _, key := range []string{"name", "property", "itemprop", "http-equiv"} {
+				if name := strings.ToLower(attribute(node, key)); name != "" {
+					meta[name] = append(meta[name], content)
+				}
+			}
+		case "link":
+			if canonical == "" && slices.Contains(strings.Fields(strings.ToLower(attribute(node, "rel"))), "canonical") {
+				canonical = attribute(node, "href")
+			}
+		case "script":
+			if strings.EqualFold(strings.TrimSpace(attribute(node, "type")), "application/ld+json") && node.FirstChild != nil {
+				var value any
+				if json.Unmarshal([]byte(node.FirstChild.Data), &value) == nil {
+					jsonLD = append(jsonLD, value)
+				}
+			}
+		}
+	}
+
+	schema := new(schemaMetadata)
+	for _, value := range jsonLD {
+		schema.visit(value, 0)
+	}
+
+	if metadata.Title == "" {
+		metadata.Title = firstMeta(meta, titleMetaNames)
+	}
+	if metadata.Title == "" {
+		metadata.Title = schema.headline
+	}
+	for _, name := range authorMetaNames {
+		for _, author := range meta[name] {
+			// article:author is often link to the profile of the author, that is not a name.
+			if !strings.HasPrefix(author, "http://") && !strings.HasPrefix(author, "https://") {
+				metadata.Authors = appendAuthor(metadata.Authors, author)
+			}
+		}
+	}
+	if len(metadata.Authors) == 0 {
+		for _, author := range schema.authors {
+			metadata.Authors = appendAuthor(metadata.Authors, author)
+		}
+	}
+	metadata.SiteName = firstNonEmpty(firstMeta(meta, []string{"og:site_name", "application-name"}), schema.publisher)
+	metadata.PublishedAt = firstNonEmpty(firstMeta(meta, publishedMetaNames), schema.published)
+	metadata.ModifiedAt = firstNonEmpty(firstMeta(meta, modifiedMetaNames), schema.modified)
+	if metadata.Language == "" {
+		metadata.Language = firstNonEmpty(firstMeta(meta, []string{"content-language"}), firstMeta(meta, languageMetaNames), schema.language)
+	}
+	if canonical == "" {
+		canonical = firstMeta(meta, []string{"og:url"})
+	}
+	if canonical != "" {
+		if resolved, err := pageURL.Parse(strings.TrimSpace(canonical)); err == nil && (resolved.Scheme == "http" || resolved.Scheme == "https") {
+			metadata.CanonicalURL = resolved.String()
+		}
+	}
+	return metadata
+}
+
+// Values found in schema.org JSON-LD. The first found value of each field is used.
+type schemaMetadata struct {
+	headline  string
+	authors   []string
+	publisher string
+	published string
+	modified  string
+	language  string
+}
+
+// Walk the JSON-LD value. The depth is limited, the JSON comes from unknown pages.
+func (schema *schemaMetadata) visit(value any, depth int) {
+	if depth > 8 {
+		return
+	}
+	switch typed := value.(type) {
+	case []any:
+		for _, item := range typed {
+			schema.visit(item, depth+1)
+		}
+	case map[string]any:
+		// Name is not used, it is also the name of people, organizations and whole web sites.
+		if schema.headline == "" {
+			schema.headline = schemaText(typed["headline"])
+		}
+		if len(schema.authors) == 0 {
+			schema.authors = schemaNames(typed["author"])
+		}
+		if schema.publisher == "" {
+			schema.publisher = firstOrEmpty(schemaNames(typed["publisher"]))
+		}
+		if schema.published == "" {
+			schema.published = schemaText(typed["datePublished"])
+		}
+		if schema.modified == "" {
+			schema.modified = schemaText(typed["dateModified"])
+		}
+		if schema.language == "" {
+			schema.language = schemaText(typed["inLanguage"])
+		}
+		if graph, ok := typed["@graph"]; ok {
+			schema.visit(graph, depth+1)
+		}
+	}
+}
+
+func schemaText(value any) string {
+	text, _ := value.(string)
+	return normalizeSpace(text)
+}
+
+// Names from schema.org Person or Organization, list of them or plain strings.
+func schemaNames(value any) []string {
+	switch typed := value.(type) {
+	case string:
+		if name := normalizeSpace(typed); name != "" {
+			return []string{name}
+		}
+	case map[string]any:
+		if name := schemaText(typed["name"]); name != "" {
+			return []string{name}
+		}
+	case []any:
+		names := make([]string, 0, len(typed))
+		for _, item := range typed {
+			names = append(names, schemaNames(item)...)
+		}
+		return names
+	}
+	return nil
+}
+
+func firstMeta(meta map[string][]string, names []string) string {
+	for _, name := range names {
+		if values := meta[name]; len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func firstOrEmpty(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func appendAuthor(authors []string, author string) []string {
+	if author == "" || len(authors) >= maxAuthors || slices.Contains(authors, author) {
+		return authors
+	}
+	return append(authors, author)
+}
+
+func normalizeSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
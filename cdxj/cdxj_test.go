@@ -0,0 +1,119 @@
+package cdxj
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzParseTimestamp(f *testing.F) {
+	for _, seed := range []string{
+		"2024", "202405", "20240517", "2024051712", "202405171230", "20240517123045",
+		"202405171230451", "2024051712304512", "20240517123045123",
+		"", "202", "20245", "202413", "20240230", "20240517243045", "2024051712304a", "202405171230451234",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, timestamp string) {
+		parsed, err := ParseTimestamp(timestamp)
+		if err != nil {
+			return
+		}
+		if parsed.Location() != time.UTC {
+			t.Fatalf("ParseTimestamp(%q) returned time in %s, expected UTC", timestamp, parsed.Location())
+		}
+		// Formatting the parsed time must give the same timestamp at the precision it was written with.
+		formatted := FormatTimestamp(parsed)
+		precision := Precision(timestamp)
+		if formatted[:precision] != timestamp[:precision] {
+			t.Fatalf("FormatTimestamp(ParseTimestamp(%q)) = %q, expected the same first %d digits", timestamp, formatted, precision)
+		}
+		if fraction := timestamp[precision:]; fraction != "" {
+			nanoseconds := fmt.Sprintf("%09d", parsed.Nanosecond())
+			if nanoseconds[:len(fraction)] != fraction || strings.Trim(nanoseconds[len(fraction):], "0") != "" {
+				t.Fatalf("ParseTimestamp(%q) has %d nanoseconds, expected fraction %q", timestamp, parsed.Nanosecond(), fraction)
+			}
+		}
+		// Fuzzed timestamps don't need to be padded, so they are compared by time. Whole timestamps are read back as they are.
+		again, err := ParseTimestamp(formatted)
+		if err != nil {
+			t.Fatalf("ParseTimestamp(%q) failed on formatted timestamp: %v", formatted, err)
+		}
+		if !again.Equal(parsed.Truncate(time.Second)) {
+			t.Fatalf("ParseTimestamp(%q) = %s, expected %s", formatted, again, parsed.Truncate(time.Second))
+		}
+	})
+}
+
+func FuzzParseLine(f *testing.F) {
+	for _, seed := range []string{
+		`com,example)/ 20240517123045 {"url":"https://example.com/","status":"200"}`,
+		"com,example)/ 20240517123045123 {\"url\":\"https://example.com/\"}\r\n",
+		`com,example)/ 2024 {}`,
+		`com,example)/ 20240517123045 []`,
+		`com,example)/ 20240517123045`,
+		` 20240517123045 {}`,
+		`com,example)/ 2024051712304 {}`,
+		"com,example)/ 20240517123045 {\"a\":\n\"b\"}",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		record, err := ParseRecord(line)
+		if err != nil {
+			return
+		}
+		if record.Key == "" || strings.Contains(record.Key, " ") {
+			t.Fatalf("ParseRecord(%q) returned key %q", line, record.Key)
+		}
+		if strings.ContainsAny(record.String(), "\r\n") {
+			t.Fatalf("ParseRecord(%q) returned record with line break %q", line, record.String())
+		}
+		var block map[string]any
+		err = record.Decode(&block)
+		if err != nil {
+			t.Fatalf("ParseRecord(%q) accepted block that can't be decoded: %v", line, err)
+		}
+		again, err := ParseRecord(record.String())
+		if err != nil {
+			t.Fatalf("ParseRecord(%q) failed on its own output: %v", record.String(), err)
+		}
+		if again.String() != record.String() || !again.Time.Equal(record.Time) {
+			t.Fatalf("ParseRecord(%q) = %q, expected %q", record.String(), again.String(), record.String())
+		}
+		if !record.SameSecond(record.Timestamp) {
+			t.Fatalf("record %q is not in the same second as its own timestamp", record.String())
+		}
+	})
+}
+
+func FuzzSURT(f *testing.F) {
+	for _, seed := range []string{
+		"https://www.example.com/a?b",
+		"http://Example.COM:80/Path/",
+		"https://example.com:8443",
+		"http://[::1]:8080/x y",
+		"http://127.0.0.1/\t\n",
+		"not a url",
+		"://",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, rawURL string) {
+		key := SURT(rawURL)
+		if strings.ContainsAny(key, " \t\n\r\v\f") {
+			t.Fatalf("SURT(%q) = %q contains whitespace", rawURL, key)
+		}
+		// The key must fit into CDXJ line.
+		record, err := ParseRecord(key + " 20240517123045 {}")
+		if key != "" && err != nil {
+			t.Fatalf("SURT(%q) = %q can't be used in CDXJ line: %v", rawURL, key, err)
+		}
+		if err == nil && record.Key != key {
+			t.Fatalf("SURT(%q) = %q was read back as %q", rawURL, key, record.Key)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package cdxj
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecord = errors.New("invalid CDXJ record")
+
+// Single line of CDXJ index "<key> <timestamp> <json block>".
+type Record struct {
+	// Searchable key, usually SURT of the URL.
+	Key string
+	// Timestamp as written in the line, 4 to 17 digits.
+	Timestamp string
+	// Parsed Timestamp.
+	Time time.Time
+	// JSON object with the details of the record (url, mime, status, digest...).
+	Block json.RawMessage
+}
+
+// Create record of the URL captured at the time. The block is marshalled to JSON and must be an object.
+func NewRecord(rawURL string, capturedAt time.Time, block any) (*Record, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("cdxj.NewRecord: %w: URL can't be empty", ErrInvalidRecord)
+	}
+	data, err := json.Marshal(block)
+	if err != nil {
+		return nil, fmt.Errorf("cdxj.NewRecord failed to marshal block: %w", err)
+	}
+	if !isObject(data) {
+		return nil, fmt.Errorf("cdxj.NewRecord: %w: block must be JSON object", ErrInvalidRecord)
+	}
+	timestamp := FormatTimestamp(capturedAt)
+	parsed, err := ParseTimestamp(timestamp)
+	if err != nil {
+		// Years before 0 or after 9999.
+		return nil, fmt.Errorf("cdxj.NewRecord: %w: %w", ErrInvalidRecord, err)
+	}
+	return &Record{Key: SURT(rawURL), Timestamp: timestamp, Time: parsed, Block: data}, nil
+}
+
+// Parse single line. Trailing line break is ignored.
+func ParseRecord(line string) (*Record, error) {
+	line = strings.TrimRight(line, "\r\n")
+	key, rest, ok := strings.Cut(line, " ")
+	if !ok || key == "" {
+		return nil, fmt.Errorf("cdxj.ParseRecord: %w: line has no timestamp", ErrInvalidRecord)
+	}
+	timestamp, block, ok := strings.Cut(rest, " ")
+	if !ok {
+		return nil, fmt.Errorf("cdxj.ParseRecord: %w: line has no JSON block", ErrInvalidRecord)
+	}
+	parsed, err := ParseTimestamp(timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("cdxj.ParseRecord: %w: %w", ErrInvalidRecord, err)
+	}
+	data := []byte(block)
+	if !isObject(data) {
+		return nil, fmt.Errorf("cdxj.ParseRecord: %w: block is not JSON object", ErrInvalidRecord)
+	}
+	return &Record{Key: key, Timestamp: timestamp, Time: parsed, Block: data}, nil
+}
+
+// Unmarshal the JSON block into v.
+func (record *Record) Decode(v any) error {
+	err := json.Unmarshal(record.Block, v)
+	if err != nil {
+		return fmt.Errorf("Record.Decode failed to unmarshal block: %w", err)
+	}
+	return nil
+}
+
+// The line without line break.
+func (record *Record) String() string {
+	return record.Key + " " + record.Timestamp + " " + string(record.Block)
+}
+
+// The record was captured in the same second as the timestamp. Timestamps shorter than seconds must be equal.
+// Workers report timestamps with milliseconds, indexes have seconds, so this is how they are matched.
+func (record *Record) SameSecond(timestamp string) bool {
+	if Precision(record.Timestamp) < len(TimestampFormat) || Precision(timestamp) < len(TimestampFormat) {
+		return record.Timestamp == timestamp
+	}
+	other, err := ParseTimestamp(timestamp)
+	if err != nil {
+		return false
+	}
+	return record.Time.Truncate(time.Second).Equal(other.Truncate(time.Second))
+}
+
+func isObject(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed) && !bytes.ContainsAny(data, "\r\n")
+}
@@ -0,0 +1,57 @@
+package cdxj
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Sort-friendly URI Reordering Transform of the URL. Used as the key of CDXJ lines.
+// For example "https://www.example.com/a?b" becomes "com,example)/a?b".
+// The result never contains whitespace, so it can't break the line it is in.
+func SURT(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return escapeWhitespace(strings.ToLower(rawURL))
+	}
+	host := strings.ToLower(parsed.Hostname())
+	key := host
+	// IP addresses are kept as they are.
+	if _, err := netip.ParseAddr(host); err != nil {
+		parts := strings.Split(strings.TrimPrefix(host, "www."), ".")
+		slices.Reverse(parts)
+		key = strings.Join(parts, ",")
+	}
+	port := parsed.Port()
+	if port != "" && !(parsed.Scheme == "http" && port == "80") && !(parsed.Scheme == "https" && port == "443") {
+		key += ":" + port
+	}
+	path := parsed.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key += ")" + strings.ToLower(path)
+	if parsed.RawQuery != "" {
+		key += "?" + strings.ToLower(parsed.RawQuery)
+	}
+	return escapeWhitespace(key)
+}
+
+// Percent-encode ASCII whitespace, the rest of the key is already escaped by url.URL or left as it was.
+func escapeWhitespace(key string) string {
+	if !strings.ContainsAny(key, " \t\n\r\v\f") {
+		return key
+	}
+	var escaped strings.Builder
+	for _, r := range key {
+		switch r {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			fmt.Fprintf(&escaped, "%%%02X", r)
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
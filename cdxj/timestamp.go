@@ -0,0 +1,62 @@
+package cdxj
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Package cdxj reads and writes lines of CDXJ indexes https://specs.webrecorder.net/cdxj/0.1.0/
+// shared by the WACZ writer, the WACZ validation and the capture metadata sent by workers.
+
+var ErrInvalidTimestamp = errors.New("invalid CDXJ timestamp")
+
+// Format of timestamps with second precision. Time is always in UTC.
+const TimestampFormat = "20060102150405"
+
+// Shortest (year) and longest (milliseconds) timestamp.
+const (
+	MinTimestampLength = 4
+	MaxTimestampLength = 17
+)
+
+// Missing parts of shorter timestamps. "2024" is the start of the year, "202405" the start of May and so on.
+const timestampPadding = "00000101000000"
+
+// Parse timestamp of any precision from year (4 digits) to milliseconds (17 digits).
+// Up to seconds the timestamp must have whole parts (4, 6, 8, 10, 12 or 14 digits), digits after that are fractions of second.
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	length := len(timestamp)
+	if length < MinTimestampLength || length > MaxTimestampLength {
+		return time.Time{}, fmt.Errorf("%w: %q has %d digits, expected %d to %d", ErrInvalidTimestamp, timestamp, length, MinTimestampLength, MaxTimestampLength)
+	}
+	if length < len(TimestampFormat) && length%2 != 0 {
+		return time.Time{}, fmt.Errorf("%w: %q has part of date or time cut off", ErrInvalidTimestamp, timestamp)
+	}
+	if strings.Trim(timestamp, "0123456789") != "" {
+		return time.Time{}, fmt.Errorf("%w: %q has other characters than digits", ErrInvalidTimestamp, timestamp)
+	}
+	full := timestamp
+	if length < len(TimestampFormat) {
+		full += timestampPadding[length:]
+	} else if length > len(TimestampFormat) {
+		// time.Parse accepts fractional second after the seconds even if the format doesn't have it.
+		full = timestamp[:len(TimestampFormat)] + "." + timestamp[len(TimestampFormat):]
+	}
+	parsed, err := time.Parse(TimestampFormat, full)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q: %w", ErrInvalidTimestamp, timestamp, err)
+	}
+	return parsed, nil
+}
+
+// Timestamp with second precision.
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampFormat)
+}
+
+// Number of digits of the timestamp that are date and time up to seconds. Used to compare timestamps of different precision.
+func Precision(timestamp string) int {
+	return min(len(timestamp), len(TimestampFormat))
+}
@@ -0,0 +1,401 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// Time zones of schedules must work in containers without system tzdata.
+	_ "time/tzdata"
+)
+
+// Package config holds all settings of the server. The settings are loaded from JSON file,
+// then overridden from enviroment (see env.go) and validated before anything else is started.
+
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	DB        DBConfig        `json:"db"`
+	Queue     QueueConfig     `json:"queue"`
+	Valkey    ValkeyConfig    `json:"valkey"`
+	Archive   ArchiveConfig   `json:"archive"`
+	Memento   MementoConfig   `json:"memento"`
+	Replay    ReplayConfig    `json:"replay"`
+	Artifacts ArtifactsConfig `json:"artifacts"`
+	Input     InputConfig     `json:"input"`
+	Capture   CaptureConfig   `json:"capture"`
+}
+
+type ServerConfig struct {
+	// Address the server listens on.
+	Address string `json:"address"`
+	// URL under which the server is reachable by users, used to create absolute links (exports, API).
+	// If empty, the Host header of the request is used. That is fine for development, but don't rely on it in production.
+	PublicBaseURL string `json:"publicBaseURL"`
+
+	ReadTimeout     Duration `json:"readTimeout"`
+	WriteTimeout    Duration `json:"writeTimeout"`
+	IdleTimeout     Duration `json:"idleTimeout"`
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+}
+
+type DBConfig struct {
+	// Path to the sqlite database file.
+	Path string `json:"path"`
+}
+
+type QueueConfig struct {
+	// "valkey" or "memory". The memory queue is served by in-process worker (package capture),
+	// requests are lost on shutdown.
+	Backend string `json:"backend"`
+}
+
+type ValkeyConfig struct {
+	Addr     string `json:"addr"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Index of the logical database.
+	DB  int  `json:"db"`
+	TLS bool `json:"tls"`
+	// How long can recieved result stay unacknowledged. Zero disables acknowledgement.
+	VisibilityTimeout Duration `json:"visibilityTimeout"`
+}
+
+type ArchiveConfig struct {
+	// Prefix of archival URLs. Timestamp and captured URL are appended to it.
+	WaybackURL string `json:"waybackURL"`
+}
+
+// Memento (RFC 7089) endpoints of a web archive used to look up existing captures of seeds.
+type MementoConfig struct {
+	// Prefix of link-format TimeMaps, the seed URL is appended to it. Empty disables the lookups.
+	TimeMapURL string `json:"timeMapURL"`
+	// Prefix of TimeGates, the seed URL is appended to it. Empty disables the lookups of the latest memento.
+	TimeGateURL string `json:"timeGateURL"`
+	// Timeout of one request to the archive.
+	Timeout Duration `json:"timeout"`
+	// If the archive already has a memento of the seed younger than this, the seed is not captured again
+	// and the memento is used instead. Zero always captures.
+	SkipCaptureFresherThan Duration `json:"skipCaptureFresherThan"`
+}
+
+// Replay of the WACZ files created by workers directly in Jinovatka. Needs the artifact storage.
+type ReplayConfig struct {
+	// Origin the ReplayWeb.page viewer is served from, for example "https://replay.example.org".
+	// Archived pages run their scripts in the viewer, so its host must differ from the host of the application.
+	// Requests for this host are answered only by the viewer. Empty disables replay.
+	Origin string `json:"origin"`
+}
+
+// Storage of files created by captures (WACZ), shared by the server and the workers.
+type ArtifactsConfig struct {
+	// "filesystem", "s3" or empty. Empty disables everything that reads the files (replay...).
+	Backend string `json:"backend"`
+	// Directory of the filesystem backend. Workers must write to the same directory (shared volume).
+	Dir string   `json:"dir"`
+	S3  S3Config `json:"s3"`
+
+	// How often to look for WACZ files due for fixity check.
+	FixityCheckInterval Duration `json:"fixityCheckInterval"`
+	// Each WACZ is hashed and validated again after this time.
+	FixityRecheckAfter Duration `json:"fixityRecheckAfter"`
+	// Maximum number of WACZ files checked in one run.
+	FixityBatchSize int `json:"fixityBatchSize"`
+
+	// How often to compare new captures with the previous captures of their seeds.
+	ChangeCheckInterval Duration `json:"changeCheckInterval"`
+	// Maximum number of captures compared in one run.
+	ChangeBatchSize int `json:"changeBatchSize"`
+}
+
+// S3 compatible object storage, for example MinIO.
+type S3Config struct {
+	// URL of the service without bucket, for example "http://localhost:9000".
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region"`
+	Bucket   string `json:"bucket"`
+	// Prepended to all keys, for example "captures/". Optional.
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+type InputConfig struct {
+	// Maximum length of one seed URL.
+	MaxURLLength int `json:"maxURLLength"`
+	// Maximum number of URLs submitted at once.
+	MaxURLs int `json:"maxURLs"`
+	// Store seed URLs in canonical form, so the same page submitted twice gets the same URL.
+	CanonicalizeURLs bool `json:"canonicalizeURLs"`
+	// Remove tracking parameters (utm_source, fbclid...) during canonicalisation. Also affects SURT keys of seeds.
+	StripTrackingParams bool `json:"stripTrackingParams"`
+	// Remove fragments (#...) during canonicalisation.
+	StripFragments bool `json:"stripFragments"`
+	// Resolve hosts of submitted URLs and reject those pointing to loopback, private, link-local
+	// or other non-public addresses. The go worker checks every URL it fetches too.
+	RejectNonPublicHosts bool `json:"rejectNonPublicHosts"`
+	// Timeout of one host lookup.
+	HostLookupTimeout Duration `json:"hostLookupTimeout"`
+	// JSON file with rules deciding which URLs are accepted, edited on the admin page. It is created when the rules
+	// are changed. Empty keeps the rules only in memory, they are lost on restart.
+	PolicyPath string `json:"policyPath"`
+}
+
+type CaptureConfig struct {
+	// Seeds that are Pending for longer than this are enqueued again.
+	StalePendingDeadline Duration `json:"stalePendingDeadline"`
+	// How often to look for stale Pending seeds.
+	StalePendingCheckInterval Duration `json:"stalePendingCheckInterval"`
+	// After this many attempts the seed is marked as DoneFailure.
+	MaxCaptureAttempts int `json:"maxCaptureAttempts"`
+	// How often to look for scheduled captures that are due.
+	ScheduleCheckInterval Duration `json:"scheduleCheckInterval"`
+	// IANA time zone of the times in schedules, for example "Europe/Prague".
+	ScheduleTimeZone string `json:"scheduleTimeZone"`
+	// If other seed with the same URL was captured more recently than this, the capture is reused
+	// instead of capturing the seed again. Only captures of public seeds are reused. Users can ask for fresh capture.
+	// Zero (default) always captures.
+	ReuseCaptureFresherThan Duration `json:"reuseCaptureFresherThan"`
+}
+
+// Default configuration. It is used as base for the loaded configuration, so the file only needs to contain changed values.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Address:         "localhost:8080",
+			ReadTimeout:     Duration{30 * time.Second},
+			WriteTimeout:    Duration{30 * time.Second},
+			IdleTimeout:     Duration{2 * time.Minute},
+			ShutdownTimeout: Duration{120 * time.Second},
+		},
+		DB: DBConfig{
+			Path: "storage.db",
+		},
+		Queue: QueueConfig{
+			Backend: "valkey",
+		},
+		Valkey: ValkeyConfig{
+			Addr:              "localhost",
+			Port:              "6379",
+			VisibilityTimeout: Duration{5 * time.Minute},
+		},
+		Archive: ArchiveConfig{
+			WaybackURL: "https://wayback.webarchiv.cz/wayback/",
+		},
+		Memento: MementoConfig{
+			Timeout: Duration{10 * time.Second},
+		},
+		Artifacts: ArtifactsConfig{
+			S3: S3Config{
+				Region: "us-east-1",
+			},
+			FixityCheckInterval: Duration{time.Hour},
+			FixityRecheckAfter:  Duration{7 * 24 * time.Hour},
+			FixityBatchSize:     100,
+			ChangeCheckInterval: Duration{time.Minute},
+			ChangeBatchSize:     50,
+		},
+		Input: InputConfig{
+			// 64kB. Some quick reaserch seems to show that larger URLs could cause issues during crawls.
+			MaxURLLength:         64 << 10,
+			MaxURLs:              20,
+			CanonicalizeURLs:     true,
+			StripTrackingParams:  true,
+			StripFragments:       true,
+			RejectNonPublicHosts: true,
+			HostLookupTimeout:    Duration{5 * time.Second},
+			PolicyPath:           "policy.json",
+		},
+		Capture: CaptureConfig{
+			StalePendingDeadline:      Duration{30 * time.Minute},
+			StalePendingCheckInterval: Duration{5 * time.Minute},
+			MaxCaptureAttempts:        3,
+			ScheduleCheckInterval:     Duration{time.Minute},
+			ScheduleTimeZone:          "Europe/Prague",
+		},
+	}
+}
+
+// Load configuration from the JSON file at path, apply enviroment overrides and validate it.
+// If path is empty, only defaults and enviroment are used.
+func Load(path string) (*Config, error) {
+	config := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config.Load failed to read file: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		// Typos in the file should not be silently ignored.
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+		if err != nil {
+			return nil, fmt.Errorf("config.Load failed to parse file %s: %w", path, err)
+		}
+	}
+	err := config.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("config.Load failed to apply enviroment: %w", err)
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("config.Load found invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
+// Check all values. Returns all problems at once.
+func (config *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(config.Server.Address != "", "server.address can't be empty")
+	if config.Server.PublicBaseURL != "" {
+		check(isAbsoluteHTTPURL(config.Server.PublicBaseURL), "server.publicBaseURL must be absolute http(s) URL, got %q", config.Server.PublicBaseURL)
+	}
+	check(config.Server.ReadTimeout.Duration >= 0, "server.readTimeout can't be negative")
+	check(config.Server.WriteTimeout.Duration >= 0, "server.writeTimeout can't be negative")
+	check(config.Server.IdleTimeout.Duration >= 0, "server.idleTimeout can't be negative")
+	check(config.Server.ShutdownTimeout.Duration > 0, "server.shutdownTimeout must be positive")
+
+	check(config.DB.Path != "", "db.path can't be empty")
+
+	check(config.Queue.Backend == "valkey" || config.Queue.Backend == "memory", "queue.backend must be \"valkey\" or \"memory\", got %q", config.Queue.Backend)
+
+	// The in-process worker of the memory queue stores the WACZ files into the artifact storage.
+	check(config.Queue.Backend != "memory" || config.Artifacts.Backend != "", "queue.backend \"memory\" needs artifacts.backend")
+	if config.Queue.Backend == "valkey" {
+		check(config.Valkey.Addr != "", "valkey.addr can't be empty")
+		check(isPort(config.Valkey.Port), "valkey.port must be number between 1 and 65535, got %q", config.Valkey.Port)
+		check(config.Valkey.DB >= 0, "valkey.db can't be negative")
+		check(config.Valkey.VisibilityTimeout.Duration >= 0, "valkey.visibilityTimeout can't be negative")
+	}
+
+	check(isAbsoluteHTTPURL(config.Archive.WaybackURL), "archive.waybackURL must be absolute http(s) URL, got %q", config.Archive.WaybackURL)
+	check(strings.HasSuffix(config.Archive.WaybackURL, "/"), "archive.waybackURL must end with /")
+
+	if config.Memento.TimeMapURL != "" {
+		check(isAbsoluteHTTPURL(config.Memento.TimeMapURL), "memento.timeMapURL must be absolute http(s) URL, got %q", config.Memento.TimeMapURL)
+	}
+	if config.Memento.TimeGateURL != "" {
+		check(isAbsoluteHTTPURL(config.Memento.TimeGateURL), "memento.timeGateURL must be absolute http(s) URL, got %q", config.Memento.TimeGateURL)
+	}
+	check(config.Memento.Timeout.Duration > 0, "memento.timeout must be positive")
+	check(config.Memento.SkipCaptureFresherThan.Duration >= 0, "memento.skipCaptureFresherThan can't be negative")
+	check(config.Memento.SkipCaptureFresherThan.Duration == 0 || config.Memento.TimeGateURL != "", "memento.skipCaptureFresherThan needs memento.timeGateURL")
+
+	if config.Replay.Origin != "" {
+		origin := config.Replay.OriginURL()
+		check(origin != nil, "replay.origin must be absolute http(s) URL without path, got %q", config.Replay.Origin)
+		if public := config.Server.PublicURL(); origin != nil && public != nil {
+			check(!strings.EqualFold(origin.Hostname(), public.Hostname()), "replay.origin must have other host than server.publicBaseURL")
+		}
+	}
+
+	switch config.Artifacts.Backend {
+	case "":
+	case "filesystem":
+		check(config.Artifacts.Dir != "", "artifacts.dir can't be empty with filesystem backend")
+	case "s3":
+		check(isAbsoluteHTTPURL(config.Artifacts.S3.Endpoint), "artifacts.s3.endpoint must be absolute http(s) URL, got %q", config.Artifacts.S3.Endpoint)
+		check(config.Artifacts.S3.Bucket != "" && !strings.Contains(config.Artifacts.S3.Bucket, "/"), "artifacts.s3.bucket must be bucket name, got %q", config.Artifacts.S3.Bucket)
+		check(config.Artifacts.S3.Region != "", "artifacts.s3.region can't be empty")
+		check(config.Artifacts.S3.AccessKey != "" && config.Artifacts.S3.SecretKey != "", "artifacts.s3.accessKey and artifacts.s3.secretKey can't be empty")
+	default:
+		check(false, "artifacts.backend must be \"filesystem\", \"s3\" or empty, got %q", config.Artifacts.Backend)
+	}
+	check(config.Artifacts.FixityCheckInterval.Duration > 0, "artifacts.fixityCheckInterval must be positive")
+	check(config.Artifacts.FixityRecheckAfter.Duration > 0, "artifacts.fixityRecheckAfter must be positive")
+	check(config.Artifacts.FixityBatchSize > 0, "artifacts.fixityBatchSize must be positive")
+	check(config.Artifacts.ChangeCheckInterval.Duration > 0, "artifacts.changeCheckInterval must be positive")
+	check(config.Artifacts.ChangeBatchSize > 0, "artifacts.changeBatchSize must be positive")
+
+	check(config.Input.MaxURLLength > 0, "input.maxURLLength must be positive")
+	check(config.Input.MaxURLs > 0, "input.maxURLs must be positive")
+	check(config.Input.HostLookupTimeout.Duration > 0, "input.hostLookupTimeout must be positive")
+
+	check(config.Capture.StalePendingDeadline.Duration > 0, "capture.stalePendingDeadline must be positive")
+	check(config.Capture.StalePendingCheckInterval.Duration > 0, "capture.stalePendingCheckInterval must be positive")
+	check(config.Capture.MaxCaptureAttempts > 0, "capture.maxCaptureAttempts must be positive")
+	check(config.Capture.ScheduleCheckInterval.Duration > 0, "capture.scheduleCheckInterval must be positive")
+	_, err := time.LoadLocation(config.Capture.ScheduleTimeZone)
+	check(err == nil && config.Capture.ScheduleTimeZone != "", "capture.scheduleTimeZone must be IANA time zone, got %q", config.Capture.ScheduleTimeZone)
+	check(config.Capture.ReuseCaptureFresherThan.Duration >= 0, "capture.reuseCaptureFresherThan can't be negative")
+
+	return errors.Join(errs...)
+}
+
+// Location of ScheduleTimeZone. Local time if it is invalid, Validate checks it.
+func (config *CaptureConfig) ScheduleLocation() *time.Location {
+	location, err := time.LoadLocation(config.ScheduleTimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+// Public base URL parsed. Nil if it is not set.
+func (config *ServerConfig) PublicURL() *url.URL {
+	if config.PublicBaseURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(config.PublicBaseURL)
+	if err != nil {
+		return nil // Validate checks this.
+	}
+	return parsed
+}
+
+// Replay origin parsed. Nil if it is not set or it is not absolute http(s) URL without path.
+func (config *ReplayConfig) OriginURL() *url.URL {
+	if !isAbsoluteHTTPURL(config.Origin) {
+		return nil
+	}
+	parsed, _ := url.Parse(config.Origin)
+	if strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return nil
+	}
+	return &url.URL{Scheme: parsed.Scheme, Host: parsed.Host}
+}
+
+func isAbsoluteHTTPURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func isPort(port string) bool {
+	number, err := strconv.Atoi(port)
+	return err == nil && number > 0 && number <= 65535
+}
+
+// Duration that is written as string in JSON, for example "30s" or "5m".
+type Duration struct {
+	time.Duration
+}
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(duration.String())
+}
+
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return fmt.Errorf("duration must be string like \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	duration.Duration = parsed
+	return nil
+}
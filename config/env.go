@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Enviroment variable with path to the configuration file.
+const PathEnv = "CONFIG_PATH"
+
+// Enviroment variables that override values from the configuration file.
+// The names of variables that existed before the configuration file are kept.
+func (config *Config) envOverrides() map[string]func(value string) error {
+	return map[string]func(value string) error{
+		"SERVER_ADDRESS":          setString(&config.Server.Address),
+		"PUBLIC_BASE_URL":         setString(&config.Server.PublicBaseURL),
+		"SERVER_READ_TIMEOUT":     setDuration(&config.Server.ReadTimeout),
+		"SERVER_WRITE_TIMEOUT":    setDuration(&config.Server.WriteTimeout),
+		"SERVER_IDLE_TIMEOUT":     setDuration(&config.Server.IdleTimeout),
+		"SERVER_SHUTDOWN_TIMEOUT": setDuration(&config.Server.ShutdownTimeout),
+
+		"DB_PATH": setString(&config.DB.Path),
+
+		"QUEUE_BACKEND": setString(&config.Queue.Backend),
+
+		"VALKEY_ADDR":               setString(&config.Valkey.Addr),
+		"VALKEY_PORT":               setString(&config.Valkey.Port),
+		"VALKEY_USERNAME":           setString(&config.Valkey.Username),
+		"VALKEY_PASSWORD":           setString(&config.Valkey.Password),
+		"VALKEY_DB":                 setInt(&config.Valkey.DB),
+		"VALKEY_TLS":                setBool(&config.Valkey.TLS),
+		"VALKEY_VISIBILITY_TIMEOUT": setDuration(&config.Valkey.VisibilityTimeout),
+
+		"WAYBACK_URL": setString(&config.Archive.WaybackURL),
+
+		"MEMENTO_TIMEMAP_URL":               setString(&config.Memento.TimeMapURL),
+		"MEMENTO_TIMEGATE_URL":              setString(&config.Memento.TimeGateURL),
+		"MEMENTO_TIMEOUT":                   setDuration(&config.Memento.Timeout),
+		"MEMENTO_SKIP_CAPTURE_FRESHER_THAN": setDuration(&config.Memento.SkipCaptureFresherThan),
+
+		"REPLAY_ORIGIN": setString(&config.Replay.Origin),
+
+		"ARTIFACT_BACKEND":       setString(&config.Artifacts.Backend),
+		"ARTIFACT_DIR":           setString(&config.Artifacts.Dir),
+		"ARTIFACT_S3_ENDPOINT":   setString(&config.Artifacts.S3.Endpoint),
+		"ARTIFACT_S3_REGION":     setString(&config.Artifacts.S3.Region),
+		"ARTIFACT_S3_BUCKET":     setString(&config.Artifacts.S3.Bucket),
+		"ARTIFACT_S3_PREFIX":     setString(&config.Artifacts.S3.Prefix),
+		"ARTIFACT_S3_ACCESS_KEY": setString(&config.Artifacts.S3.AccessKey),
+		"ARTIFACT_S3_SECRET_KEY": setString(&config.Artifacts.S3.SecretKey),
+
+		"ARTIFACT_FIXITY_CHECK_INTERVAL": setDuration(&config.Artifacts.FixityCheckInterval),
+		"ARTIFACT_FIXITY_RECHECK_AFTER":  setDuration(&config.Artifacts.FixityRecheckAfter),
+		"ARTIFACT_FIXITY_BATCH_SIZE":     setInt(&config.Artifacts.FixityBatchSize),
+		"ARTIFACT_CHANGE_CHECK_INTERVAL": setDuration(&config.Artifacts.ChangeCheckInterval),
+		"ARTIFACT_CHANGE_BATCH_SIZE":     setInt(&config.Artifacts.ChangeBatchSize),
+
+		"MAX_URL_LENGTH":          setInt(&config.Input.MaxURLLength),
+		"MAX_URLS":                setInt(&config.Input.MaxURLs),
+		"CANONICALIZE_URLS":       setBool(&config.Input.CanonicalizeURLs),
+		"STRIP_TRACKING_PARAMS":   setBool(&config.Input.StripTrackingParams),
+		"STRIP_URL_FRAGMENTS":     setBool(&config.Input.StripFragments),
+		"REJECT_NON_PUBLIC_HOSTS": setBool(&config.Input.RejectNonPublicHosts),
+		"HOST_LOOKUP_TIMEOUT":     setDuration(&config.Input.HostLookupTimeout),
+		"POLICY_PATH":             setString(&config.Input.PolicyPath),
+
+		"STALE_PENDING_DEADLINE":       setDuration(&config.Capture.StalePendingDeadline),
+		"STALE_PENDING_CHECK_INTERVAL": setDuration(&config.Capture.StalePendingCheckInterval),
+		"MAX_CAPTURE_ATTEMPTS":         setInt(&config.Capture.MaxCaptureAttempts),
+		"SCHEDULE_CHECK_INTERVAL":      setDuration(&config.Capture.ScheduleCheckInterval),
+		"SCHEDULE_TIME_ZONE":           setString(&config.Capture.ScheduleTimeZone),
+		"REUSE_CAPTURE_FRESHER_THAN":   setDuration(&config.Capture.ReuseCaptureFresherThan),
+	}
+}
+
+// Apply overrides from enviroment. lookup has the signature of os.LookupEnv.
+func (config *Config) applyEnv(lookup func(key string) (string, bool)) error {
+	var errs []error
+	for key, set := range config.envOverrides() {
+		value, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		err := set(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value of %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func setInt(target *int) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setDuration(target *Duration) func(string) error {
+	return func(value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		target.Duration = parsed
+		return nil
+	}
+}
@@ -0,0 +1,173 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Package cron parses standard five field cron expressions "minute hour day-of-month month day-of-week".
+// Fields can be "*", numbers, ranges "1-5", steps "*/15" or "1-30/2" and lists "1,15". Months and days of week
+// can be written as names (jan, mon). Sunday is 0 or 7. If both day fields are restricted, either of them matches.
+
+var ErrInvalidExpression = errors.New("invalid cron expression")
+
+// How far Next looks. Expressions like "0 0 30 2 *" never match.
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+type Expression struct {
+	// Source of the expression.
+	Source string
+
+	minutes, hours, days, months, weekdays uint64
+	// The field was "*", see the rule about day fields.
+	anyDay, anyWeekday bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+func Parse(source string) (*Expression, error) {
+	parts := strings.Fields(source)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("%w: %q must have %d fields, has %d", ErrInvalidExpression, source, len(fields), len(parts))
+	}
+	bits := make([]uint64, len(fields))
+	for i, part := range parts {
+		parsed, err := fields[i].parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidExpression, source, err)
+		}
+		bits[i] = parsed
+	}
+	// Sunday is both 0 and 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &Expression{
+		Source:     strings.Join(parts, " "),
+		minutes:    bits[0],
+		hours:      bits[1],
+		days:       bits[2],
+		months:     bits[3],
+		weekdays:   bits[4],
+		anyDay:     parts[2] == "*",
+		anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+func (f *field) parse(text string) (uint64, error) {
+	var bits uint64
+	for item := range strings.SplitSeq(text, ",") {
+		rangeText, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s has invalid step %q", f.name, stepText)
+			}
+		}
+		var low, high int
+		if rangeText == "*" {
+			low, high = f.min, f.max
+		} else {
+			lowText, highText, isRange := strings.Cut(rangeText, "-")
+			var err error
+			low, err = f.value(lowText)
+			if err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				high, err = f.value(highText)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to the end by 15.
+				high = f.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("%s has reversed range %q", f.name, rangeText)
+			}
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+func (f *field) value(text string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return i + f.min, nil
+		}
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("%s must be from %d to %d, got %q", f.name, f.min, f.max, text)
+	}
+	return value, nil
+}
+
+// The first time after t matching the expression, in the location of t. Zero value if nothing matches in next 5 years.
+// Times skipped by daylight saving change don't match, repeated times match once.
+func (expression *Expression) Next(t time.Time) time.Time {
+	location := t.Location()
+	limit := t.Add(searchLimit)
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	for next.Before(limit) {
+		if expression.months&(1<<uint(next.Month())) == 0 {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !expression.dayMatches(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		if expression.hours&(1<<uint(next.Hour())) == 0 {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, location)
+			continue
+		}
+		// The second pass through the hour repeated by daylight saving change is behind t on the clock.
+		if expression.minutes&(1<<uint(next.Minute())) == 0 || !wallClock(next).After(wallClock(t)) {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+func (expression *Expression) dayMatches(t time.Time) bool {
+	day := expression.days&(1<<uint(t.Day())) != 0
+	weekday := expression.weekdays&(1<<uint(t.Weekday())) != 0
+	if expression.anyDay || expression.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// The same date and time on the clock in UTC, so times in the location can be compared as they are written.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func (expression *Expression) String() string {
+	return expression.Source
+}
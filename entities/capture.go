@@ -8,6 +8,11 @@ type CaptureRequest struct {
 	SeedShadowID string `json:"seedShadowID"`
 	// The status of the request.
 	State CaptureState `json:"state"`
+	// Number of the attempt of this capture of the seed. The first attempt is 1, lost requests are enqueued again with higher numbers.
+	Attempt int `json:"attempt"`
+	// Unique identifier of the enqueued message, set by the queue. It keeps equal requests distinct in Valkey,
+	// where the raw messages are members of the deadline sets.
+	DeliveryID string `json:"deliveryID,omitempty"`
 }
 
 func NewRequestFromSeed(seed *Seed) *CaptureRequest {
@@ -15,6 +20,7 @@ func NewRequestFromSeed(seed *Seed) *CaptureRequest {
 		SeedURL:      seed.URL,
 		SeedShadowID: seed.ShadowID,
 		State:        NotEnqueued,
+		Attempt:      seed.CaptureAttempts + 1,
 	}
 }
 
@@ -47,6 +53,23 @@ type CaptureResult struct {
 	ErrorMessages []string `json:"errorMessages"`
 
 	CaptureMetadata *CaptureMetadata `json:"captureMetadata"`
+
+	// Identifier of the worker that made the capture. Optional.
+	WorkerID string `json:"workerID,omitempty"`
+	// Where the worker stored the WACZ file, for example file:///data/x.wacz or s3://bucket/x.wacz. Optional.
+	WaczLocation string `json:"waczLocation,omitempty"`
+	// Key of the WACZ in the shared artifact storage (see package artifact). Optional.
+	WaczKey string `json:"waczKey,omitempty"`
+	// Size of the WACZ in bytes. Optional.
+	WaczSize int64 `json:"waczSize,omitempty"`
+	// Lowercase hex SHA-256 of the WACZ. Optional.
+	WaczSHA256 string `json:"waczSha256,omitempty"`
+	// Category of the error if the worker knows it. Optional, the server classifies the ErrorMessages if it is empty.
+	ErrorCategory CaptureErrorCategory `json:"errorCategory,omitempty"`
+	// Metadata of the captured page. Optional, it may be present even if the capture failed (HTTP status, redirects).
+	PageMetadata *PageMetadata `json:"pageMetadata,omitempty"`
+	// Unique identifier of the pushed message, set by the queue. See CaptureRequest.DeliveryID.
+	DeliveryID string `json:"deliveryID,omitempty"`
 }
 
 type CaptureMetadata struct {
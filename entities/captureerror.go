@@ -0,0 +1,60 @@
+package entities
+
+// Category of the error that caused capture to fail.
+type CaptureErrorCategory string
+
+const (
+	// The capture didn't fail.
+	NoCaptureError CaptureErrorCategory = ""
+	// The domain name couldn't be resolved.
+	DNSError CaptureErrorCategory = "DNS"
+	// The server didn't respond in time or the capture took too long.
+	TimeoutError CaptureErrorCategory = "Timeout"
+	// The server responded with HTTP status 4xx.
+	HTTPClientError CaptureErrorCategory = "HTTPClient"
+	// The server responded with HTTP status 5xx.
+	HTTPServerError CaptureErrorCategory = "HTTPServer"
+	// The worker couldn't write the WACZ file.
+	WriteError CaptureErrorCategory = "Write"
+	// The worker couldn't extract capture metadata or the metadata were invalid.
+	MetadataError CaptureErrorCategory = "Metadata"
+	// The WACZ file the worker reported is missing, damaged or doesn't contain the capture.
+	IntegrityError CaptureErrorCategory = "Integrity"
+	// Any other error.
+	UnknownError CaptureErrorCategory = "Unknown"
+)
+
+func (category CaptureErrorCategory) IsCaptureErrorCategory() bool {
+	return category == NoCaptureError ||
+		category == DNSError ||
+		category == TimeoutError ||
+		category == HTTPClientError ||
+		category == HTTPServerError ||
+		category == WriteError ||
+		category == MetadataError ||
+		category == IntegrityError ||
+		category == UnknownError
+}
+
+// Human friendly explanation of the error in czech. Empty for NoCaptureError.
+func (category CaptureErrorCategory) Description() string {
+	switch category {
+	case NoCaptureError:
+		return ""
+	case DNSError:
+		return "Doménu se nepodařilo najít. Zkontrolujte, zda je adresa správně zapsaná a stránka stále existuje."
+	case TimeoutError:
+		return "Server neodpověděl včas. Stránka může být přetížená nebo dočasně nedostupná."
+	case HTTPClientError:
+		return "Server odmítl stránku vydat (chyba 4xx). Stránka nemusí existovat nebo k ní nemáme přístup."
+	case HTTPServerError:
+		return "Na straně serveru došlo k chybě (chyba 5xx). Zkuste sklizeň zopakovat později."
+	case WriteError:
+		return "Sklizeň se nepodařilo uložit. Chyba je na naší straně."
+	case MetadataError:
+		return "Ze sklizně se nepodařilo získat údaje potřebné pro archivní odkaz. Chyba je na naší straně."
+	case IntegrityError:
+		return "Uložený soubor se sklizní chybí nebo je poškozený. Chyba je na naší straně, sklizeň je potřeba zopakovat."
+	}
+	return "Při sklizni došlo k neznámé chybě."
+}
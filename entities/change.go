@@ -0,0 +1,42 @@
+package entities
+
+// Result of comparing main text of the capture with the previous capture of the same seed, see services.ChangeService.
+type ChangeStatus string
+
+const (
+	// The capture wasn't compared yet.
+	ChangeUnchecked ChangeStatus = ""
+	// There is no earlier capture of the seed to compare with.
+	ChangeFirst ChangeStatus = "First"
+	// The main text is the same as in the previous capture.
+	ChangeUnchanged ChangeStatus = "Unchanged"
+	// The main text differs from the previous capture.
+	ChangeChanged ChangeStatus = "Changed"
+	// The text couldn't be read, the WACZ is missing, damaged or doesn't contain the page.
+	ChangeUnavailable ChangeStatus = "Unavailable"
+)
+
+func (status ChangeStatus) IsChangeStatus() bool {
+	return status == ChangeUnchecked ||
+		status == ChangeFirst ||
+		status == ChangeUnchanged ||
+		status == ChangeChanged ||
+		status == ChangeUnavailable
+}
+
+// Human friendly description of the status in czech.
+func (status ChangeStatus) Description() string {
+	switch status {
+	case ChangeUnchecked:
+		return "Zatím neporovnáno"
+	case ChangeFirst:
+		return "První sklizeň"
+	case ChangeUnchanged:
+		return "Beze změny"
+	case ChangeChanged:
+		return "Změněno"
+	case ChangeUnavailable:
+		return "Nelze porovnat"
+	}
+	return "Neznámý stav"
+}
@@ -0,0 +1,42 @@
+package entities
+
+// Result of the last fixity check of stored WACZ. Checks re-hash the WACZ and validate it, see services.FixityChecker.
+type FixityStatus string
+
+const (
+	// The WACZ wasn't checked yet.
+	FixityUnchecked FixityStatus = ""
+	// The WACZ has the recorded hash and is valid.
+	FixityOK FixityStatus = "OK"
+	// The WACZ is not in the artifact storage.
+	FixityMissing FixityStatus = "Missing"
+	// The WACZ doesn't have the recorded hash, is invalid or doesn't contain the capture.
+	FixityCorrupted FixityStatus = "Corrupted"
+)
+
+func (status FixityStatus) IsFixityStatus() bool {
+	return status == FixityUnchecked ||
+		status == FixityOK ||
+		status == FixityMissing ||
+		status == FixityCorrupted
+}
+
+// The WACZ is missing or corrupted.
+func (status FixityStatus) IsProblem() bool {
+	return status == FixityMissing || status == FixityCorrupted
+}
+
+// Human friendly description of the status in czech.
+func (status FixityStatus) Description() string {
+	switch status {
+	case FixityUnchecked:
+		return "Zatím nezkontrolováno"
+	case FixityOK:
+		return "V pořádku"
+	case FixityMissing:
+		return "Soubor se sklizní chybí"
+	case FixityCorrupted:
+		return "Soubor se sklizní je poškozený"
+	}
+	return "Neznámý stav"
+}
@@ -0,0 +1,13 @@
+package entities
+
+import (
+	"time"
+)
+
+// Archived version of a resource in a web archive, as defined by Memento (RFC 7089).
+type Memento struct {
+	// URL of the memento in the archive.
+	URL string
+	// Time the resource was captured.
+	Datetime time.Time
+}
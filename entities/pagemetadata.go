@@ -0,0 +1,23 @@
+package entities
+
+// Bibliographic and technical metadata of the captured page as reported by the worker.
+// All values are optional, pages often don't have them.
+type PageMetadata struct {
+	// Content of the HTML title, or og:title if the page has no title.
+	Title string `json:"title,omitempty"`
+	// Authors from meta tags (author, Dublin Core, og/article, schema.org).
+	Authors []string `json:"authors,omitempty"`
+	// Name of the web site (og:site_name, schema.org publisher).
+	SiteName string `json:"siteName,omitempty"`
+	// Publication and modification date as written in the page, usually ISO 8601.
+	PublishedAt string `json:"publishedAt,omitempty"`
+	ModifiedAt  string `json:"modifiedAt,omitempty"`
+	// Language of the page, for example "cs" or "en-US".
+	Language string `json:"language,omitempty"`
+	// Canonical URL from link rel=canonical or og:url.
+	CanonicalURL string `json:"canonicalURL,omitempty"`
+	// HTTP status of the final response after redirects. Zero if unknown.
+	StatusCode int `json:"statusCode,omitempty"`
+	// URLs that were requested before the final one, in order. Empty if there was no redirect.
+	RedirectChain []string `json:"redirectChain,omitempty"`
+}
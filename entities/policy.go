@@ -0,0 +1,73 @@
+package entities
+
+// What happens with URLs matched by a policy rule, see services.PolicyService.
+type PolicyAction string
+
+const (
+	// Matched URLs are refused.
+	PolicyDeny PolicyAction = "Deny"
+	// Matched URLs are accepted. If there is any allow rule, URLs not matched by any of them are refused.
+	PolicyAllow PolicyAction = "Allow"
+)
+
+func (action PolicyAction) IsPolicyAction() bool {
+	return action == PolicyDeny || action == PolicyAllow
+}
+
+// Human friendly name of the action in czech.
+func (action PolicyAction) Description() string {
+	switch action {
+	case PolicyDeny:
+		return "Zakázat"
+	case PolicyAllow:
+		return "Povolit"
+	}
+	return "Neznámá akce"
+}
+
+// How the pattern of a policy rule is matched against URL.
+type PolicyRuleKind string
+
+const (
+	// The host is the domain or its subdomain, for example "example.com" matches "www.example.com".
+	PolicyDomain PolicyRuleKind = "Domain"
+	// The host ends with the top-level domain, for example "cz".
+	PolicyTLD PolicyRuleKind = "TLD"
+	// The SURT key of the canonical URL starts with the pattern, for example "com,example)/private".
+	PolicySURTPrefix PolicyRuleKind = "SURTPrefix"
+	// The canonical URL matches regular expression (Go syntax) anywhere.
+	PolicyRegex PolicyRuleKind = "Regex"
+)
+
+func (kind PolicyRuleKind) IsPolicyRuleKind() bool {
+	return kind == PolicyDomain ||
+		kind == PolicyTLD ||
+		kind == PolicySURTPrefix ||
+		kind == PolicyRegex
+}
+
+// Human friendly name of the kind in czech.
+func (kind PolicyRuleKind) Description() string {
+	switch kind {
+	case PolicyDomain:
+		return "Doména a subdomény"
+	case PolicyTLD:
+		return "Doména nejvyššího řádu"
+	case PolicySURTPrefix:
+		return "Začátek klíče SURT"
+	case PolicyRegex:
+		return "Regulární výraz"
+	}
+	return "Neznámý typ"
+}
+
+// Rule deciding whether submitted URLs are accepted.
+type PolicyRule struct {
+	// Identifier of the rule in logs. Generated when the policy file doesn't set it.
+	ID      string         `json:"id"`
+	Action  PolicyAction   `json:"action"`
+	Kind    PolicyRuleKind `json:"kind"`
+	Pattern string         `json:"pattern"`
+	// Why the rule exists. Shown to users whose URL was refused. Optional.
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,90 @@
+package entities
+
+import (
+	"time"
+)
+
+// How often the schedule repeats.
+type ScheduleKind string
+
+const (
+	// Single capture at Start.
+	ScheduleOnce ScheduleKind = "Once"
+	// Every day at the time of Start.
+	ScheduleDaily ScheduleKind = "Daily"
+	// Every week on the weekday and at the time of Start.
+	ScheduleWeekly ScheduleKind = "Weekly"
+	// Every month on the day and at the time of Start. In shorter months on their last day.
+	ScheduleMonthly ScheduleKind = "Monthly"
+	// Whenever the cron expression matches, but not before Start.
+	ScheduleCron ScheduleKind = "Cron"
+)
+
+func (kind ScheduleKind) IsScheduleKind() bool {
+	return kind == ScheduleOnce ||
+		kind == ScheduleDaily ||
+		kind == ScheduleWeekly ||
+		kind == ScheduleMonthly ||
+		kind == ScheduleCron
+}
+
+// Human friendly name of the kind in czech.
+func (kind ScheduleKind) Description() string {
+	switch kind {
+	case ScheduleOnce:
+		return "Jednorázově"
+	case ScheduleDaily:
+		return "Denně"
+	case ScheduleWeekly:
+		return "Týdně"
+	case ScheduleMonthly:
+		return "Měsíčně"
+	case ScheduleCron:
+		return "Podle výrazu cron"
+	}
+	return "Neznámé opakování"
+}
+
+// Plan of repeated captures of a group or a single seed. Group or seed has at most one schedule.
+type Schedule struct {
+	// Identifier of the schedule in the repository. Zero for schedules that are not stored yet.
+	ID uint
+
+	// ShadowID of the group whose seeds are captured. Empty if the schedule belongs to single seed.
+	GroupShadowID string
+
+	// ShadowID of the captured seed. Empty if the schedule belongs to group.
+	SeedShadowID string
+
+	Kind ScheduleKind
+
+	// Time of the first run. Recurring schedules keep its time of day.
+	Start time.Time
+
+	// Cron expression of ScheduleCron, empty for other kinds.
+	Cron string
+
+	// Time of the next run. Zero value if no run is left.
+	NextRunAt time.Time
+
+	// Time of the last run. Zero value if the schedule didn't run yet.
+	LastRunAt time.Time
+}
+
+// Record of single run of a schedule in the seed history.
+type ScheduleRun struct {
+	// ShadowID of the seed that was enqueued.
+	SeedShadowID string
+
+	// Time the run was planned for.
+	ScheduledAt time.Time
+
+	// Time the seed was enqueued or skipped.
+	RanAt time.Time
+
+	// The seed was already waiting for capture, so it wasn't enqueued again.
+	Skipped bool
+
+	// Error of enqueuing. Empty if the seed was enqueued.
+	Error string
+}
@@ -8,6 +8,10 @@ type Seed struct {
 	// The original URL od seed.
 	URL string
 
+	// Sort-friendly key of the canonical seed URL (see UrlParserService.SURTKey).
+	// Seeds with the same key point to the same page. Empty for seeds saved before the key existed.
+	SURT string
+
 	// If the seed is public, hten it may be visible on the main page and can be searched for.
 	Public bool
 
@@ -21,6 +25,25 @@ type Seed struct {
 	// Must be zero value if seed wasn't harvested yet (state is NotHarvested).
 	HarvestedAt time.Time
 
+	// Time the seed was last enqueued for capture. Zero value if it was never enqueued.
+	EnqueuedAt time.Time
+
+	// Number of times the last capture of the seed was enqueued. Only enqueuing again after lost request
+	// (see services.StaleSeedReaper) increases it, new capture starts from 1.
+	CaptureAttempts int
+
+	// Errors of the last capture. Empty if the last capture was successful or there was no capture yet.
+	ErrorMessages []string
+
+	// Category of the last capture error. NoCaptureError if the last capture was successful.
+	ErrorCategory CaptureErrorCategory
+
+	// The worst fixity status of WACZ files of the seed captures. FixityUnchecked if none was checked yet.
+	FixityStatus FixityStatus
+
+	// Metadata of the page from the capture ArchivalURL points to. Nil if unknown.
+	PageMetadata *PageMetadata
+
 	// Unique randomly generated base32 encoded string with at least 128 bits of randomness.
 	// Exact size is unspecified. This allowes the use of rand.Text to generate it.
 	//
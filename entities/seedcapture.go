@@ -0,0 +1,76 @@
+package entities
+
+import (
+	"time"
+)
+
+// Single capture of a seed as reported by a worker. Seed can have many captures, both successful and failed.
+type SeedCapture struct {
+	// Identifier of the capture in the repository. Zero for captures that are not stored yet.
+	ID uint
+
+	// ShadowID of the captured seed.
+	SeedShadowID string
+
+	// DoneSuccess or DoneFailure.
+	State CaptureState
+
+	// Time the capture was taken. Zero value if the worker didn't report it.
+	CapturedAt time.Time
+
+	// URL that was captured as recorded in the index.
+	CapturedURL string
+
+	// URL of the archived resource. Empty if the capture failed.
+	ArchivalURL string
+
+	// Where the worker stored the WACZ file. Empty if unknown.
+	WaczLocation string
+
+	// Key of the WACZ in the artifact storage. Empty if unknown.
+	WaczKey string
+
+	// Size of the WACZ in bytes. Zero if unknown.
+	WaczSize int64
+
+	// Lowercase hex SHA-256 of the WACZ. Empty if unknown.
+	WaczSHA256 string
+
+	// Result of the last fixity check of the WACZ. FixityUnchecked if it wasn't checked yet.
+	FixityStatus FixityStatus
+
+	// Time of the last fixity check. Zero value if the WACZ wasn't checked yet.
+	FixityCheckedAt time.Time
+
+	// Lowercase hex SHA-256 of the main text of the page (of the whole body for pages that are not text).
+	// Empty if the capture wasn't compared yet or the text couldn't be read.
+	ContentHash string
+
+	// Result of comparison with the previous capture. ChangeUnchecked if it wasn't compared yet.
+	ChangeStatus ChangeStatus
+
+	// ID of the capture this one was compared with. Zero if there was none.
+	PreviousCaptureID uint
+
+	// Errors reported by the worker.
+	ErrorMessages []string
+
+	// Category of the error. NoCaptureError for successful captures.
+	ErrorCategory CaptureErrorCategory
+
+	// Identifier of the worker that made the capture. Empty if unknown.
+	WorkerID string
+
+	// Identifier of the queue message with the result, see CaptureResult.DeliveryID. Empty if unknown.
+	DeliveryID string
+
+	// ID of the capture of another seed with the same URL this capture was taken over from.
+	// Zero if the seed was really captured.
+	ReusedCaptureID uint
+
+	// Metadata of the captured page. Nil if the worker didn't report it.
+	PageMetadata *PageMetadata
+
+	// Time the result was recieved.
+	CreatedAt time.Time
+}
@@ -0,0 +1,166 @@
+package hostcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jinovatka/assert"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Package hostcheck protects against SSRF. Hosts of URLs are resolved and rejected if any of their addresses
+// is not public (loopback, private, link-local with the cloud metadata services, CGNAT, multicast...).
+// The server checks submitted seeds with it and the worker checks every URL before it is fetched.
+
+var (
+	// The host is or resolves to address that is not publicly routable.
+	ErrNonPublic = errors.New("the host resolves to non-public address")
+	// The host could not be resolved.
+	ErrUnresolvable = errors.New("the host could not be resolved")
+)
+
+// Resolves host names to addresses. net.Resolver implements it, tests can use map.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+func NewChecker(resolver Resolver, timeout time.Duration) *Checker {
+	assert.Must(resolver != nil, "NewChecker: resolver can't be nil")
+	return &Checker{
+		Resolver: resolver,
+		Timeout:  timeout,
+	}
+}
+
+type Checker struct {
+	Resolver Resolver
+	// Timeout of one lookup. Zero means no timeout except the one of the context.
+	Timeout time.Duration
+}
+
+// Check the host of the URL. The signature matches capture.Capturer.CheckURL.
+func (checker *Checker) CheckURL(ctx context.Context, u *url.URL) error {
+	return checker.CheckHost(ctx, u.Hostname())
+}
+
+// Check that all addresses of the host are public. IP addresses are checked without lookup.
+// Returned errors can be tested with errors.Is against ErrNonPublic and ErrUnresolvable.
+func (checker *Checker) CheckHost(ctx context.Context, host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrUnresolvable)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(host, addr)
+	}
+	// Names that must resolve to loopback (RFC 6761), whatever the resolver says.
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s is loopback", ErrNonPublic, host)
+	}
+
+	if checker.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, checker.Timeout)
+		defer cancel()
+	}
+	addrs, err := checker.Resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnresolvable, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: %s has no addresses", ErrUnresolvable, host)
+	}
+	// One bad address is enough, the client may connect to any of them.
+	for _, addr := range addrs {
+		err = checkAddr(host, addr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Can be used as net.Dialer.Control to check the address that is actually connected to.
+// That covers DNS rebinding between CheckHost and the connection.
+func DialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("hostcheck.DialControl failed to parse address %s: %w", address, err)
+	}
+	return checkAddr(address, addrPort.Addr())
+}
+
+func checkAddr(host string, addr netip.Addr) error {
+	if !IsPublic(addr) {
+		return fmt.Errorf("%w: %s is %s", ErrNonPublic, host, addr)
+	}
+	return nil
+}
+
+// Ranges that are not publicly routable, besides those covered by netip.Addr methods.
+// https://www.iana.org/assignments/iana-ipv4-special-registry and iana-ipv6-special-registry
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // Shared address space (CGNAT), also Alibaba Cloud metadata
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("fec0::/10"),       // Deprecated site-local
+}
+
+// Prefixes of IPv6 addresses with embedded IPv4 address, which is checked too.
+var (
+	nat64Prefix  = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour    = netip.MustParsePrefix("2002::/16")
+	teredoPrefix = netip.MustParsePrefix("2001::/32")
+)
+
+// Report whether the address is publicly routable unicast address.
+// IPv4-mapped, NAT64 and 6to4 addresses are judged by the IPv4 address in them.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if addr.Is6() {
+		bytes := addr.As16()
+		switch {
+		case nat64Prefix.Contains(addr):
+			return IsPublic(netip.AddrFrom4([4]byte(bytes[12:16])))
+		case sixToFour.Contains(addr):
+			return IsPublic(netip.AddrFrom4([4]byte(bytes[2:6])))
+		case teredoPrefix.Contains(addr):
+			// The client address is stored inverted.
+			client := [4]byte(bytes[12:16])
+			for i := range client {
+				client[i] ^= 0xff
+			}
+			return IsPublic(netip.AddrFrom4(client))
+		}
+	}
+	return true
+}
+
+// Dialer that refuses to connect to non-public addresses.
+func NewDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: DialControl,
+	}
+}
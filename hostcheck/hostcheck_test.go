@@ -0,0 +1,139 @@
+package hostcheck
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"127.0.0.1", false},
+		{"127.255.0.1", false},
+		{"10.0.0.1", false},
+		{"10.255.255.255", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::", false},
+		{"::1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"fe80::1%eth0", false},
+		{"ff02::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a00:1", false},
+		{"2002:7f00:1::", false},
+		{"2002:a9fe:a9fe::1", false},
+		{"2001:0:4136:e378:8000:63bf:80ff:fffe", false}, // Teredo with client 127.0.0.1
+		{"2001:db8::1", false},
+
+		{"93.184.216.34", true},
+		{"100.128.0.1", true},
+		{"172.32.0.1", true},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::5db8:d822", true},
+		{"2002:5db8:d822::1", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+	}
+	for _, test := range tests {
+		t.Run(test.addr, func(t *testing.T) {
+			addr, err := netip.ParseAddr(test.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := IsPublic(addr); got != test.public {
+				t.Errorf("IsPublic(%s) = %t, expected %t", test.addr, got, test.public)
+			}
+		})
+	}
+}
+
+// Resolver answering from map. Hosts that are not in the map are not found.
+type stubResolver map[string][]string
+
+func (resolver stubResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	answer, ok := resolver[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	addrs := make([]netip.Addr, 0, len(answer))
+	for _, addr := range answer {
+		addrs = append(addrs, netip.MustParseAddr(addr))
+	}
+	return addrs, nil
+}
+
+func TestCheckHost(t *testing.T) {
+	checker := NewChecker(stubResolver{
+		"example.com":      {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		"mixed.example":    {"93.184.216.34", "10.0.0.1"},
+		"mixed6.example":   {"2606:2800:220:1:248:1893:25c8:1946", "::ffff:127.0.0.1"},
+		"metadata.example": {"169.254.169.254"},
+		"empty.example":    {},
+	}, 0)
+	tests := []struct {
+		host string
+		err  error
+	}{
+		{"example.com", nil},
+		{"EXAMPLE.com.", nil},
+		{"93.184.216.34", nil},
+		{"mixed.example", ErrNonPublic},
+		{"mixed6.example", ErrNonPublic},
+		{"metadata.example", ErrNonPublic},
+		{"localhost", ErrNonPublic},
+		{"api.localhost", ErrNonPublic},
+		{"127.0.0.1", ErrNonPublic},
+		{"::ffff:127.0.0.1", ErrNonPublic},
+		{"169.254.169.254", ErrNonPublic},
+		{"empty.example", ErrUnresolvable},
+		{"missing.example", ErrUnresolvable},
+		{"", ErrUnresolvable},
+	}
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			err := checker.CheckHost(context.Background(), test.host)
+			if test.err == nil && err != nil {
+				t.Errorf("CheckHost(%q) returned %v, expected no error", test.host, err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("CheckHost(%q) returned %v, expected %v", test.host, err, test.err)
+			}
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		err     bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{"127.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"[::ffff:10.0.0.1]:80", true},
+		{"169.254.169.254:80", true},
+		{"example.com:80", true},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			err := DialControl("tcp", test.address, nil)
+			if (err != nil) != test.err {
+				t.Errorf("DialControl(%q) returned %v, expected error %t", test.address, err, test.err)
+			}
+		})
+	}
+}
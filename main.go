@@ -2,6 +2,12 @@ package main
 
 import (
 	"context"
+	"jinovatka/artifact"
+	"jinovatka/capture"
+	"jinovatka/config"
+	"jinovatka/hostcheck"
+	"jinovatka/queue"
+	memoryq "jinovatka/queue/memory"
 	valkeyq "jinovatka/queue/valkey"
 	"jinovatka/server"
 	"jinovatka/services"
@@ -10,9 +16,11 @@ import (
 	"jinovatka/utils"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -24,25 +32,43 @@ import (
 func main() {
 	log := slog.New(slog.Default().Handler())
 
-	const defaultDBPath = "storage.db"
-	sqlitePath, ok := os.LookupEnv("DB_PATH")
+	// Load configuration. The file is optional, defaults and enviroment are used without it.
+	configPath, ok := os.LookupEnv(config.PathEnv)
 	if !ok {
-		log.Warn("the database path is not set, using default " + defaultDBPath)
-		sqlitePath = defaultDBPath
+		log.Warn("the configuration file is not set, using defaults and enviroment")
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Error("could not load configuration", "error", err.Error())
+		os.Exit(1)
+	}
+	if cfg.Server.PublicBaseURL == "" {
+		log.Warn("the public base URL is not set, links in exports will use the Host header")
 	}
 
 	// Prepare db conection.
-	db, err := gorm.Open(sqlite.Open(sqlitePath), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(cfg.DB.Path), &gorm.Config{})
 	if err != nil {
 		log.Error("could not open database connection", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
-	// Prepare queue client
-	valkeyOptions := valkeyq.NewValkeyOptionsFromEnv()
-	client, err := valkey.NewClient(valkey.ClientOption{InitAddress: []string{net.JoinHostPort(valkeyOptions.Addr, valkeyOptions.Port)}})
-	if err != nil {
-		log.Error("failed to create valkey client", "error", err.Error())
+	// Prepare queue
+	var captureQueue queue.Queue
+	var memoryQueue *memoryq.Queue
+	switch cfg.Queue.Backend {
+	case "memory":
+		log.Warn("using in-memory queue, requests will be lost on shutdown and are captured by in-process worker")
+		memoryQueue = memoryq.NewQueue(log)
+		captureQueue = memoryQueue
+	case "valkey":
+		valkeyOptions := valkeyq.NewValkeyOptions(&cfg.Valkey)
+		client, err := valkey.NewClient(valkeyOptions.ClientOption())
+		if err != nil {
+			log.Error("failed to create valkey client", "error", err.Error())
+			os.Exit(1)
+		}
+		captureQueue = valkeyq.NewQueue(log, client, valkeyOptions.VisibilityTimeout)
 	}
 
 	// Catch SIGINT and SIGHUP. Prepare gentle shutdown.
@@ -56,37 +82,52 @@ func main() {
 	utils.ShutdownFunc = stop // Setup function, that can be used in cases, where shutdown of the server is necessary.
 
 	seedRepository := gormStorage.NewSeedRepository(log, db)
-	repository := storage.NewRepository(seedRepository)
+	captureRepository := gormStorage.NewCaptureRepository(log, db)
+	scheduleRepository := gormStorage.NewScheduleRepository(log, db)
+	repository := storage.NewRepository(seedRepository, captureRepository, scheduleRepository)
 
-	queue := valkeyq.NewQueue(log, client)
+	initiatedServices := services.NewServices(log, cfg, repository, captureQueue, server.ReplayViewerFiles())
 
-	initiatedServices := services.NewServices(log, repository, queue)
-
-	const defaultServerAdderss = "localhost:8080"
-	serverAddress, ok := os.LookupEnv("SERVER_ADDRESS")
-	if !ok {
-		log.Warn("the server adress is not set, using default " + defaultServerAdderss)
-		serverAddress = defaultServerAdderss
-	}
 	server := server.NewServer(
 		stopSignal,
 		log,
-		serverAddress,
+		cfg,
 		initiatedServices,
 	)
 
 	// Start the server in new goroutine
 	go server.ListenAndServe()
-	log.Info("Server is listening at http://" + serverAddress)
+	log.Info("Server is listening at http://" + cfg.Server.Address)
+
+	// Start capturing requests of the in-memory queue
+	if memoryQueue != nil {
+		capturer := newInProcessCapturer(log, cfg, initiatedServices.ArtifactService.Storage)
+		memoryQueue.Serve(stopSignal, capturer.Capture)
+		log.Info("In-process worker is capturing requests")
+	}
 
 	// Start listening for results from queue
 	initiatedServices.CaptureService.ListenForResults(stopSignal)
 	log.Info("CaptureService is listening for CaptureResults")
 
+	// Start enqueuing seeds with lost requests
+	initiatedServices.StaleSeedReaper.Run(stopSignal)
+	log.Info("StaleSeedReaper is running")
+
+	// Start checking stored WACZ files
+	initiatedServices.FixityChecker.Run(stopSignal)
+
+	// Start comparing new captures with the previous ones
+	initiatedServices.ChangeService.Run(stopSignal)
+
+	// Start enqueuing scheduled captures
+	initiatedServices.ScheduleService.Run(stopSignal)
+	log.Info("ScheduleService is running")
+
 	// Wait for interupt
 	<-stopSignal.Done()
 	// Wait for shutdown (or timeout and go eat dirt)
-	shutdownTimeout, stop := context.WithTimeout(context.Background(), 120*time.Second)
+	shutdownTimeout, stop := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
 	defer stop()
 	err = server.Shutdown(shutdownTimeout)
 	if err != nil {
@@ -94,3 +135,22 @@ func main() {
 	}
 	log.Info("Server shutdown")
 }
+
+// Capturer of the in-memory queue, set up like the go worker (workers/go-worker).
+func newInProcessCapturer(log *slog.Logger, cfg *config.Config, storage artifact.Storage) *capture.Capturer {
+	httpClient := &http.Client{Timeout: time.Minute}
+	if cfg.Input.RejectNonPublicHosts {
+		// Every URL is checked before it is fetched and the dialer checks the address that is connected to.
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = hostcheck.NewDialer(30 * time.Second).DialContext
+		transport.Proxy = nil
+		httpClient.Transport = transport
+	}
+	capturer := capture.NewCapturer(log, httpClient, storage)
+	if cfg.Input.RejectNonPublicHosts {
+		capturer.CheckURL = hostcheck.NewChecker(net.DefaultResolver, cfg.Input.HostLookupTimeout.Duration).CheckURL
+	}
+	hostname, _ := os.Hostname()
+	capturer.WorkerID = "in-process@" + hostname + ":" + strconv.Itoa(os.Getpid())
+	return capturer
+}
@@ -0,0 +1,207 @@
+package memento
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Package memento implements the parts of Memento (RFC 7089) shared by the client of other archives and the server:
+// the link-format of TimeMaps and Link headers (RFC 6690, RFC 8288) and the datetime format.
+
+// Content type of link-format TimeMaps.
+const LinkFormat = "application/link-format"
+
+// Headers defined by Memento.
+const (
+	AcceptDatetimeHeader  = "Accept-Datetime"
+	MementoDatetimeHeader = "Memento-Datetime"
+)
+
+// Relation types used by Memento.
+const (
+	RelOriginal = "original"
+	RelTimeGate = "timegate"
+	RelTimeMap  = "timemap"
+	RelMemento  = "memento"
+	RelFirst    = "first"
+	RelLast     = "last"
+)
+
+var ErrMalformedLink = errors.New("malformed link")
+
+// One link of link-format document or Link header.
+type Link struct {
+	URL string
+	// Relation types. One link can have more of them, for example "first memento".
+	Rel []string
+	// Other parameters, for example datetime, type, from, until. Names are lowercase.
+	Params map[string]string
+}
+
+func (link *Link) HasRel(rel string) bool {
+	return slices.Contains(link.Rel, rel)
+}
+
+// Datetime parameter of the link. Zero time if it is missing or invalid.
+func (link *Link) Datetime() time.Time {
+	datetime, err := ParseDatetime(link.Params["datetime"])
+	if err != nil {
+		return time.Time{}
+	}
+	return datetime
+}
+
+// Parse link-format document or value of Link header. Links are separated by commas.
+func ParseLinks(data string) ([]*Link, error) {
+	links := make([]*Link, 0)
+	parser := &linkParser{data: data}
+	for {
+		parser.skip(" \t\r\n,")
+		if parser.done() {
+			return links, nil
+		}
+		link, err := parser.link()
+		if err != nil {
+			return nil, fmt.Errorf("memento.ParseLinks failed at position %d: %w", parser.position, err)
+		}
+		links = append(links, link)
+	}
+}
+
+type linkParser struct {
+	data     string
+	position int
+}
+
+func (parser *linkParser) done() bool {
+	return parser.position >= len(parser.data)
+}
+
+func (parser *linkParser) skip(chars string) {
+	for !parser.done() && strings.IndexByte(chars, parser.data[parser.position]) >= 0 {
+		parser.position++
+	}
+}
+
+// Read until one of the chars or end of data.
+func (parser *linkParser) until(chars string) string {
+	start := parser.position
+	for !parser.done() && strings.IndexByte(chars, parser.data[parser.position]) < 0 {
+		parser.position++
+	}
+	return parser.data[start:parser.position]
+}
+
+func (parser *linkParser) link() (*Link, error) {
+	if parser.data[parser.position] != '<' {
+		return nil, fmt.Errorf("%w: expected '<'", ErrMalformedLink)
+	}
+	parser.position++
+	target := parser.until(">")
+	if parser.done() {
+		return nil, fmt.Errorf("%w: missing '>'", ErrMalformedLink)
+	}
+	parser.position++
+	link := &Link{URL: strings.TrimSpace(target), Params: make(map[string]string)}
+
+	for {
+		parser.skip(" \t\r\n")
+		if parser.done() || parser.data[parser.position] == ',' {
+			return link, nil
+		}
+		if parser.data[parser.position] != ';' {
+			return nil, fmt.Errorf("%w: expected ';' or ','", ErrMalformedLink)
+		}
+		parser.position++
+		parser.skip(" \t\r\n")
+		name := strings.ToLower(strings.TrimSpace(parser.until("=;,")))
+		value := ""
+		if !parser.done() && parser.data[parser.position] == '=' {
+			parser.position++
+			parser.skip(" \t\r\n")
+			var err error
+			value, err = parser.value()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if name == "rel" {
+			link.Rel = append(link.Rel, strings.Fields(strings.ToLower(value))...)
+			continue
+		}
+		// The first occurrence of parameter wins (RFC 8288).
+		if _, ok := link.Params[name]; !ok {
+			link.Params[name] = value
+		}
+	}
+}
+
+// Quoted string or token.
+func (parser *linkParser) value() (string, error) {
+	if parser.done() || parser.data[parser.position] != '"' {
+		return strings.TrimSpace(parser.until(";,")), nil
+	}
+	parser.position++
+	value := new(strings.Builder)
+	for !parser.done() {
+		char := parser.data[parser.position]
+		parser.position++
+		switch char {
+		case '\\':
+			if !parser.done() {
+				value.WriteByte(parser.data[parser.position])
+				parser.position++
+			}
+		case '"':
+			return value.String(), nil
+		default:
+			value.WriteByte(char)
+		}
+	}
+	return "", fmt.Errorf("%w: unterminated quoted string", ErrMalformedLink)
+}
+
+// Format the link as one entry of link-format document or Link header.
+// Params are written in sorted order, so the output is stable.
+func (link *Link) String() string {
+	builder := new(strings.Builder)
+	builder.WriteString("<" + link.URL + ">")
+	if len(link.Rel) > 0 {
+		builder.WriteString(`; rel="` + strings.Join(link.Rel, " ") + `"`)
+	}
+	names := make([]string, 0, len(link.Params))
+	for name := range link.Params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value := strings.ReplaceAll(strings.ReplaceAll(link.Params[name], `\`, `\\`), `"`, `\"`)
+		builder.WriteString("; " + name + `="` + value + `"`)
+	}
+	return builder.String()
+}
+
+// Format links as link-format document, one link per line.
+func FormatLinks(links []*Link) string {
+	lines := make([]string, 0, len(links))
+	for _, link := range links {
+		lines = append(lines, link.String())
+	}
+	return strings.Join(lines, ",\n") + "\n"
+}
+
+// Memento datetimes use the HTTP date format, for example "Tue, 20 Mar 2001 20:35:00 GMT".
+func FormatDatetime(datetime time.Time) string {
+	return datetime.UTC().Format(http.TimeFormat)
+}
+
+func ParseDatetime(value string) (time.Time, error) {
+	return http.ParseTime(strings.TrimSpace(value))
+}
@@ -0,0 +1,154 @@
+package pagetext
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Package pagetext extracts readable text of captured pages, so captures can be compared
+// without noise from markup, scripts and navigation.
+
+// Elements whose content is never part of the text.
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"iframe": true, "object": true, "canvas": true, "select": true, "button": true,
+}
+
+// Page parts that repeat on every page of the site. Skipped when the page has no main or article element.
+var boilerplateElements = map[string]bool{
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true,
+}
+
+// Elements that start new line of the text.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "br": true, "dd": true, "details": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "hr": true, "li": true, "main": true, "ol": true, "p": true, "pre": true,
+	"section": true, "summary": true, "table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// Main text of the page as lines with normalized whitespace, without empty lines.
+// HTML is reduced to the text of its main element (main, then article, then body). Plain text is returned as it is.
+// Returns nil for other content types, they have no text to compare.
+func Extract(contentType string, body []byte) []string {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return extractHTML(body, params["charset"])
+	case "text/plain":
+		return lines(toUTF8(body, params["charset"]))
+	}
+	return nil
+}
+
+// The lines joined back into single text, used for hashing.
+func Join(lines []string) string {
+	return strings.Join(lines, "\n")
+}
+
+func extractHTML(body []byte, declaredCharset string) []string {
+	document, err := html.Parse(strings.NewReader(toUTF8(body, declaredCharset)))
+	if err != nil {
+		// The parser is very forgiving, this should not happen.
+		return nil
+	}
+	root, hasMain := mainElement(document)
+	text := new(strings.Builder)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch node.Type {
+		case html.TextNode:
+			text.WriteString(node.Data)
+			return
+		case html.ElementNode:
+			if skippedElements[node.Data] || (!hasMain && boilerplateElements[node.Data]) {
+				return
+			}
+			if node.Data == "img" {
+				if alt := attribute(node, "alt"); alt != "" {
+					text.WriteString(" " + alt + " ")
+				}
+			}
+		}
+		block := node.Type == html.ElementNode && blockElements[node.Data]
+		if block {
+			text.WriteString("\n")
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			text.WriteString("\n")
+		}
+	}
+	walk(root)
+	return lines(text.String())
+}
+
+// The element with the main content. The bool is true if the page marks it (main or article).
+func mainElement(document *html.Node) (*html.Node, bool) {
+	var body, article *html.Node
+	for node := range document.Descendants() {
+		if node.Type != html.ElementNode {
+			continue
+		}
+		switch {
+		case node.Data == "main" || attribute(node, "role") == "main":
+			return node, true
+		case node.Data == "article" && article == nil:
+			article = node
+		case node.Data == "body" && body == nil:
+			body = node
+		}
+	}
+	if article != nil {
+		return article, true
+	}
+	if body != nil {
+		return body, false
+	}
+	return document, false
+}
+
+// Split the text into lines with whitespace collapsed to single spaces and drop the empty ones.
+func lines(text string) []string {
+	result := make([]string, 0)
+	for line := range strings.Lines(text) {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// Decode the body to UTF-8. Charset is taken from the header, then from the page itself.
+func toUTF8(body []byte, declaredCharset string) string {
+	if declaredCharset == "" && utf8.Valid(body) {
+		return string(body)
+	}
+	reader, err := charset.NewReader(bytes.NewReader(body), "text/html; charset="+declaredCharset)
+	if err != nil {
+		return strings.ToValidUTF8(string(body), "�")
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return strings.ToValidUTF8(string(body), "�")
+	}
+	return string(decoded)
+}
+
+func attribute(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package memoryq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	q "jinovatka/queue"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// In-process implementation of Queue for capture requests and responses.
+// Everything is lost when the process exits, so it is intended for tests and single binary deployments
+// where the workers run in the same process (see Worker).
+//
+// Results are removed as soon as they are returned by AwaitResult, AckResult and ReleaseResult do nothing.
+type Queue struct {
+	Log *slog.Logger
+
+	requests *list[*entities.CaptureRequest]
+	results  *list[*entities.CaptureResult]
+
+	mutex sync.Mutex
+	// Number of requests of the seed taken by Serve and not finished yet, by shadow ID.
+	processing map[string]int
+}
+
+func NewQueue(log *slog.Logger) *Queue {
+	assert.Must(log != nil, "memoryq/NewQueue: log can't be nil")
+	return &Queue{
+		Log:        log,
+		requests:   newList[*entities.CaptureRequest](),
+		results:    newList[*entities.CaptureResult](),
+		processing: make(map[string]int),
+	}
+}
+
+// Enqueue the request. This never blocks, the queue has no size limit.
+func (queue *Queue) Enqueue(ctx context.Context, request *entities.CaptureRequest) error {
+	if request == nil {
+		return errors.New("Queue.Enqueue recieved nil request")
+	}
+	if request.SeedShadowID == "" {
+		return errors.New("Queue.Enqueue recieved request with no SeedShadowID")
+	}
+	if request.SeedURL == "" {
+		return errors.New("Queue.Enqueue recieved request with no SeedURL")
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Queue.Enqueue context is done: %w", err)
+	}
+	// Store a copy, so the caller can't change the request after it was enqueued.
+	requestCopy := *request
+	queue.requests.push(&requestCopy)
+	queue.Log.Info("Enqueued request", "URL", request.SeedURL, "ID", request.SeedShadowID)
+	return nil
+}
+
+// If timeout is zero, this function blocks until CaptureResult can be dequeued or the context is done.
+// If timeout is nonzero and no CaptureResult is available, this function blocks
+// until timeout runs out and then returns QueueTimeoutError and nil CaptureResult.
+func (queue *Queue) AwaitResult(ctx context.Context, timeout time.Duration) (*entities.CaptureResult, error) {
+	result, err := queue.results.pop(ctx, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("Queue.AwaitResult: %w", err)
+	}
+	return result, nil
+}
+
+// Results are removed from the queue by AwaitResult, there is nothing to acknowledge.
+func (queue *Queue) AckResult(ctx context.Context, result *entities.CaptureResult) error {
+	return nil
+}
+
+// Results are removed from the queue by AwaitResult, released result is not delivered again.
+func (queue *Queue) ReleaseResult(ctx context.Context, result *entities.CaptureResult) error {
+	return nil
+}
+
+// Seeds with requests waiting in the queue or being captured by Serve.
+func (queue *Queue) QueuedSeeds(ctx context.Context) (map[string]bool, error) {
+	seeds := make(map[string]bool)
+	queue.requests.mutex.Lock()
+	for _, request := range queue.requests.items {
+		seeds[request.SeedShadowID] = true
+	}
+	queue.requests.mutex.Unlock()
+	queue.mutex.Lock()
+	for shadowID := range queue.processing {
+		seeds[shadowID] = true
+	}
+	queue.mutex.Unlock()
+	return seeds, nil
+}
+
+// Fetch request from queue. This is the worker side of the queue.
+// Blocks the same way as AwaitResult.
+func (queue *Queue) AwaitRequest(ctx context.Context, timeout time.Duration) (*entities.CaptureRequest, error) {
+	request, err := queue.requests.pop(ctx, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("Queue.AwaitRequest: %w", err)
+	}
+	return request, nil
+}
+
+// Enqueue result. This is the worker side of the queue. This never blocks.
+func (queue *Queue) PushResult(result *entities.CaptureResult) error {
+	if result == nil {
+		return errors.New("Queue.PushResult recieved nil result")
+	}
+	queue.results.push(result)
+	return nil
+}
+
+// Number of requests waiting in the queue.
+func (queue *Queue) PendingRequests() int {
+	return queue.requests.len()
+}
+
+// Number of results waiting in the queue.
+func (queue *Queue) PendingResults() int {
+	return queue.results.len()
+}
+
+// Unbounded FIFO list, that can be waited on.
+type list[T any] struct {
+	mutex sync.Mutex
+	items []T
+	// Has value whenever items is not empty. Capacity is one, so push never blocks.
+	ready chan struct{}
+}
+
+func newList[T any]() *list[T] {
+	return &list[T]{
+		ready: make(chan struct{}, 1),
+	}
+}
+
+func (l *list[T]) push(item T) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.items = append(l.items, item)
+	l.signal()
+}
+
+// Wait until there is an item, the context is done or the timeout runs out.
+func (l *list[T]) pop(ctx context.Context, timeout time.Duration) (T, error) {
+	var zero T
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-timer:
+			return zero, q.QueueTimeoutError
+		case <-l.ready:
+			l.mutex.Lock()
+			if len(l.items) == 0 {
+				// Somebody else was faster.
+				l.mutex.Unlock()
+				continue
+			}
+			item := l.items[0]
+			l.items[0] = zero
+			l.items = l.items[1:]
+			// Wake up another waiter if there is more work.
+			if len(l.items) > 0 {
+				l.signal()
+			}
+			l.mutex.Unlock()
+			return item, nil
+		}
+	}
+}
+
+func (l *list[T]) len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.items)
+}
+
+// Must be called with mutex held.
+func (l *list[T]) signal() {
+	select {
+	case l.ready <- struct{}{}:
+	default:
+	}
+}
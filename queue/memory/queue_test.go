@@ -0,0 +1,102 @@
+package memoryq
+
+import (
+	"context"
+	"errors"
+	"jinovatka/entities"
+	q "jinovatka/queue"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestQueue() *Queue {
+	return NewQueue(slog.New(slog.DiscardHandler))
+}
+
+func TestAwaitResultTimeout(t *testing.T) {
+	queue := newTestQueue()
+	start := time.Now()
+	result, err := queue.AwaitResult(context.Background(), 20*time.Millisecond)
+	if !errors.Is(err, q.QueueTimeoutError) {
+		t.Fatalf("AwaitResult returned %v, expected QueueTimeoutError", err)
+	}
+	if result != nil {
+		t.Errorf("AwaitResult returned result %+v with timeout", result)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("AwaitResult returned after %s, before the timeout", waited)
+	}
+}
+
+func TestAwaitResultCancel(t *testing.T) {
+	queue := newTestQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		const noTimeout = 0
+		_, err := queue.AwaitResult(ctx, noTimeout)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("AwaitResult returned %v, expected context.Canceled", err)
+		}
+		if errors.Is(err, q.QueueTimeoutError) {
+			t.Errorf("AwaitResult returned QueueTimeoutError after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AwaitResult did not return after the context was cancelled")
+	}
+}
+
+func TestServe(t *testing.T) {
+	queue := newTestQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	capturedAt := time.Date(2024, 5, 17, 12, 30, 45, 0, time.UTC)
+	queue.Serve(ctx, func(ctx context.Context, request *entities.CaptureRequest) *entities.CaptureResult {
+		if request.SeedShadowID == "lost" {
+			return nil
+		}
+		return SuccessResult(request, capturedAt)
+	})
+
+	for _, shadowID := range []string{"lost", "seed"} {
+		err := queue.Enqueue(ctx, &entities.CaptureRequest{SeedShadowID: shadowID, SeedURL: "https://example.com/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := queue.AwaitResult(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("AwaitResult returned %v", err)
+	}
+	if result.SeedShadowID != "seed" || !result.Done || len(result.ErrorMessages) != 0 {
+		t.Errorf("AwaitResult returned %+v, expected successful result of seed", result)
+	}
+	if result.CaptureMetadata.Timestamp != "20240517123045" || result.CaptureMetadata.CapturedUrl != "https://example.com/" {
+		t.Errorf("AwaitResult returned metadata %+v", result.CaptureMetadata)
+	}
+	if pending := queue.PendingResults(); pending != 0 {
+		t.Errorf("PendingResults = %d after the only result was taken", pending)
+	}
+}
+
+func TestEnqueueInvalid(t *testing.T) {
+	queue := newTestQueue()
+	for _, request := range []*entities.CaptureRequest{
+		nil,
+		{SeedURL: "https://example.com/"},
+		{SeedShadowID: "seed"},
+	} {
+		if err := queue.Enqueue(context.Background(), request); err == nil {
+			t.Errorf("Enqueue(%+v) accepted invalid request", request)
+		}
+	}
+	if pending := queue.PendingRequests(); pending != 0 {
+		t.Errorf("PendingRequests = %d after only invalid requests", pending)
+	}
+}
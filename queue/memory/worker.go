@@ -0,0 +1,84 @@
+package memoryq
+
+import (
+	"context"
+	"errors"
+	"jinovatka/cdxj"
+	"jinovatka/entities"
+	q "jinovatka/queue"
+	"time"
+)
+
+// Function that handles single CaptureRequest and returns its result.
+// Returning nil means that the request was lost and no result will be pushed.
+type CaptureFunc func(ctx context.Context, request *entities.CaptureRequest) *entities.CaptureResult
+
+// Starts a new goroutine that plays the worker side of the queue.
+// It takes requests from the queue, passes them to capture and pushes the returned results, until the context is done.
+//
+// In tests this can be used together with SuccessResult or FailureResult to simulate capture without running real workers.
+func (queue *Queue) Serve(ctx context.Context, capture CaptureFunc) {
+	go func() {
+		for ctx.Err() == nil {
+			const noTimeout = 0
+			request, err := queue.AwaitRequest(ctx, noTimeout)
+			if errors.Is(err, q.QueueTimeoutError) {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			queue.startProcessing(request)
+			result := capture(ctx, request)
+			queue.finishProcessing(request)
+			if result == nil {
+				queue.Log.Info("memoryq.Queue.Serve dropped request", "ID", request.SeedShadowID)
+				continue
+			}
+			// PushResult only fails on nil result.
+			_ = queue.PushResult(result)
+		}
+	}()
+}
+
+func (queue *Queue) startProcessing(request *entities.CaptureRequest) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.processing[request.SeedShadowID]++
+}
+
+func (queue *Queue) finishProcessing(request *entities.CaptureRequest) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.processing[request.SeedShadowID]--
+	if queue.processing[request.SeedShadowID] <= 0 {
+		delete(queue.processing, request.SeedShadowID)
+	}
+}
+
+// Create result of successful capture of the request taken at the given time.
+func SuccessResult(request *entities.CaptureRequest, capturedAt time.Time) *entities.CaptureResult {
+	return &entities.CaptureResult{
+		SeedShadowID:  request.SeedShadowID,
+		Done:          true,
+		ErrorMessages: []string{},
+		CaptureMetadata: &entities.CaptureMetadata{
+			// CDXJ timestamp with second precision.
+			Timestamp:   cdxj.FormatTimestamp(capturedAt),
+			CapturedUrl: request.SeedURL,
+		},
+	}
+}
+
+// Create result of failed capture of the request.
+// Result without error messages would count as success, so a generic message is used if none are given.
+func FailureResult(request *entities.CaptureRequest, errorMessages ...string) *entities.CaptureResult {
+	if len(errorMessages) == 0 {
+		errorMessages = []string{"capture failed"}
+	}
+	return &entities.CaptureResult{
+		SeedShadowID:  request.SeedShadowID,
+		Done:          true,
+		ErrorMessages: errorMessages,
+	}
+}
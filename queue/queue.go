@@ -13,6 +13,10 @@ import (
 // Always store the request data to persistent db before enquing them.
 // This way it should be possible to repeat the request.
 //
+// Implementations may offer at-least-once delivery of results. In that case every result must be acknowledged
+// with AckResult after it was handled. Results that are not acknowledged in time will be delivered again,
+// so handling of the results must be idempotent.
+//
 // This is the producer side of the queue. We are enquing requests and recieving responses.
 // The consumer side will be implemented by capture software running as separate process. Possibly on separete server.
 
@@ -24,8 +28,25 @@ type Queue interface {
 	// If there are no reusts waiting in the queue then this method should block until result is recieved.
 	// If timeout is zero, no timeout will be used.
 	AwaitResult(ctx context.Context, timeout time.Duration) (*entities.CaptureResult, error)
+	// Acknowledge that the result returned by AwaitResult was handled and can be removed from the queue.
+	// Implementations without acknowledgement should do nothing and return nil.
+	AckResult(context.Context, *entities.CaptureResult) error
+	// Give up the result returned by AwaitResult, because it could not be handled now. It is not acknowledged,
+	// so implementations with acknowledgement deliver it again later. Others should do nothing and return nil.
+	ReleaseResult(context.Context, *entities.CaptureResult) error
+	// Shadow IDs of the seeds whose requests are still in the queue, waiting or taken by a worker.
+	// Such requests are not lost, the queue delivers them (again) by itself.
+	QueuedSeeds(context.Context) (map[string]bool, error)
 }
 
 // Use to cath potential timeouts that are not supposed to propagate.
 // Only methods with timeout can return this error.
 var QueueTimeoutError = errors.New("operation timed out")
+
+// Returned by AwaitResult when the result in the queue can't be decoded. The result was dropped,
+// waiting for the next one is fine.
+var ErrMalformedResult = errors.New("malformed result")
+
+// Returned by AckResult when the result is not known to the queue.
+// For example when it was already acknowledged, or it was not returned by AwaitResult.
+var ErrUnknownResult = errors.New("result is not awaiting acknowledgement")
@@ -1,31 +1,49 @@
 package valkeyq
 
 import (
-	"os"
+	"crypto/tls"
+	"jinovatka/config"
+	"net"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
 )
 
 type ValkeyOptions struct {
-	Addr string
-	Port string
+	Addr     string
+	Port     string
+	Username string
+	Password string
+	// Index of the logical database.
+	DB  int
+	TLS bool
+	// How long can recieved result stay unacknowledged. Zero disables acknowledgement.
+	VisibilityTimeout time.Duration
 }
 
-const (
-	defaultValkeyAddr = "localhost"
-	defaultValkeyPort = "6379"
-)
-
-// Create ValkeyOptions from enviroment
-func NewValkeyOptionsFromEnv() *ValkeyOptions {
-	valkeyAddr, ok := os.LookupEnv("VALKEY_ADDR")
-	if !ok {
-		valkeyAddr = defaultValkeyAddr
+// Create ValkeyOptions from configuration
+func NewValkeyOptions(valkeyConfig *config.ValkeyConfig) *ValkeyOptions {
+	return &ValkeyOptions{
+		Addr:              valkeyConfig.Addr,
+		Port:              valkeyConfig.Port,
+		Username:          valkeyConfig.Username,
+		Password:          valkeyConfig.Password,
+		DB:                valkeyConfig.DB,
+		TLS:               valkeyConfig.TLS,
+		VisibilityTimeout: valkeyConfig.VisibilityTimeout.Duration,
 	}
-	valkeyPort, ok := os.LookupEnv("VALKEY_PORT")
-	if !ok {
-		valkeyPort = defaultValkeyPort
+}
+
+// Options for valkey.NewClient.
+func (options *ValkeyOptions) ClientOption() valkey.ClientOption {
+	clientOption := valkey.ClientOption{
+		InitAddress: []string{net.JoinHostPort(options.Addr, options.Port)},
+		Username:    options.Username,
+		Password:    options.Password,
+		SelectDB:    options.DB,
 	}
-	return &ValkeyOptions{
-		Addr: valkeyAddr,
-		Port: valkeyPort,
+	if options.TLS {
+		clientOption.TLSConfig = &tls.Config{ServerName: options.Addr, MinVersion: tls.VersionTLS12}
 	}
+	return clientOption
 }
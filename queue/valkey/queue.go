@@ -2,6 +2,7 @@ package valkeyq
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,31 +10,65 @@ import (
 	"jinovatka/entities"
 	q "jinovatka/queue"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/valkey-io/valkey-go"
 )
 
 // Valkey (fork of Redis) implementation of Queue for capture requests and responses
+//
+// If VisibilityTimeout is zero, the results are removed from Valkey as soon as they are popped (at-most-once delivery).
+// Otherwise the popped results are moved to processing list and stay there until they are acknowledged.
+// Results that are not acknowledged before VisibilityTimeout runs out are moved back to the result list (at-least-once delivery).
+//
+// Requests taken by workers are enqueued again when their deadline set by the worker passes, whatever VisibilityTimeout is.
 type Queue struct {
 	Log    *slog.Logger
 	Client valkey.Client
+
+	// How long can popped result wait for acknowledgement before it is delivered again.
+	// Zero disables acknowledgement.
+	VisibilityTimeout time.Duration
+
+	// Guards unacked and lastRedelivery.
+	mutex sync.Mutex
+	// Raw data of results that were popped, but not acknowledged yet.
+	unacked map[*entities.CaptureResult]string
+	// The last time we checked for expired messages.
+	lastRedelivery time.Time
 }
 
-func NewQueue(log *slog.Logger, client valkey.Client) *Queue {
+func NewQueue(log *slog.Logger, client valkey.Client, visibilityTimeout time.Duration) *Queue {
 	assert.Must(log != nil, "valkeyq/NewQueue: log can't be nil")
 	assert.Must(client != nil, "valkeyq/NewQueue: client can't be nil")
+	assert.Must(visibilityTimeout >= 0, "valkeyq/NewQueue: visibilityTimeout can't be negative")
 	return &Queue{
-		Log:    log,
-		Client: client,
+		Log:               log,
+		Client:            client,
+		VisibilityTimeout: visibilityTimeout,
+		unacked:           make(map[*entities.CaptureResult]string),
 	}
 }
 
 const (
 	RequestListKey = "queue:requests"
 	ResultListKey  = "queue:results"
+
+	// Requests taken by workers, that were not finished yet.
+	RequestProcessingKey = "queue:requests:processing"
+	// Sorted set of requests in RequestProcessingKey scored by unix time of their deadline.
+	RequestDeadlinesKey = "queue:requests:deadlines"
+	// Results taken by us, that were not acknowledged yet.
+	ResultProcessingKey = "queue:results:processing"
+	// Sorted set of results in ResultProcessingKey scored by unix time of their deadline.
+	ResultDeadlinesKey = "queue:results:deadlines"
 )
 
+// Deadline of taken requests the worker didn't set one for (it crashed right after taking the request).
+// The same as the default visibility timeout of the workers.
+const requestTimeout = 10 * time.Minute
+
 func (queue *Queue) Enqueue(ctx context.Context, request *entities.CaptureRequest) error {
 	if request == nil {
 		return errors.New("Queue.Enqueue recieved nil request")
@@ -44,8 +79,11 @@ func (queue *Queue) Enqueue(ctx context.Context, request *entities.CaptureReques
 	if request.SeedURL == "" {
 		return errors.New("Queue.Enqueue recieved request with no SeedURL")
 	}
+	// Copy, so the callers request is not changed.
+	delivery := *request
+	delivery.DeliveryID = rand.Text()
 	// TODO: Maybe create model struct for this?
-	requestData, err := json.Marshal(request)
+	requestData, err := json.Marshal(&delivery)
 	if err != nil {
 		return fmt.Errorf("Queue.Enqueue failed to marshal request to json: %w", err)
 	}
@@ -62,21 +100,93 @@ func (queue *Queue) Enqueue(ctx context.Context, request *entities.CaptureReques
 // If timeout is zero, this function blocks until CaptureResult can be dequeued.
 // If timeout is nonzero and no CaptureResult is available, this function blocks
 // until timeout runs out and then returns QueueTimeoutError and nil CaptureResult.
+//
+// If VisibilityTimeout is set, the returned result must be acknowledged using AckResult.
 func (queue *Queue) AwaitResult(ctx context.Context, timeout time.Duration) (*entities.CaptureResult, error) {
+	// Give the lost requests and results a chance to be delivered again before we block.
+	queue.redeliverIfDue(ctx)
+	if queue.VisibilityTimeout == 0 {
+		return queue.popResult(ctx, timeout)
+	}
+	return queue.moveResult(ctx, timeout)
+}
+
+// Remove the result from processing list. If VisibilityTimeout is zero, this does nothing.
+func (queue *Queue) AckResult(ctx context.Context, result *entities.CaptureResult) error {
+	if queue.VisibilityTimeout == 0 {
+		return nil
+	}
+	queue.mutex.Lock()
+	rawResult, ok := queue.unacked[result]
+	delete(queue.unacked, result)
+	queue.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("Queue.AckResult: %w", q.ErrUnknownResult)
+	}
+	err := queue.remove(ctx, ResultProcessingKey, ResultDeadlinesKey, rawResult)
+	if err != nil {
+		return fmt.Errorf("Queue.AckResult failed to remove result: %w", err)
+	}
+	return nil
+}
+
+// Forget the result without acknowledging it. It stays in the processing list and is delivered again
+// after its deadline. If VisibilityTimeout is zero, this does nothing.
+func (queue *Queue) ReleaseResult(ctx context.Context, result *entities.CaptureResult) error {
+	if queue.VisibilityTimeout == 0 {
+		return nil
+	}
+	queue.mutex.Lock()
+	_, ok := queue.unacked[result]
+	delete(queue.unacked, result)
+	queue.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("Queue.ReleaseResult: %w", q.ErrUnknownResult)
+	}
+	return nil
+}
+
+// Seeds with requests in the request list, in the processing list or in the deadlines of requests.
+// Requests there are delivered again by redelivery, so they are not lost.
+func (queue *Queue) QueuedSeeds(ctx context.Context) (map[string]bool, error) {
+	client := queue.Client
+	commands := valkey.Commands{
+		client.B().Lrange().Key(RequestListKey).Start(0).Stop(-1).Build(),
+		client.B().Lrange().Key(RequestProcessingKey).Start(0).Stop(-1).Build(),
+		client.B().Zrange().Key(RequestDeadlinesKey).Min("0").Max("-1").Build(),
+	}
+	seeds := make(map[string]bool)
+	for _, response := range client.DoMulti(ctx, commands...) {
+		messages, err := response.AsStrSlice()
+		if err != nil {
+			return nil, fmt.Errorf("Queue.QueuedSeeds valkey client returned error: %w", err)
+		}
+		for _, message := range messages {
+			request := new(entities.CaptureRequest)
+			if json.Unmarshal([]byte(message), request) != nil {
+				continue // Malformed requests are dropped by the workers.
+			}
+			seeds[request.SeedShadowID] = true
+		}
+	}
+	return seeds, nil
+}
+
+// Pop result using BLPOP. The result is removed from Valkey immediately.
+func (queue *Queue) popResult(ctx context.Context, timeout time.Duration) (*entities.CaptureResult, error) {
 	// This call blocks. BLPOP returns array: [Key, Value]
 	valkeyResult := queue.Client.Do(ctx, queue.Client.B().Blpop().Key(ResultListKey).Timeout(timeout.Seconds()).Build())
 
 	// We need to get the message and handle errors returned by client.
+	// If the call timed out then the message will be null.
 	valkeyMessage, err := valkeyResult.ToMessage()
+	if valkey.IsValkeyNil(err) || (err == nil && valkeyMessage.IsNil()) {
+		return nil, fmt.Errorf("%w: BLPOP in Queue.AwaitResult", q.QueueTimeoutError)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Queue.AwaitResult valkey client returned error: %w", err)
 	}
 
-	// If the call timed out then the message will be null.
-	if valkeyMessage.IsNil() {
-		return nil, fmt.Errorf("%w: BLPOP in Queue.AwaitResult", q.QueueTimeoutError)
-	}
-
 	// Call .ToArray to unwrap the the actual messages.
 	valkeyMessageArray, err := valkeyMessage.ToArray()
 	if err != nil { // This error is likely to be error from Client.Do, but may also be parsig error from .ToArray
@@ -95,9 +205,168 @@ func (queue *Queue) AwaitResult(ctx context.Context, timeout time.Duration) (*en
 	result := new(entities.CaptureResult)
 	err = valueMessage.DecodeJSON(result)
 	if err != nil {
-		return nil, fmt.Errorf("Queue.AwaitResult failed to unmarshal result from json: %w", err)
+		// The result was already removed from Valkey.
+		return nil, fmt.Errorf("Queue.AwaitResult failed to unmarshal result from json: %w: %w", q.ErrMalformedResult, err)
 	}
 
 	// Now I think I deserve a coffee.
 	return result, nil
 }
+
+// Move result to processing list using BLMOVE. The result stays in Valkey until it is acknowledged.
+func (queue *Queue) moveResult(ctx context.Context, timeout time.Duration) (*entities.CaptureResult, error) {
+	// This call blocks. BLMOVE returns the moved value.
+	command := queue.Client.B().Blmove().Source(ResultListKey).Destination(ResultProcessingKey).Left().Right().Timeout(timeout.Seconds()).Build()
+	rawResult, err := queue.Client.Do(ctx, command).ToString()
+	if valkey.IsValkeyNil(err) {
+		return nil, fmt.Errorf("%w: BLMOVE in Queue.AwaitResult", q.QueueTimeoutError)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Queue.AwaitResult valkey client returned error: %w", err)
+	}
+
+	// Start the visibility timeout. If we crash before this, the result will get its deadline during redelivery.
+	err = queue.setDeadline(ctx, ResultDeadlinesKey, rawResult, queue.VisibilityTimeout)
+	if err != nil {
+		queue.Log.Warn("Queue.AwaitResult failed to set deadline of result", "error", err.Error())
+	}
+
+	result := new(entities.CaptureResult)
+	err = json.Unmarshal([]byte(rawResult), result)
+	if err != nil {
+		// This result can never be handled. Drop it, so it doesn't get redelivered forever.
+		removeErr := queue.remove(ctx, ResultProcessingKey, ResultDeadlinesKey, rawResult)
+		if removeErr != nil {
+			queue.Log.Warn("Queue.AwaitResult failed to remove malformed result", "error", removeErr.Error())
+		}
+		return nil, fmt.Errorf("Queue.AwaitResult failed to unmarshal result from json: %w: %w", q.ErrMalformedResult, err)
+	}
+
+	queue.mutex.Lock()
+	queue.unacked[result] = rawResult
+	queue.mutex.Unlock()
+	return result, nil
+}
+
+// Redeliver expired requests and results (only with VisibilityTimeout), but only if we didn't do so recently.
+// Errors are only logged, redelivery will be tried again next time.
+func (queue *Queue) redeliverIfDue(ctx context.Context) {
+	interval := requestTimeout / 4
+	if queue.VisibilityTimeout > 0 {
+		interval = min(interval, queue.VisibilityTimeout/4)
+	}
+	queue.mutex.Lock()
+	due := time.Since(queue.lastRedelivery) >= interval
+	if due {
+		queue.lastRedelivery = time.Now()
+	}
+	queue.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	err := queue.redeliver(ctx, RequestListKey, RequestProcessingKey, RequestDeadlinesKey, requestTimeout)
+	if err != nil {
+		queue.Log.Warn("Queue failed to redeliver expired requests", "error", err.Error())
+	}
+	if queue.VisibilityTimeout == 0 {
+		return
+	}
+	err = queue.redeliver(ctx, ResultListKey, ResultProcessingKey, ResultDeadlinesKey, queue.VisibilityTimeout)
+	if err != nil {
+		queue.Log.Warn("Queue failed to redeliver expired results", "error", err.Error())
+	}
+}
+
+// Move messages with expired deadline from processingKey back to the front of listKey.
+// Messages in processingKey without any deadline get one in timeout, so they can't get stuck there forever.
+func (queue *Queue) redeliver(ctx context.Context, listKey, processingKey, deadlinesKey string, timeout time.Duration) error {
+	client := queue.Client
+
+	processing, err := client.Do(ctx, client.B().Lrange().Key(processingKey).Start(0).Stop(-1).Build()).AsStrSlice()
+	if err != nil {
+		return fmt.Errorf("LRANGE %s failed: %w", processingKey, err)
+	}
+	if len(processing) > 0 {
+		scores, err := client.Do(ctx, client.B().Zmscore().Key(deadlinesKey).Member(processing...).Build()).ToArray()
+		if err != nil {
+			return fmt.Errorf("ZMSCORE %s failed: %w", deadlinesKey, err)
+		}
+		for i, score := range scores {
+			if score.IsNil() {
+				err = queue.setDeadline(ctx, deadlinesKey, processing[i], timeout)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	now := fmt.Sprintf("%d", time.Now().Unix())
+	expired, err := client.Do(ctx, client.B().Zrangebyscore().Key(deadlinesKey).Min("-inf").Max(now).Build()).AsStrSlice()
+	if err != nil {
+		return fmt.Errorf("ZRANGEBYSCORE %s failed: %w", deadlinesKey, err)
+	}
+	for _, message := range expired {
+		removed, err := redeliverScript.Exec(ctx, client, []string{listKey, processingKey, deadlinesKey}, []string{message}).AsInt64()
+		if err != nil {
+			return fmt.Errorf("redelivery script on %s failed: %w", processingKey, err)
+		}
+		if removed > 0 {
+			queue.Log.Info("Queue redelivered expired message", "key", listKey)
+		}
+		if listKey == ResultListKey {
+			queue.forget(message)
+		}
+	}
+	return nil
+}
+
+// Move one expired message (ARGV[1]) from the processing list (KEYS[2]) back to the front of the list (KEYS[1])
+// and drop its deadline (KEYS[3]). Returns the number of removed messages.
+// Lua scripts run atomically, so the message can't be lost between the commands. Only the one who removes
+// the message from the processing list pushes it back, that prevents duplicates when more instances redeliver at the same time.
+var redeliverScript = valkey.NewLuaScript(`
+local removed = redis.call('LREM', KEYS[2], 1, ARGV[1])
+if removed > 0 then
+	redis.call('LPUSH', KEYS[1], ARGV[1])
+end
+redis.call('ZREM', KEYS[3], ARGV[1])
+return removed
+`)
+
+// Set deadline of the message to now + timeout. Existing deadline is kept.
+func (queue *Queue) setDeadline(ctx context.Context, deadlinesKey, message string, timeout time.Duration) error {
+	deadline := float64(time.Now().Add(timeout).Unix())
+	command := queue.Client.B().Zadd().Key(deadlinesKey).Nx().ScoreMember().ScoreMember(deadline, message).Build()
+	err := queue.Client.Do(ctx, command).Error()
+	if err != nil {
+		return fmt.Errorf("ZADD %s failed: %w", deadlinesKey, err)
+	}
+	return nil
+}
+
+// Remove message from processing list and its deadline.
+func (queue *Queue) remove(ctx context.Context, processingKey, deadlinesKey, message string) error {
+	client := queue.Client
+	err := client.Do(ctx, client.B().Lrem().Key(processingKey).Count(1).Element(message).Build()).Error()
+	if err != nil {
+		return fmt.Errorf("LREM %s failed: %w", processingKey, err)
+	}
+	err = client.Do(ctx, client.B().Zrem().Key(deadlinesKey).Member(message).Build()).Error()
+	if err != nil {
+		return fmt.Errorf("ZREM %s failed: %w", deadlinesKey, err)
+	}
+	return nil
+}
+
+// Forget redelivered results, they can't be acknowledged anymore.
+func (queue *Queue) forget(rawResult string) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	for result, raw := range queue.unacked {
+		if raw == rawResult {
+			delete(queue.unacked, result)
+		}
+	}
+}
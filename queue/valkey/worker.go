@@ -0,0 +1,131 @@
+package valkeyq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	q "jinovatka/queue"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Consumer side of the Valkey queue used by workers written in Go.
+// It speaks the same protocol as workers/scoop-worker/main.js.
+//
+// Requests are moved to RequestProcessingKey when taken and must be acknowledged with AckRequest
+// after their result was pushed. Unacknowledged requests are enqueued again by the server (see Queue).
+type WorkerQueue struct {
+	Log    *slog.Logger
+	Client valkey.Client
+
+	// How long can the request be processed before it is delivered again.
+	VisibilityTimeout time.Duration
+
+	mutex sync.Mutex
+	// Raw data of requests that were taken, but not acknowledged yet.
+	unacked map[*entities.CaptureRequest]string
+}
+
+func NewWorkerQueue(log *slog.Logger, client valkey.Client, visibilityTimeout time.Duration) *WorkerQueue {
+	assert.Must(log != nil, "valkeyq/NewWorkerQueue: log can't be nil")
+	assert.Must(client != nil, "valkeyq/NewWorkerQueue: client can't be nil")
+	assert.Must(visibilityTimeout > 0, "valkeyq/NewWorkerQueue: visibilityTimeout must be positive")
+	return &WorkerQueue{
+		Log:               log,
+		Client:            client,
+		VisibilityTimeout: visibilityTimeout,
+		unacked:           make(map[*entities.CaptureRequest]string),
+	}
+}
+
+// WARNING: This function blocks indefinitely and should be run in separate goroutine.
+//
+// If timeout is zero, this function blocks until CaptureRequest can be dequeued.
+// If timeout is nonzero and no CaptureRequest is available, this function blocks
+// until timeout runs out and then returns QueueTimeoutError and nil CaptureRequest.
+func (queue *WorkerQueue) AwaitRequest(ctx context.Context, timeout time.Duration) (*entities.CaptureRequest, error) {
+	client := queue.Client
+	command := client.B().Blmove().Source(RequestListKey).Destination(RequestProcessingKey).Left().Right().Timeout(timeout.Seconds()).Build()
+	rawRequest, err := client.Do(ctx, command).ToString()
+	if valkey.IsValkeyNil(err) {
+		return nil, fmt.Errorf("%w: BLMOVE in WorkerQueue.AwaitRequest", q.QueueTimeoutError)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("WorkerQueue.AwaitRequest valkey client returned error: %w", err)
+	}
+
+	deadline := float64(time.Now().Add(queue.VisibilityTimeout).Unix())
+	err = client.Do(ctx, client.B().Zadd().Key(RequestDeadlinesKey).Nx().ScoreMember().ScoreMember(deadline, rawRequest).Build()).Error()
+	if err != nil {
+		// The server will set the deadline during redelivery.
+		queue.Log.Warn("WorkerQueue.AwaitRequest failed to set deadline of request", "error", err.Error())
+	}
+
+	request := new(entities.CaptureRequest)
+	err = json.Unmarshal([]byte(rawRequest), request)
+	if err != nil {
+		// It would only be delivered again.
+		removeErr := queue.remove(ctx, rawRequest)
+		return nil, errors.Join(fmt.Errorf("WorkerQueue.AwaitRequest failed to unmarshal request from json: %w", err), removeErr)
+	}
+
+	queue.mutex.Lock()
+	queue.unacked[request] = rawRequest
+	queue.mutex.Unlock()
+	return request, nil
+}
+
+// Enqueue the result for the server.
+func (queue *WorkerQueue) PushResult(ctx context.Context, result *entities.CaptureResult) error {
+	if result == nil {
+		return errors.New("WorkerQueue.PushResult recieved nil result")
+	}
+	// Copy, so the callers result is not changed.
+	delivery := *result
+	delivery.DeliveryID = rand.Text()
+	resultData, err := json.Marshal(&delivery)
+	if err != nil {
+		return fmt.Errorf("WorkerQueue.PushResult failed to marshal result to json: %w", err)
+	}
+	err = queue.Client.Do(ctx, queue.Client.B().Rpush().Key(ResultListKey).Element(string(resultData)).Build()).Error()
+	if err != nil {
+		return fmt.Errorf("WorkerQueue.PushResult valkey client returned error: %w", err)
+	}
+	return nil
+}
+
+// Remove the request from processing list. Call this only after the result was pushed.
+func (queue *WorkerQueue) AckRequest(ctx context.Context, request *entities.CaptureRequest) error {
+	queue.mutex.Lock()
+	rawRequest, ok := queue.unacked[request]
+	delete(queue.unacked, request)
+	queue.mutex.Unlock()
+	if !ok {
+		return errors.New("WorkerQueue.AckRequest recieved request that is not awaiting acknowledgement")
+	}
+	err := queue.remove(ctx, rawRequest)
+	if err != nil {
+		return fmt.Errorf("WorkerQueue.AckRequest failed to remove request: %w", err)
+	}
+	return nil
+}
+
+func (queue *WorkerQueue) remove(ctx context.Context, rawRequest string) error {
+	client := queue.Client
+	err := client.Do(ctx, client.B().Lrem().Key(RequestProcessingKey).Count(1).Element(rawRequest).Build()).Error()
+	if err != nil {
+		return fmt.Errorf("LREM %s failed: %w", RequestProcessingKey, err)
+	}
+	err = client.Do(ctx, client.B().Zrem().Key(RequestDeadlinesKey).Member(rawRequest).Build()).Error()
+	if err != nil {
+		return fmt.Errorf("ZREM %s failed: %w", RequestDeadlinesKey, err)
+	}
+	return nil
+}
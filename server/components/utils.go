@@ -2,6 +2,11 @@ package components
 
 import (
 	"jinovatka/entities"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/a-h/templ"
 )
 
 func prettyPrintCaptureState(state entities.CaptureState) string {
@@ -17,3 +22,29 @@ func prettyPrintCaptureState(state entities.CaptureState) string {
 	}
 	return "Neznámý stav"
 }
+
+// Format time for users. Zero time is printed as "-".
+func prettyPrintTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2. 1. 2006 15:04:05")
+}
+
+// Value for users. Empty value is printed as "-".
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Create link to another page of the same listing. All other query values are kept.
+func pageURL(query url.Values, page int) templ.SafeURL {
+	values := url.Values{}
+	for key, value := range query {
+		values[key] = value
+	}
+	values.Set("page", strconv.Itoa(page))
+	return templ.SafeURL("?" + values.Encode())
+}
@@ -2,10 +2,10 @@ package components
 
 import "github.com/a-h/templ"
 
-func IndexView() templ.Component {
+func IndexView(data *IndexViewData) templ.Component {
 	return Assemble(&PageComponents{
 		Header: indexHeader(),
-		Main:   indexView(),
+		Main:   indexView(data),
 	})
 }
 
@@ -45,3 +45,27 @@ func GeneratorView() templ.Component {
 		Main:   generatorView(),
 	})
 }
+
+func ReplayView(data *ReplayViewData) templ.Component {
+	return Assemble(&PageComponents{
+		Title:  data.Title,
+		Header: seedHeader(data.Seed.URL),
+		Main:   replayView(data),
+	})
+}
+
+func DiffView(data *DiffViewData) templ.Component {
+	return Assemble(&PageComponents{
+		Title:  data.Title,
+		Header: seedHeader(data.Seed.URL),
+		Main:   diffView(data),
+	})
+}
+
+func PolicyView(data *PolicyViewData) templ.Component {
+	return Assemble(&PageComponents{
+		Title:  "Pravidla pro přijímání adres",
+		Header: header("Pravidla pro přijímání adres"),
+		Main:   policyView(data),
+	})
+}
@@ -1,6 +1,18 @@
 package server
 
-import "embed"
+import (
+	"embed"
+	"io/fs"
+)
 
 //go:embed static
 var staticFiles embed.FS
+
+// Vendored ReplayWeb.page files, see static/replaywebpage/fetch.sh. Passed to services.NewServices.
+func ReplayViewerFiles() fs.FS {
+	viewer, err := fs.Sub(staticFiles, "static/replaywebpage")
+	if err != nil {
+		return nil
+	}
+	return viewer
+}
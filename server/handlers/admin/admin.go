@@ -1,39 +1,137 @@
 package admin
 
 import (
+	"errors"
 	"jinovatka/assert"
+	"jinovatka/entities"
 	"jinovatka/server/components"
+	"jinovatka/server/handlers/httperror"
 	"jinovatka/services"
 	"jinovatka/utils"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
 type AdminHandler struct {
-	Log         *slog.Logger
-	SeedService *services.SeedService
+	Log          *slog.Logger
+	SeedService  *services.SeedService
+	ErrorHandler *httperror.ErrorHandler
+
+	PolicyHandler *PolicyHandler
 }
 
-func NewAdminHandler(log *slog.Logger) *AdminHandler {
+func NewAdminHandler(log *slog.Logger, seedService *services.SeedService, policyService *services.PolicyService, errorHandler *httperror.ErrorHandler) *AdminHandler {
 	assert.Must(log != nil, "NewAdminHanlder: log can't be nil")
+	assert.Must(seedService != nil, "NewAdminHandler: seedService can't be nil")
+	assert.Must(policyService != nil, "NewAdminHandler: policyService can't be nil")
+	assert.Must(errorHandler != nil, "NewAdminHandler: errorHandler can't be nil")
 	return &AdminHandler{
-		Log: log,
+		Log:           log,
+		SeedService:   seedService,
+		ErrorHandler:  errorHandler,
+		PolicyHandler: NewPolicyHandler(log, policyService, errorHandler),
 	}
 }
 
+// Names of the search form fields.
+const (
+	urlKey    = "url"
+	matchKey  = "match"
+	fromKey   = "from"
+	toKey     = "to"
+	stateKey  = "state"
+	publicKey = "public"
+	groupKey  = "group"
+	fixityKey = "fixity"
+	pageKey   = "page"
+)
+
+// Format of the date inputs.
+const dateFormat = "2006-01-02"
+
 func (handler *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	records, err := handler.SeedService.FindSeeds(&services.FindSeedsArgs{})
+	query := r.URL.Query()
+	arguments, err := parseFindSeedsArgs(query)
+	if err != nil {
+		handler.Log.Warn("AdminHandler.ServeHTTP recieved invalid search form", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusBadRequest, "Neplatný dotaz", "Vyhledávací formulář obsahuje neplatné hodnoty. Zkontrolujte zadaná data a zkuste to znovu.")
+		return
+	}
+	seeds, count, err := handler.SeedService.FindSeeds(arguments)
+	if err != nil {
+		handler.Log.Error("AdminHandler.ServeHTTP FindSeeds failed", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	noPages := utils.CountPages(count, utils.DefaultLinesPerPage)
+	pagination := utils.NewPagination(arguments.Page, noPages, utils.DefaultLinesPerPage)
+	data := components.NewAdminViewData(seeds, count, pagination, query)
+	err = handler.View(w, r, data)
 	if err != nil {
-		handler.Log.Error("FindSeeds failed", slog.String("error", err.Error()))
+		handler.Log.Error("AdminHandler.ServeHTTP failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
+		return
 	}
-	handler.View(w, r, components.NewAdminViewData(records, 0, 0)) // TODO: handle error
 	handler.Log.Info("AdminHandler responded", utils.LogRequestInfo(r))
 }
 
+// Parse search form values. Empty values are ignored.
+func parseFindSeedsArgs(query url.Values) (*services.FindSeedsArgs, error) {
+	get := query.Get
+	arguments := &services.FindSeedsArgs{
+		URL:           get(urlKey),
+		URLPrefix:     get(matchKey) == "prefix",
+		SamePage:      get(matchKey) == "page",
+		GroupShadowID: get(groupKey),
+		FixityProblem: get(fixityKey) == "problem",
+		Page:          1,
+		LinesPerPage:  utils.DefaultLinesPerPage,
+	}
+	if from := get(fromKey); from != "" {
+		date, err := time.Parse(dateFormat, from)
+		if err != nil {
+			return nil, err
+		}
+		arguments.StartDate = &date
+	}
+	if to := get(toKey); to != "" {
+		date, err := time.Parse(dateFormat, to)
+		if err != nil {
+			return nil, err
+		}
+		arguments.EndDate = &date
+	}
+	if state := get(stateKey); state != "" {
+		arguments.State = entities.CaptureState(state)
+		if !arguments.State.IsCaptureState() {
+			return nil, errors.New("unknown capture state: " + state)
+		}
+	}
+	if public := get(publicKey); public != "" {
+		isPublic, err := strconv.ParseBool(public)
+		if err != nil {
+			return nil, err
+		}
+		arguments.Public = &isPublic
+	}
+	if page := get(pageKey); page != "" {
+		pageNumber, err := strconv.Atoi(page)
+		if err != nil {
+			return nil, err
+		}
+		arguments.Page = max(pageNumber, 1)
+	}
+	return arguments, nil
+}
+
 func (handler *AdminHandler) View(w http.ResponseWriter, r *http.Request, data *components.AdminViewData) error {
+	w.Header().Set(utils.ContentType, utils.TextHTML)
 	return components.AdminView(data).Render(r.Context(), w)
 }
 
 func (handler *AdminHandler) Routes(mux *http.ServeMux) {
 	mux.Handle("/admin/", handler)
+	mux.Handle("GET /admin/policy", handler.PolicyHandler)
 }
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"jinovatka/assert"
+	"jinovatka/server/components"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Shows the rules deciding which URLs are accepted. They are read only, see services.PolicyService.
+type PolicyHandler struct {
+	Log           *slog.Logger
+	PolicyService *services.PolicyService
+	ErrorHandler  *httperror.ErrorHandler
+}
+
+func NewPolicyHandler(log *slog.Logger, policyService *services.PolicyService, errorHandler *httperror.ErrorHandler) *PolicyHandler {
+	assert.Must(log != nil, "NewPolicyHandler: log can't be nil")
+	assert.Must(policyService != nil, "NewPolicyHandler: policyService can't be nil")
+	assert.Must(errorHandler != nil, "NewPolicyHandler: errorHandler can't be nil")
+	return &PolicyHandler{
+		Log:           log,
+		PolicyService: policyService,
+		ErrorHandler:  errorHandler,
+	}
+}
+
+func (handler *PolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := &components.PolicyViewData{
+		Rules: handler.PolicyService.Rules(),
+		Path:  handler.PolicyService.Path,
+	}
+	err := handler.View(w, r, data)
+	if err != nil {
+		handler.Log.Error("PolicyHandler.ServeHTTP failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
+		return
+	}
+	handler.Log.Info("PolicyHandler responded", utils.LogRequestInfo(r))
+}
+
+func (handler *PolicyHandler) View(w http.ResponseWriter, r *http.Request, data *components.PolicyViewData) error {
+	w.Header().Set(utils.ContentType, utils.TextHTML)
+	return components.PolicyView(data).Render(r.Context(), w)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Package api implements versioned JSON API for scripts. It uses the same ShadowID access model as the HTML pages,
+// everybody who knows the ShadowID of group or seed can read it and trigger its capture.
+
+const Prefix = "/api/v1"
+
+// Maximum size of JSON request body.
+const maxBodySize = 1 << 20
+
+// Query value of the capture endpoints asking for fresh capture even if the URL was captured recently.
+const forceKey = "force"
+
+// Root handler of the API. Holds all API subhandlers.
+type APIHandler struct {
+	Log *slog.Logger
+
+	// Subhandlers
+	CreateGroupHandler  *CreateGroupHandler
+	GroupHandler        *GroupHandler
+	CaptureGroupHandler *CaptureGroupHandler
+	SeedHandler         *SeedHandler
+	CaptureSeedHandler  *CaptureSeedHandler
+}
+
+func NewAPIHandler(log *slog.Logger, seedService *services.SeedService, captureService *services.CaptureService) *APIHandler {
+	assert.Must(log != nil, "NewAPIHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewAPIHandler: seedService can't be nil")
+	assert.Must(captureService != nil, "NewAPIHandler: captureService can't be nil")
+	return &APIHandler{
+		Log:                 log,
+		CreateGroupHandler:  NewCreateGroupHandler(log, seedService, captureService),
+		GroupHandler:        NewGroupHandler(log, seedService),
+		CaptureGroupHandler: NewCaptureGroupHandler(log, seedService, captureService),
+		SeedHandler:         NewSeedHandler(log, seedService),
+		CaptureSeedHandler:  NewCaptureSeedHandler(log, seedService, captureService),
+	}
+}
+
+// Unknown API routes get JSON 404 instead of HTML page.
+func (handler *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler.Log.Warn("APIHandler.ServeHTTP unknown route", utils.LogRequestInfo(r))
+	writeError(handler.Log, w, r, http.StatusNotFound, "not_found", "unknown API endpoint")
+}
+
+func (handler *APIHandler) Routes(mux *http.ServeMux) {
+	mux.Handle(Prefix+"/", handler)
+	mux.Handle("POST "+Prefix+"/groups", handler.CreateGroupHandler)
+	mux.Handle("GET "+Prefix+"/groups/{id}", handler.GroupHandler)
+	mux.Handle("POST "+Prefix+"/groups/{id}/capture", handler.CaptureGroupHandler)
+	mux.Handle("GET "+Prefix+"/seeds/{id}", handler.SeedHandler)
+	mux.Handle("POST "+Prefix+"/seeds/{id}/capture", handler.CaptureSeedHandler)
+}
+
+// Body of all error responses.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	// HTTP status code.
+	Status int `json:"status"`
+	// Machine readable error code.
+	Code string `json:"code"`
+	// Human readable message.
+	Message string `json:"message"`
+}
+
+// Status of single seed.
+type SeedStatus struct {
+	ShadowID string `json:"shadowID"`
+	URL      string `json:"url"`
+	// Key of the canonical URL, seeds of the same page have the same key. Omitted for old seeds.
+	SURT  string                `json:"surt,omitempty"`
+	State entities.CaptureState `json:"state"`
+	// Link to the seed detail page.
+	DetailURL   string     `json:"detailURL"`
+	ArchivalURL string     `json:"archivalURL,omitempty"`
+	HarvestedAt *time.Time `json:"harvestedAt,omitempty"`
+	// Error of the last capture. Omitted if the last capture succeeded.
+	ErrorCategory entities.CaptureErrorCategory `json:"errorCategory,omitempty"`
+	ErrorMessages []string                      `json:"errorMessages,omitempty"`
+	// Metadata of the archived page. Omitted if unknown.
+	PageMetadata *entities.PageMetadata `json:"pageMetadata,omitempty"`
+}
+
+func NewSeedStatus(seed *entities.Seed) *SeedStatus {
+	status := &SeedStatus{
+		ShadowID:      seed.ShadowID,
+		URL:           seed.URL,
+		SURT:          seed.SURT,
+		State:         seed.State,
+		DetailURL:     "/seed/" + seed.ShadowID,
+		ArchivalURL:   seed.ArchivalURL,
+		ErrorCategory: seed.ErrorCategory,
+		ErrorMessages: seed.ErrorMessages,
+		PageMetadata:  seed.PageMetadata,
+	}
+	if !seed.HarvestedAt.IsZero() {
+		harvestedAt := seed.HarvestedAt
+		status.HarvestedAt = &harvestedAt
+	}
+	return status
+}
+
+// Status of group and all its seeds.
+type GroupStatus struct {
+	ShadowID string `json:"shadowID"`
+	// Link to the group page.
+	DetailURL string        `json:"detailURL"`
+	Seeds     []*SeedStatus `json:"seeds"`
+}
+
+func NewGroupStatus(group *entities.SeedsGroup) *GroupStatus {
+	status := &GroupStatus{
+		ShadowID:  group.ShadowID,
+		DetailURL: "/seeds/" + group.ShadowID,
+		Seeds:     make([]*SeedStatus, 0, len(group.Seeds)),
+	}
+	for _, seed := range group.Seeds {
+		status.Seeds = append(status.Seeds, NewSeedStatus(seed))
+	}
+	return status
+}
+
+func writeJSON(log *slog.Logger, w http.ResponseWriter, r *http.Request, status int, body any) {
+	w.Header().Set(utils.ContentType, utils.ApplicationJSON)
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		log.Error("api.writeJSON failed to encode response", "error", err.Error(), utils.LogRequestInfo(r))
+	}
+}
+
+func writeError(log *slog.Logger, w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	body := &ErrorResponse{Error: ErrorBody{Status: status, Code: code, Message: message}}
+	writeJSON(log, w, r, status, body)
+}
+
+func writeInternalError(log *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	writeError(log, w, r, http.StatusInternalServerError, "internal_error", "the server failed to process the request, try again later")
+}
+
+// Fresh capture if the client asked for it, recent capture of the same URL can be used otherwise.
+func captureMode(force bool) services.CaptureMode {
+	if force {
+		return services.CaptureFresh
+	}
+	return services.CaptureReuseRecent
+}
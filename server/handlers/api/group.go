@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+type CreateGroupRequest struct {
+	// URL adresses of the seeds. One URL per item.
+	URLs []string `json:"urls"`
+	// Capture every seed even if the same URL was captured recently.
+	Force bool `json:"force"`
+}
+
+// Result of validation of one URL from CreateGroupRequest. Results are in the same order as the URLs in request.
+type URLValidation struct {
+	// URL as it was sent.
+	Input string `json:"input"`
+	Valid bool   `json:"valid"`
+	// Cleaned URL that is stored. Empty if the URL is invalid.
+	URL string `json:"url,omitempty"`
+	// ShadowID of the created seed. Empty if the URL is invalid or the group wasn't created.
+	ShadowID string `json:"shadowID,omitempty"`
+	// Machine readable reason of rejection. Empty if the URL is valid.
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Human readable reason of rejection. Empty if the URL is valid.
+	Error string `json:"error,omitempty"`
+}
+
+type CreateGroupResponse struct {
+	// Created group. Nil if any URL was invalid and nothing was created.
+	Group *GroupStatus `json:"group,omitempty"`
+	// Validation result of every URL.
+	Results []*URLValidation `json:"results"`
+}
+
+// Creates group from list of URLs and enqueues it for capture.
+// If any URL is invalid nothing is created and the response contains the reasons.
+type CreateGroupHandler struct {
+	Log            *slog.Logger
+	SeedService    *services.SeedService
+	CaptureService *services.CaptureService
+}
+
+func NewCreateGroupHandler(log *slog.Logger, seedService *services.SeedService, captureService *services.CaptureService) *CreateGroupHandler {
+	assert.Must(log != nil, "NewCreateGroupHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewCreateGroupHandler: seedService can't be nil")
+	assert.Must(captureService != nil, "NewCreateGroupHandler: captureService can't be nil")
+	return &CreateGroupHandler{
+		Log:            log,
+		SeedService:    seedService,
+		CaptureService: captureService,
+	}
+}
+
+func (handler *CreateGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := new(CreateGroupRequest)
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(request)
+	if err != nil {
+		handler.Log.Warn("CreateGroupHandler.ServeHTTP recieved malformed request", "error", err.Error(), utils.LogRequestInfo(r))
+		writeError(handler.Log, w, r, http.StatusBadRequest, "malformed_request", "request body must be JSON object with \"urls\" array: "+err.Error())
+		return
+	}
+	if len(request.URLs) == 0 {
+		writeError(handler.Log, w, r, http.StatusBadRequest, "empty_list", "the list of URLs is empty")
+		return
+	}
+	if len(request.URLs) > handler.SeedService.MaxInputListLines {
+		message := "too many URLs, the limit is " + strconv.Itoa(handler.SeedService.MaxInputListLines)
+		writeError(handler.Log, w, r, http.StatusRequestEntityTooLarge, "too_many_urls", message)
+		return
+	}
+
+	// Validate every URL first, so the client gets all problems at once.
+	response := &CreateGroupResponse{Results: make([]*URLValidation, 0, len(request.URLs))}
+	validURLs := make([]string, 0, len(request.URLs))
+	cleanedURLs, errs := handler.SeedService.ValidateURLs(r.Context(), request.URLs)
+	for i, input := range request.URLs {
+		result := &URLValidation{Input: input}
+		if errs[i] != nil {
+			result.ErrorCode, result.Error = validationError(errs[i])
+		} else {
+			result.Valid = true
+			result.URL = cleanedURLs[i]
+			validURLs = append(validURLs, cleanedURLs[i])
+		}
+		response.Results = append(response.Results, result)
+	}
+	if len(validURLs) != len(request.URLs) {
+		handler.Log.Info("CreateGroupHandler.ServeHTTP rejected request with invalid URLs", utils.LogRequestInfo(r))
+		writeJSON(handler.Log, w, r, http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	// All URLs are valid and non empty, so the saved lines are in the same order as the results.
+	group, saved, err := handler.SeedService.SaveList(r.Context(), validURLs, true, services.SaveAllOrNothing)
+	if err != nil || len(saved) != len(response.Results) {
+		handler.Log.Error("CreateGroupHandler.ServeHTTP SeedService failed to save group", "error", errorString(err), utils.LogRequestInfo(r))
+		writeInternalError(handler.Log, w, r)
+		return
+	}
+	for i, line := range saved {
+		response.Results[i].ShadowID = line.ShadowID
+	}
+
+	// Enqueue seeds for capture (this does not change the success of the http request)
+	err = handler.CaptureService.CaptureGroup(r.Context(), group, captureMode(request.Force))
+	if err != nil {
+		handler.Log.Error("CreateGroupHandler.ServeHTTP CaptureService returned error when trying to enqueue group", "error", err.Error(), utils.LogRequestInfo(r))
+		// Do not return!
+	}
+
+	// Reload the group, so the response contains states after enqueuing.
+	reloaded, err := handler.SeedService.GetGroup(group.ShadowID)
+	if err != nil {
+		handler.Log.Error("CreateGroupHandler.ServeHTTP failed to reload group", "error", err.Error(), utils.LogRequestInfo(r))
+		reloaded = group
+	}
+	response.Group = NewGroupStatus(reloaded)
+	w.Header().Set("Location", Prefix+"/groups/"+group.ShadowID)
+	writeJSON(handler.Log, w, r, http.StatusCreated, response)
+	handler.Log.Info("CreateGroupHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Returns status of the group and all its seeds.
+type GroupHandler struct {
+	Log         *slog.Logger
+	SeedService *services.SeedService
+}
+
+func NewGroupHandler(log *slog.Logger, seedService *services.SeedService) *GroupHandler {
+	assert.Must(log != nil, "NewGroupHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewGroupHandler: seedService can't be nil")
+	return &GroupHandler{
+		Log:         log,
+		SeedService: seedService,
+	}
+}
+
+func (handler *GroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	group, ok := getGroup(handler.Log, handler.SeedService, w, r)
+	if !ok {
+		return
+	}
+	writeJSON(handler.Log, w, r, http.StatusOK, NewGroupStatus(group))
+	handler.Log.Info("GroupHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Enqueues all seeds of the group for capture again. Seeds that are already waiting for capture are skipped.
+type CaptureGroupHandler struct {
+	Log            *slog.Logger
+	SeedService    *services.SeedService
+	CaptureService *services.CaptureService
+}
+
+func NewCaptureGroupHandler(log *slog.Logger, seedService *services.SeedService, captureService *services.CaptureService) *CaptureGroupHandler {
+	assert.Must(log != nil, "NewCaptureGroupHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewCaptureGroupHandler: seedService can't be nil")
+	assert.Must(captureService != nil, "NewCaptureGroupHandler: captureService can't be nil")
+	return &CaptureGroupHandler{
+		Log:            log,
+		SeedService:    seedService,
+		CaptureService: captureService,
+	}
+}
+
+func (handler *CaptureGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	group, ok := getGroup(handler.Log, handler.SeedService, w, r)
+	if !ok {
+		return
+	}
+	toCapture := &entities.SeedsGroup{ShadowID: group.ShadowID}
+	for _, seed := range group.Seeds {
+		if seed.State != entities.Pending {
+			toCapture.Seeds = append(toCapture.Seeds, seed)
+		}
+	}
+	err := handler.CaptureService.CaptureGroup(r.Context(), toCapture, captureMode(r.URL.Query().Has(forceKey)))
+	if err != nil {
+		handler.Log.Error("CaptureGroupHandler.ServeHTTP CaptureService failed to enqueue group", "error", err.Error(), utils.LogRequestInfo(r))
+		writeInternalError(handler.Log, w, r)
+		return
+	}
+	group, ok = getGroup(handler.Log, handler.SeedService, w, r)
+	if !ok {
+		return
+	}
+	writeJSON(handler.Log, w, r, http.StatusAccepted, NewGroupStatus(group))
+	handler.Log.Info("CaptureGroupHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Fetch group requested by the path value "id". Writes error response and returns false if the group can't be fetched.
+func getGroup(log *slog.Logger, seedService *services.SeedService, w http.ResponseWriter, r *http.Request) (*entities.SeedsGroup, bool) {
+	group, err := seedService.GetGroup(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warn("api.getGroup group not found", "error", err.Error(), utils.LogRequestInfo(r))
+		writeError(log, w, r, http.StatusNotFound, "not_found", "group not found")
+		return nil, false
+	}
+	if err != nil {
+		log.Error("api.getGroup failed to fetch SeedsGroup data", "error", err.Error(), utils.LogRequestInfo(r))
+		writeInternalError(log, w, r)
+		return nil, false
+	}
+	return group, true
+}
+
+// Machine readable code and message for URL validation errors.
+func validationError(err error) (string, string) {
+	switch {
+	case errors.Is(err, services.ErrEmptyUri):
+		return "empty_url", err.Error()
+	case errors.Is(err, services.ErrURLTooLong):
+		return "url_too_long", err.Error()
+	case errors.Is(err, services.ErrForbiddenScheme):
+		return "forbidden_scheme", err.Error()
+	case errors.Is(err, services.ErrEmptyScheme):
+		return "empty_scheme", err.Error()
+	case errors.Is(err, services.ErrLoopback):
+		return "loopback_address", err.Error()
+	case errors.Is(err, services.ErrPrivateIP):
+		return "private_address", err.Error()
+	case errors.Is(err, services.ErrWellKnownPort):
+		return "well_known_port", err.Error()
+	case errors.Is(err, services.ErrNonPublicHost):
+		return "non_public_host", err.Error()
+	case errors.Is(err, services.ErrUnresolvableHost):
+		return "unresolvable_host", err.Error()
+	case errors.Is(err, services.ErrInvalidHost):
+		return "invalid_host", err.Error()
+	case errors.Is(err, services.ErrPolicyDenied):
+		return "policy_denied", err.Error()
+	case errors.Is(err, services.ErrPolicyNotAllowed):
+		return "policy_not_allowed", err.Error()
+	}
+	return "invalid_url", err.Error()
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Returns status of single seed.
+type SeedHandler struct {
+	Log         *slog.Logger
+	SeedService *services.SeedService
+}
+
+func NewSeedHandler(log *slog.Logger, seedService *services.SeedService) *SeedHandler {
+	assert.Must(log != nil, "NewSeedHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewSeedHandler: seedService can't be nil")
+	return &SeedHandler{
+		Log:         log,
+		SeedService: seedService,
+	}
+}
+
+func (handler *SeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	seed, ok := getSeed(handler.Log, handler.SeedService, w, r)
+	if !ok {
+		return
+	}
+	writeJSON(handler.Log, w, r, http.StatusOK, NewSeedStatus(seed))
+	handler.Log.Info("SeedHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Enqueues the seed for capture again. Seed that is already waiting for capture is not enqueued.
+type CaptureSeedHandler struct {
+	Log            *slog.Logger
+	SeedService    *services.SeedService
+	CaptureService *services.CaptureService
+}
+
+func NewCaptureSeedHandler(log *slog.Logger, seedService *services.SeedService, captureService *services.CaptureService) *CaptureSeedHandler {
+	assert.Must(log != nil, "NewCaptureSeedHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewCaptureSeedHandler: seedService can't be nil")
+	assert.Must(captureService != nil, "NewCaptureSeedHandler: captureService can't be nil")
+	return &CaptureSeedHandler{
+		Log:            log,
+		SeedService:    seedService,
+		CaptureService: captureService,
+	}
+}
+
+func (handler *CaptureSeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	seed, ok := getSeed(handler.Log, handler.SeedService, w, r)
+	if !ok {
+		return
+	}
+	if seed.State == entities.Pending {
+		writeError(handler.Log, w, r, http.StatusConflict, "already_pending", "the seed is already waiting for capture")
+		return
+	}
+	err := handler.CaptureService.CaptureSeed(r.Context(), seed, captureMode(r.URL.Query().Has(forceKey)))
+	if err != nil {
+		handler.Log.Error("CaptureSeedHandler.ServeHTTP CaptureService failed to enqueue seed", "error", err.Error(), utils.LogRequestInfo(r))
+		writeInternalError(handler.Log, w, r)
+		return
+	}
+	seed, ok = getSeed(handler.Log, handler.SeedService, w, r)
+	if !ok {
+		return
+	}
+	writeJSON(handler.Log, w, r, http.StatusAccepted, NewSeedStatus(seed))
+	handler.Log.Info("CaptureSeedHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Fetch seed requested by the path value "id". Writes error response and returns false if the seed can't be fetched.
+func getSeed(log *slog.Logger, seedService *services.SeedService, w http.ResponseWriter, r *http.Request) (*entities.Seed, bool) {
+	seed, err := seedService.GetSeed(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warn("api.getSeed seed not found", "error", err.Error(), utils.LogRequestInfo(r))
+		writeError(log, w, r, http.StatusNotFound, "not_found", "seed not found")
+		return nil, false
+	}
+	if err != nil {
+		log.Error("api.getSeed failed to fetch Seed data", "error", err.Error(), utils.LogRequestInfo(r))
+		writeInternalError(log, w, r)
+		return nil, false
+	}
+	return seed, true
+}
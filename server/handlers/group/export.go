@@ -2,6 +2,7 @@ package group
 
 import (
 	"bytes"
+	"errors"
 	"jinovatka/assert"
 	"jinovatka/server/handlers/httperror"
 	"jinovatka/services"
@@ -9,6 +10,8 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -17,39 +20,58 @@ type ExportGroupHandler struct {
 	Log             *slog.Logger
 	SeedService     *services.SeedService
 	ExporterService *services.ExporterService
+	CitationService *services.CitationService
 	ErrorHandler    *httperror.ErrorHandler
+	// Public URL of the server used for links in exports. If nil, the Host header is used.
+	PublicURL *url.URL
 }
 
 func NewExportGroupHandler(
 	log *slog.Logger,
 	seedService *services.SeedService,
 	exporterService *services.ExporterService,
+	citationService *services.CitationService,
 	errorHandler *httperror.ErrorHandler,
+	publicURL *url.URL,
 ) *ExportGroupHandler {
 	assert.Must(log != nil, "NewExportGroupHandler: log can't be nil")
 	assert.Must(seedService != nil, "NewExportGroupHandler: seedService can't be nil")
 	assert.Must(exporterService != nil, "NewExportGroupHandler: exporterService can't be nil")
+	assert.Must(citationService != nil, "NewExportGroupHandler: citationService can't be nil")
 	assert.Must(errorHandler != nil, "NewExportGroupHandler: errorHandler can't be nil")
 	return &ExportGroupHandler{
 		Log:             log,
 		SeedService:     seedService,
 		ExporterService: exporterService,
+		CitationService: citationService,
 		ErrorHandler:    errorHandler,
+		PublicURL:       publicURL,
 	}
 }
 
 func (handler *ExportGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	groupId := r.PathValue("id")
-	// We need Host header to generate URLs
-	// TODO: In production this must be taken from config. Don't rely on the host header, anything can be there.
-	if r.Host == "" {
+	// Citation styles are exported as citations of all seeds instead of table.
+	if style, err := handler.CitationService.Style(r.URL.Query().Get(formatKey)); err == nil {
+		handler.serveCitations(w, r, style)
+		return
+	}
+	format, err := handler.requestedFormat(r)
+	if err != nil {
+		handler.Log.Warn("ExportGroupHandler.ServeHTTP recieved unknown format", "format", r.URL.Query().Get(formatKey), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusBadRequest, "Neznámý formát", "Požadovaný formát exportu není podporován. Vyberte prosím jeden z formátů na stránce přehledu semínek.")
+		return
+	}
+	// We need public URL or Host header to generate URLs
+	// In production the public URL should be set in config. Don't rely on the host header, anything can be there.
+	if handler.PublicURL == nil && r.Host == "" {
 		handler.Log.Error("ExportGroupHandler.ServeHTTP missing Host header in request", utils.LogRequestInfo(r))
 		handler.ErrorHandler.InternalServerError(w, r)
 		return
 	}
 	group, err := handler.SeedService.GetGroup(groupId)
 	// TODO: Create common error for services to comunicate that record does not exist so we don't have to break the layer model all the time
-	if err == gorm.ErrRecordNotFound {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		handler.Log.Warn("ExportGroupHandler.ServeHTTP group not found", "error", err.Error(), utils.LogRequestInfo(r))
 		handler.ErrorHandler.PageNotFound(w, r)
 		return
@@ -61,14 +83,19 @@ func (handler *ExportGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	}
 
 	buffer := new(bytes.Buffer)
-	// Remeber to add the http prefix, otherwise the URL library will fail silently!
-	urlPrefix, err := url.Parse("http://" + r.Host + "/seed/")
-	if err != nil {
-		handler.Log.Error("ExportGroupHandler.ServeHTTP colud not parse r.Host to URL", "error", err.Error(), utils.LogRequestInfo(r))
-		handler.ErrorHandler.InternalServerError(w, r)
-		return
+	var urlPrefix *url.URL
+	if handler.PublicURL != nil {
+		urlPrefix = handler.PublicURL.JoinPath("/seed/")
+	} else {
+		// Remeber to add the http prefix, otherwise the URL library will fail silently!
+		urlPrefix, err = url.Parse("http://" + r.Host + "/seed/")
+		if err != nil {
+			handler.Log.Error("ExportGroupHandler.ServeHTTP colud not parse r.Host to URL", "error", err.Error(), utils.LogRequestInfo(r))
+			handler.ErrorHandler.InternalServerError(w, r)
+			return
+		}
 	}
-	err = handler.ExporterService.GroupToExcel(group, buffer, urlPrefix)
+	err = handler.ExporterService.ExportGroup(group, format, buffer, urlPrefix)
 	if err != nil {
 		handler.Log.Error("ExportGroupHandler.ServeHTTP got error from exporter service", "error", err.Error(), utils.LogRequestInfo(r))
 		handler.ErrorHandler.InternalServerError(w, r)
@@ -76,11 +103,63 @@ func (handler *ExportGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	}
 
 	header := w.Header()
-	const XlsxMimetype = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
-	header.Set(utils.ContentType, XlsxMimetype)
-	filename := "seminka-" + group.ShadowID + ".xlsx"
+	header.Set(utils.ContentType, handler.ExporterService.ContentType(format))
+	filename := "seminka-" + group.ShadowID + "." + string(format)
 	header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
 	w.WriteHeader(http.StatusOK)
 	_, _ = buffer.WriteTo(w)
 	handler.Log.Info("ExportGroupHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
 }
+
+// Names of the export query values.
+const (
+	formatKey   = "format"
+	templateKey = "template"
+)
+
+func (handler *ExportGroupHandler) serveCitations(w http.ResponseWriter, r *http.Request, style *services.CitationStyle) {
+	group, err := handler.SeedService.GetGroup(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handler.Log.Warn("ExportGroupHandler.serveCitations group not found", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.PageNotFound(w, r)
+		return
+	}
+	if err != nil {
+		handler.Log.Error("ExportGroupHandler.serveCitations failed to fetch SeedsGroup data", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	citations, err := handler.CitationService.CiteGroup(group, style.Name, r.URL.Query().Get(templateKey), time.Now())
+	if errors.Is(err, services.ErrInvalidCitationTemplate) {
+		handler.Log.Warn("ExportGroupHandler.serveCitations recieved invalid template", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusBadRequest, "Neplatná šablona citace", "Šablonu se nepodařilo použít: "+err.Error())
+		return
+	}
+	if err != nil {
+		handler.Log.Error("ExportGroupHandler.serveCitations failed to create citations", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+
+	header := w.Header()
+	header.Set(utils.ContentType, style.ContentType)
+	filename := "citace-" + group.ShadowID + "." + style.Extension
+	header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(citations))
+	handler.Log.Info("ExportGroupHandler.serveCitations sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Format is selected by the query parameter "format", then by the Accept header. Excel is the default.
+func (handler *ExportGroupHandler) requestedFormat(r *http.Request) (services.ExportFormat, error) {
+	if name := r.URL.Query().Get(formatKey); name != "" {
+		return handler.ExporterService.Format(name)
+	}
+	for accepted := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		format, err := handler.ExporterService.FormatByContentType(accepted)
+		if err == nil {
+			return format, nil
+		}
+	}
+	return services.FormatXLSX, nil
+}
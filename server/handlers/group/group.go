@@ -9,16 +9,18 @@ import (
 	"jinovatka/utils"
 	"log/slog"
 	"net/http"
+	"net/url"
 
 	"gorm.io/gorm"
 )
 
 // Hanlder for seed groups. Used to create/show list of seeds to make tracking of progress of individual seeds easier.
 type GroupHandler struct {
-	Log            *slog.Logger
-	SeedService    *services.SeedService
-	CaptureService *services.CaptureService
-	ErrorHandler   *httperror.ErrorHandler
+	Log             *slog.Logger
+	SeedService     *services.SeedService
+	CaptureService  *services.CaptureService
+	ScheduleService *services.ScheduleService
+	ErrorHandler    *httperror.ErrorHandler
 
 	// Subhandlers
 	SaveGroupHandler   *SaveGroupHandler
@@ -29,20 +31,26 @@ func NewGroupHandler(
 	log *slog.Logger,
 	seedService *services.SeedService,
 	exporterService *services.ExporterService,
+	citationService *services.CitationService,
 	captureService *services.CaptureService,
+	scheduleService *services.ScheduleService,
 	errorHandler *httperror.ErrorHandler,
+	publicURL *url.URL,
 ) *GroupHandler {
 	assert.Must(log != nil, "NewGroupHandler: log can't be nil")
 	assert.Must(seedService != nil, "NewGroupHandler: seedService can't be nil")
 	assert.Must(exporterService != nil, "NewGroupHandler: exporterService can't be nil")
+	assert.Must(citationService != nil, "NewGroupHandler: citationService can't be nil")
 	assert.Must(captureService != nil, "NewGroupHandler: captureService can't be nil")
+	assert.Must(scheduleService != nil, "NewGroupHandler: scheduleService can't be nil")
 	assert.Must(errorHandler != nil, "NewGroupHandler: errorHandler can't be nil")
 	return &GroupHandler{
 		Log:                log,
 		SeedService:        seedService,
+		ScheduleService:    scheduleService,
 		ErrorHandler:       errorHandler,
 		SaveGroupHandler:   NewSaveGroupHandler(log, seedService, captureService, errorHandler),
-		ExportGroupHandler: NewExportGroupHandler(log, seedService, exporterService, errorHandler),
+		ExportGroupHandler: NewExportGroupHandler(log, seedService, exporterService, citationService, errorHandler, publicURL),
 	}
 }
 
@@ -59,7 +67,14 @@ func (handler *GroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		handler.ErrorHandler.InternalServerError(w, r)
 		return
 	}
-	data := components.NewGroupViewData(group)
+	schedule, err := handler.ScheduleService.GetGroupSchedule(requestedID)
+	if err != nil {
+		handler.Log.Error("GroupHandler.ServeHTTP failed to fetch schedule", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	data := components.NewGroupViewData(group, groupCitationStyles(handler.ExportGroupHandler.CitationService))
+	data.Schedule = components.NewScheduleViewData("/seeds/schedule/"+requestedID, schedule, handler.ScheduleService.Location)
 	err = handler.View(w, r, data)
 	if err != nil {
 		handler.Log.Error("GroupHandler.ServeHTTP failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
@@ -68,6 +83,15 @@ func (handler *GroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler.Log.Info("GroupHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
 }
 
+// Citation styles offered for download.
+func groupCitationStyles(citationService *services.CitationService) []*components.CitationStyleOption {
+	options := make([]*components.CitationStyleOption, 0, len(citationService.Styles))
+	for _, style := range citationService.Styles {
+		options = append(options, &components.CitationStyleOption{Name: style.Name, Label: style.Label})
+	}
+	return options
+}
+
 func (handler *GroupHandler) View(w http.ResponseWriter, r *http.Request, data *components.GroupViewData) error {
 	return components.GroupView(data).Render(r.Context(), w)
 }
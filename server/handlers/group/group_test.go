@@ -0,0 +1,133 @@
+package group
+
+import (
+	"jinovatka/config"
+	memoryq "jinovatka/queue/memory"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/storage"
+	gormStorage "jinovatka/storage/gorm"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Group routes on temporary sqlite database with the memory queue. Nothing takes the requests from the queue.
+func newTestMux(t *testing.T) (*http.ServeMux, *memoryq.Queue) {
+	t.Helper()
+	log := slog.New(slog.DiscardHandler)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "storage.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Queue.Backend = "memory"
+	cfg.Input.RejectNonPublicHosts = false
+	cfg.Input.PolicyPath = ""
+	repository := storage.NewRepository(
+		gormStorage.NewSeedRepository(log, db),
+		gormStorage.NewCaptureRepository(log, db),
+		gormStorage.NewScheduleRepository(log, db),
+	)
+	queue := memoryq.NewQueue(log)
+	s := services.NewServices(log, cfg, repository, queue, nil)
+	handler := NewGroupHandler(log, s.SeedService, s.ExporterService, s.CitationService, s.CaptureService, s.ScheduleService, httperror.NewErrorHandler(log), nil)
+	mux := http.NewServeMux()
+	handler.Routes(mux)
+	return mux, queue
+}
+
+func serve(mux *http.ServeMux, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func postList(mux *http.ServeMux, list string) *httptest.ResponseRecorder {
+	form := url.Values{"url-list": {list}}
+	request := httptest.NewRequest(http.MethodPost, "/seeds/save/", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(mux, request)
+}
+
+func TestSaveAndShowGroup(t *testing.T) {
+	mux, queue := newTestMux(t)
+
+	response := postList(mux, "https://example.com/\nhttps://example.org/page")
+	if response.Code != http.StatusSeeOther {
+		t.Fatalf("POST /seeds/save/ responded %d, expected %d", response.Code, http.StatusSeeOther)
+	}
+	location := response.Header().Get("Location")
+	if !strings.HasPrefix(location, "/seeds/") {
+		t.Fatalf("POST /seeds/save/ redirected to %q, expected group page", location)
+	}
+	if pending := queue.PendingRequests(); pending != 2 {
+		t.Errorf("%d requests were enqueued, expected 2", pending)
+	}
+
+	response = serve(mux, httptest.NewRequest(http.MethodGet, location, nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("GET %s responded %d", location, response.Code)
+	}
+	for _, seedURL := range []string{"https://example.com/", "https://example.org/page"} {
+		if !strings.Contains(response.Body.String(), seedURL) {
+			t.Errorf("GET %s doesn't show seed %s", location, seedURL)
+		}
+	}
+
+	groupID := strings.TrimPrefix(location, "/seeds/")
+	response = serve(mux, httptest.NewRequest(http.MethodGet, "/seeds/export/"+groupID+"?format=csv", nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("CSV export responded %d", response.Code)
+	}
+	if !strings.Contains(response.Body.String(), "https://example.org/page") {
+		t.Errorf("CSV export doesn't contain the seed: %s", response.Body.String())
+	}
+	response = serve(mux, httptest.NewRequest(http.MethodGet, "/seeds/export/"+groupID+"?format=doc", nil))
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("export in unknown format responded %d, expected %d", response.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSaveGroupRejectsInput(t *testing.T) {
+	mux, queue := newTestMux(t)
+	tests := []struct {
+		name string
+		list string
+		code int
+	}{
+		{"empty", "\n\n", http.StatusBadRequest},
+		{"invalid line", "https://example.com/\nftp://example.com/", http.StatusUnprocessableEntity},
+		{"loopback", "http://localhost/", http.StatusUnprocessableEntity},
+		{"too many lines", strings.Repeat("https://example.com/\n", 21), http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := postList(mux, test.list)
+			if response.Code != test.code {
+				t.Errorf("POST /seeds/save/ responded %d, expected %d", response.Code, test.code)
+			}
+		})
+	}
+	if pending := queue.PendingRequests(); pending != 0 {
+		t.Errorf("%d requests were enqueued from rejected lists", pending)
+	}
+}
+
+func TestGroupNotFound(t *testing.T) {
+	mux, _ := newTestMux(t)
+	for _, path := range []string{"/seeds/missing", "/seeds/export/missing?format=csv"} {
+		response := serve(mux, httptest.NewRequest(http.MethodGet, path, nil))
+		if response.Code != http.StatusNotFound {
+			t.Errorf("GET %s responded %d, expected %d", path, response.Code, http.StatusNotFound)
+		}
+	}
+}
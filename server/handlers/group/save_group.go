@@ -3,11 +3,14 @@ package group
 import (
 	"errors"
 	"jinovatka/assert"
+	"jinovatka/server/components"
 	"jinovatka/server/handlers/httperror"
 	"jinovatka/services"
 	"jinovatka/utils"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func NewSaveGroupHandler(
@@ -36,29 +39,131 @@ type SaveGroupHandler struct {
 }
 
 func (handler *SaveGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	const urlKey = "url-list"
+	const (
+		urlKey          = "url-list"
+		skipInvalidKey  = "skip-invalid"
+		forceCaptureKey = "force-capture"
+	)
 	// TODO: Check that server has correct setting for request size.
 	seedURL := r.FormValue(urlKey)
-	group, err := handler.SeedService.Save(seedURL, true)
-	// TODO: Return different error pages/messages when different errors are recived. This should help user understant what they did wrong.
-	if errors.Is(err, services.ErrEmptyList) {
+	mode := services.SaveAllOrNothing
+	if r.FormValue(skipInvalidKey) != "" {
+		mode = services.SaveValidOnly
+	}
+	data := components.NewIndexViewData()
+	data.Input = seedURL
+	data.SkipInvalid = mode == services.SaveValidOnly
+	captureMode := services.CaptureReuseRecent
+	if r.FormValue(forceCaptureKey) != "" {
+		captureMode = services.CaptureFresh
+	}
+	data.ForceCapture = captureMode == services.CaptureFresh
+
+	group, results, err := handler.SeedService.Save(r.Context(), seedURL, true, mode)
+	switch {
+	case errors.Is(err, services.ErrEmptyList):
 		handler.Log.Warn("SaveGroupHandler.ServeHTTP recieved empty seed list", utils.LogRequestInfo(r))
-		handler.ErrorHandler.ServeError(w, r, "Prázdný požadavek", 400, "Prázdný požadavek", "Požadavek který jsme obdrželi obsahoval jen prázdné řádky. Prosím vraťe se na hlavní stránku a zadejte platnou URL adresu.")
+		data.Message = "Požadavek obsahoval jen prázdné řádky. Zadejte prosím alespoň jednu URL adresu."
+		handler.renderForm(w, r, http.StatusBadRequest, data)
 		return
-	}
-	if err != nil {
+	case errors.Is(err, services.ErrTooManyLines), errors.Is(err, services.ErrInputTooLarge):
+		handler.Log.Warn("SaveGroupHandler.ServeHTTP recieved too large seed list", "error", err.Error(), utils.LogRequestInfo(r))
+		data.Message = "Zadali jste příliš mnoho adres. Najednou lze odeslat nejvýše " +
+			strconv.Itoa(handler.SeedService.MaxInputListLines) + " adres."
+		handler.renderForm(w, r, http.StatusRequestEntityTooLarge, data)
+		return
+	case errors.Is(err, services.ErrInvalidLines):
+		handler.Log.Info("SaveGroupHandler.ServeHTTP recieved seed list with invalid lines", utils.LogRequestInfo(r))
+		data.Problems = inputProblems(results)
+		handler.renderForm(w, r, http.StatusUnprocessableEntity, data)
+		return
+	case err != nil:
 		handler.Log.Error("SaveGroupHandler.ServeHTTP SeedService returned error when trying to save group", slog.String("error", err.Error()), utils.LogRequestInfo(r))
 		handler.ErrorHandler.InternalServerError(w, r)
 		return
 	}
 
 	// Enqueue seeds for capture (this does not change the success of the http request)
-	err = handler.CaptureService.CaptureGroup(r.Context(), group)
+	err = handler.CaptureService.CaptureGroup(r.Context(), group, captureMode)
 	if err != nil {
 		handler.Log.Error("SaveGroupHandler.ServeHTTP CaptureService returned error when trying to enqueue group", "error", err.Error(), utils.LogRequestInfo(r))
 		// Do not return!
 	}
 
+	// Some lines were rejected. Show them, so the user can fix them, and leave only them in the form.
+	problems := inputProblems(results)
+	if len(problems) > 0 {
+		rejected := make([]string, 0, len(problems))
+		for _, problem := range problems {
+			rejected = append(rejected, problem.Input)
+		}
+		data.Input = strings.Join(rejected, "\n")
+		data.Problems = problems
+		data.SavedGroupShadowID = group.ShadowID
+		data.SavedCount = len(group.Seeds)
+		handler.renderForm(w, r, http.StatusOK, data)
+		return
+	}
+
 	http.Redirect(w, r, "/seeds/"+group.ShadowID, http.StatusSeeOther)
 	handler.Log.Info("SaveGroupHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
 }
+
+// Render the index page with the form filled in and problems shown.
+func (handler *SaveGroupHandler) renderForm(w http.ResponseWriter, r *http.Request, code int, data *components.IndexViewData) {
+	w.Header().Set(utils.ContentType, utils.TextHTML)
+	w.WriteHeader(code)
+	err := components.IndexView(data).Render(r.Context(), w)
+	if err != nil {
+		handler.Log.Error("SaveGroupHandler.renderForm failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
+		return
+	}
+	handler.Log.Info("SaveGroupHandler.ServeHTTP responded with form", "code", code, utils.LogRequestInfo(r))
+}
+
+func inputProblems(results []*services.LineValidation) []*components.InputProblem {
+	problems := make([]*components.InputProblem, 0)
+	for _, result := range results {
+		if result.Valid() {
+			continue
+		}
+		problems = append(problems, &components.InputProblem{
+			Line:    result.Line,
+			Input:   strings.TrimSpace(result.Input),
+			Message: lineErrorMessage(result.Err),
+		})
+	}
+	return problems
+}
+
+// Czech explanation of the reason why the line was rejected.
+func lineErrorMessage(err error) string {
+	var policyErr *services.PolicyError
+	switch {
+	case errors.Is(err, services.ErrEmptyUri):
+		return "adresa je prázdná."
+	case errors.Is(err, services.ErrURLTooLong):
+		return "adresa je příliš dlouhá."
+	case errors.Is(err, services.ErrEmptyScheme), errors.Is(err, services.ErrForbiddenScheme):
+		return "adresa musí začínat http:// nebo https://."
+	case errors.Is(err, services.ErrLoopback):
+		return "adresa nesmí odkazovat na localhost."
+	case errors.Is(err, services.ErrPrivateIP):
+		return "adresa nesmí odkazovat na soukromou IP adresu."
+	case errors.Is(err, services.ErrWellKnownPort):
+		return "adresa nesmí používat systémový port (nižší než 1023)."
+	case errors.Is(err, services.ErrNonPublicHost):
+		return "doména adresy odkazuje na neveřejnou IP adresu."
+	case errors.Is(err, services.ErrUnresolvableHost):
+		return "doménu adresy se nepodařilo najít v DNS."
+	case errors.Is(err, services.ErrInvalidHost):
+		return "doména adresy není platná."
+	case errors.As(err, &policyErr) && policyErr.Rule != nil && policyErr.Rule.Reason != "":
+		return "adresu nelze sklidit: " + policyErr.Rule.Reason
+	case errors.Is(err, services.ErrPolicyDenied):
+		return "adresu nelze sklidit: je zakázána pravidly tohoto archivu."
+	case errors.Is(err, services.ErrPolicyNotAllowed):
+		return "adresu nelze sklidit: tento archiv přijímá jen adresy z povolených webů."
+	}
+	return "adresu se nepodařilo přečíst, zkontrolujte zda je správně zapsaná."
+}
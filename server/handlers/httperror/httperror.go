@@ -52,7 +52,7 @@ func (handler *ErrorHandler) InternalServerError(w http.ResponseWriter, r *http.
 	description := "Chyba na straně serveru"
 	message := "Omlouváme se, došlo k chybě a nebyli jsme schopni splnit váš požadavek. Zkuste to prosím později."
 	data := components.NewErrorViewData(title, code, description, message)
-	err := handler.View(w, r, data)
+	err := handler.View(w, r, http.StatusInternalServerError, data)
 	if err != nil {
 		handler.Log.Error("NewErrorHandler.InternalServerError failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
 		return
@@ -78,7 +78,7 @@ func (handler *ErrorHandler) ServeError(w http.ResponseWriter, r *http.Request,
 		description = "Něco se pokazilo :("
 	}
 	data := components.NewErrorViewData(title, strcode, description, message)
-	err := handler.View(w, r, data)
+	err := handler.View(w, r, code, data)
 	if err != nil {
 		handler.Log.Error("NewErrorHandler.ServeError failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
 		return
@@ -87,7 +87,8 @@ func (handler *ErrorHandler) ServeError(w http.ResponseWriter, r *http.Request,
 	handler.Log.Info("NewErrorHandler.ServeError sucessfully served error page", utils.LogRequestInfo(r), errorInfo)
 }
 
-func (handler *ErrorHandler) View(w http.ResponseWriter, r *http.Request, data *components.ErrorViewData) error {
+func (handler *ErrorHandler) View(w http.ResponseWriter, r *http.Request, code int, data *components.ErrorViewData) error {
 	w.Header().Set(utils.ContentType, utils.TextHTML)
+	w.WriteHeader(code)
 	return components.ErrorView(data).Render(r.Context(), w)
 }
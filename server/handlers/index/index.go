@@ -51,7 +51,7 @@ func (handler *IndexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func (handler *IndexHandler) View(w http.ResponseWriter, r *http.Request) error {
 	w.Header().Set(utils.ContentType, utils.TextHTML)
-	return components.IndexView().Render(r.Context(), w)
+	return components.IndexView(components.NewIndexViewData()).Render(r.Context(), w)
 }
 
 func (handler *IndexHandler) Routes(mux *http.ServeMux) {
@@ -0,0 +1,112 @@
+package memento
+
+import (
+	"jinovatka/assert"
+	"jinovatka/entities"
+	mementoformat "jinovatka/memento"
+	"jinovatka/services"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Memento (RFC 7089) endpoints made from successful captures of public seeds.
+// The original URL is appended to the prefix, for example /timegate/https://example.com/.
+const (
+	TimeMapPrefix  = "/timemap/link/"
+	TimeGatePrefix = "/timegate/"
+)
+
+type MementoHandler struct {
+	Log         *slog.Logger
+	SeedService *services.SeedService
+	// Public URL of the server used for links. If nil, the Host header is used.
+	PublicURL *url.URL
+
+	// Subhandlers
+	TimeMapHandler  *TimeMapHandler
+	TimeGateHandler *TimeGateHandler
+}
+
+func NewMementoHandler(log *slog.Logger, seedService *services.SeedService, publicURL *url.URL) *MementoHandler {
+	assert.Must(log != nil, "NewMementoHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewMementoHandler: seedService can't be nil")
+	return &MementoHandler{
+		Log:             log,
+		SeedService:     seedService,
+		PublicURL:       publicURL,
+		TimeMapHandler:  &TimeMapHandler{Log: log, SeedService: seedService, PublicURL: publicURL},
+		TimeGateHandler: &TimeGateHandler{Log: log, SeedService: seedService, PublicURL: publicURL},
+	}
+}
+
+// The routes are in PrefixRoutes, ServeMux would break the URLs in paths.
+func (handler *MementoHandler) Routes(mux *http.ServeMux) {}
+
+func (handler *MementoHandler) PrefixRoutes() map[string]http.Handler {
+	return map[string]http.Handler{
+		TimeMapPrefix:  handler.TimeMapHandler,
+		TimeGatePrefix: handler.TimeGateHandler,
+	}
+}
+
+// Matches scheme with missing or extra slashes, some clients and proxies collapse "//" in paths.
+var schemeSlashes = regexp.MustCompile(`^(?i)(https?):/*`)
+
+// The original URL from the path after the prefix. The query belongs to the original URL too.
+// Returns the URL cleaned the same way as seed URLs, so it matches the stored seeds.
+func originalURL(seedService *services.SeedService, r *http.Request, prefix string) (string, error) {
+	raw := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	if r.URL.RawQuery != "" {
+		raw += "?" + r.URL.RawQuery
+	}
+	// Clients may send the whole URL escaped, for example https%3A%2F%2Fexample.com%2F.
+	if !strings.Contains(raw, ":/") {
+		if unescaped, err := url.PathUnescape(raw); err == nil {
+			raw = unescaped
+		}
+	}
+	raw = schemeSlashes.ReplaceAllString(raw, "$1://")
+	return seedService.ValidateURL(r.Context(), raw)
+}
+
+// Base of absolute links to the server.
+func baseURL(publicURL *url.URL, r *http.Request) string {
+	if publicURL != nil {
+		return strings.TrimSuffix(publicURL.String(), "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Links to the memento with first/last relation added. mementos must be sorted oldest first.
+func mementoLink(mementos []*entities.Memento, index int) *mementoformat.Link {
+	rel := make([]string, 0, 3)
+	if index == 0 {
+		rel = append(rel, mementoformat.RelFirst)
+	}
+	if index == len(mementos)-1 {
+		rel = append(rel, mementoformat.RelLast)
+	}
+	rel = append(rel, mementoformat.RelMemento)
+	return &mementoformat.Link{
+		URL:    mementos[index].URL,
+		Rel:    rel,
+		Params: map[string]string{"datetime": mementoformat.FormatDatetime(mementos[index].Datetime)},
+	}
+}
+
+// Only GET and HEAD make sense for Memento endpoints.
+func allowMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
@@ -0,0 +1,72 @@
+package memento
+
+import (
+	mementoformat "jinovatka/memento"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Redirects to the memento closest to Accept-Datetime, or to the latest one without it (RFC 7089 section 4.2, pattern 2.3).
+type TimeGateHandler struct {
+	Log         *slog.Logger
+	SeedService *services.SeedService
+	PublicURL   *url.URL
+}
+
+func (handler *TimeGateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r) {
+		return
+	}
+	// The response depends on the header, even if it is missing or invalid.
+	w.Header().Set("Vary", "accept-datetime")
+	original, err := originalURL(handler.SeedService, r, TimeGatePrefix)
+	if err != nil {
+		handler.Log.Warn("TimeGateHandler.ServeHTTP recieved invalid URL", "error", err.Error(), utils.LogRequestInfo(r))
+		http.Error(w, "invalid original URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	datetime := time.Now()
+	if header := r.Header.Get(mementoformat.AcceptDatetimeHeader); header != "" {
+		datetime, err = mementoformat.ParseDatetime(header)
+		if err != nil {
+			http.Error(w, "invalid "+mementoformat.AcceptDatetimeHeader+" header, use format like "+mementoformat.FormatDatetime(time.Unix(0, 0)), http.StatusBadRequest)
+			return
+		}
+	}
+	mementos, err := handler.SeedService.FindMementos(original)
+	if err != nil {
+		handler.Log.Error("TimeGateHandler.ServeHTTP failed to find mementos", "error", err.Error(), utils.LogRequestInfo(r))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	closest := services.ClosestMemento(mementos, datetime)
+	if closest == nil {
+		http.Error(w, "no mementos of "+original, http.StatusNotFound)
+		return
+	}
+
+	base := baseURL(handler.PublicURL, r)
+	links := []*mementoformat.Link{
+		{URL: original, Rel: []string{mementoformat.RelOriginal}},
+		{URL: base + TimeMapPrefix + original, Rel: []string{mementoformat.RelTimeMap}, Params: map[string]string{"type": mementoformat.LinkFormat}},
+	}
+	// First, last and the selected memento. They may be the same one.
+	for i, memento := range mementos {
+		if i == 0 || i == len(mementos)-1 || memento == closest {
+			links = append(links, mementoLink(mementos, i))
+		}
+	}
+	linkValues := make([]string, 0, len(links))
+	for _, link := range links {
+		linkValues = append(linkValues, link.String())
+	}
+	w.Header().Set("Link", strings.Join(linkValues, ", "))
+	w.Header().Set("Location", closest.URL)
+	w.WriteHeader(http.StatusFound)
+	handler.Log.Info("TimeGateHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
@@ -0,0 +1,65 @@
+package memento
+
+import (
+	mementoformat "jinovatka/memento"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// Serves link-format TimeMap of the original URL (RFC 7089 section 5).
+type TimeMapHandler struct {
+	Log         *slog.Logger
+	SeedService *services.SeedService
+	PublicURL   *url.URL
+}
+
+func (handler *TimeMapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r) {
+		return
+	}
+	original, err := originalURL(handler.SeedService, r, TimeMapPrefix)
+	if err != nil {
+		handler.Log.Warn("TimeMapHandler.ServeHTTP recieved invalid URL", "error", err.Error(), utils.LogRequestInfo(r))
+		http.Error(w, "invalid original URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	mementos, err := handler.SeedService.FindMementos(original)
+	if err != nil {
+		handler.Log.Error("TimeMapHandler.ServeHTTP failed to find mementos", "error", err.Error(), utils.LogRequestInfo(r))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(mementos) == 0 {
+		http.Error(w, "no mementos of "+original, http.StatusNotFound)
+		return
+	}
+
+	base := baseURL(handler.PublicURL, r)
+	links := make([]*mementoformat.Link, 0, len(mementos)+3)
+	links = append(links,
+		&mementoformat.Link{URL: original, Rel: []string{mementoformat.RelOriginal}},
+		&mementoformat.Link{
+			URL: base + TimeMapPrefix + original,
+			Rel: []string{"self"},
+			Params: map[string]string{
+				"type":  mementoformat.LinkFormat,
+				"from":  mementoformat.FormatDatetime(mementos[0].Datetime),
+				"until": mementoformat.FormatDatetime(mementos[len(mementos)-1].Datetime),
+			},
+		},
+		&mementoformat.Link{URL: base + TimeGatePrefix + original, Rel: []string{mementoformat.RelTimeGate}},
+	)
+	for i := range mementos {
+		links = append(links, mementoLink(mementos, i))
+	}
+
+	w.Header().Set(utils.ContentType, mementoformat.LinkFormat)
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write([]byte(mementoformat.FormatLinks(links)))
+	}
+	handler.Log.Info("TimeMapHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
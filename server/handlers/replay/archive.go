@@ -0,0 +1,50 @@
+package replay
+
+import (
+	"jinovatka/assert"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Serves the WACZ file of the seed. Range requests are supported, the viewer reads only the parts it needs.
+type ReplayArchiveHandler struct {
+	Log           *slog.Logger
+	SeedService   *services.SeedService
+	ReplayService *services.ReplayService
+	ErrorHandler  *httperror.ErrorHandler
+}
+
+func NewReplayArchiveHandler(log *slog.Logger, seedService *services.SeedService, replayService *services.ReplayService, errorHandler *httperror.ErrorHandler) *ReplayArchiveHandler {
+	assert.Must(log != nil, "NewReplayArchiveHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewReplayArchiveHandler: seedService can't be nil")
+	assert.Must(replayService != nil, "NewReplayArchiveHandler: replayService can't be nil")
+	assert.Must(errorHandler != nil, "NewReplayArchiveHandler: errorHandler can't be nil")
+	return &ReplayArchiveHandler{
+		Log:           log,
+		SeedService:   seedService,
+		ReplayService: replayService,
+		ErrorHandler:  errorHandler,
+	}
+}
+
+func (handler *ReplayArchiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	seed, file, ok := openReplayFile(handler.Log, handler.SeedService, handler.ReplayService, handler.ErrorHandler, w, r)
+	if !ok {
+		return
+	}
+	defer file.Content.Close()
+
+	header := w.Header()
+	header.Set(utils.ContentType, "application/zip")
+	// The file is replaced by newer capture, ServeContent checks the modification time.
+	header.Set("Cache-Control", "no-cache")
+	if r.URL.Query().Has("download") {
+		header.Set("Content-Disposition", `attachment; filename="`+seed.ShadowID+`.wacz"`)
+	}
+	// ServeContent handles Range, If-Range and If-Modified-Since.
+	http.ServeContent(w, r, file.Info.Key, file.Info.ModTime, file.Content)
+	handler.Log.Info("ReplayArchiveHandler.ServeHTTP sucessfully responded", "range", r.Header.Get("Range"), utils.LogRequestInfo(r))
+}
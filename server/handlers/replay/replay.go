@@ -0,0 +1,141 @@
+package replay
+
+import (
+	"errors"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/server/components"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Path of the ReplayWeb.page files on the replay origin. The viewer is told to look for its service worker here.
+const ReplayBase = "/replay/"
+
+// Replay of the WACZ files of seeds in embedded ReplayWeb.page viewer.
+// The viewer runs scripts of archived pages, so it is served from the replay origin (see config.ReplayConfig)
+// and the page of the application only embeds it in iframe.
+type ReplayHandler struct {
+	Log           *slog.Logger
+	SeedService   *services.SeedService
+	ReplayService *services.ReplayService
+	ErrorHandler  *httperror.ErrorHandler
+
+	// Subhandlers
+	ReplayArchiveHandler *ReplayArchiveHandler
+	ReplayViewerHandler  *ReplayViewerHandler
+}
+
+func NewReplayHandler(log *slog.Logger, seedService *services.SeedService, replayService *services.ReplayService, errorHandler *httperror.ErrorHandler) *ReplayHandler {
+	assert.Must(log != nil, "NewReplayHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewReplayHandler: seedService can't be nil")
+	assert.Must(replayService != nil, "NewReplayHandler: replayService can't be nil")
+	assert.Must(errorHandler != nil, "NewReplayHandler: errorHandler can't be nil")
+	return &ReplayHandler{
+		Log:                  log,
+		SeedService:          seedService,
+		ReplayService:        replayService,
+		ErrorHandler:         errorHandler,
+		ReplayArchiveHandler: NewReplayArchiveHandler(log, seedService, replayService, errorHandler),
+		ReplayViewerHandler:  NewReplayViewerHandler(log, seedService, replayService, errorHandler),
+	}
+}
+
+func (handler *ReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	seed, file, ok := openReplayFile(handler.Log, handler.SeedService, handler.ReplayService, handler.ErrorHandler, w, r)
+	if !ok {
+		return
+	}
+	_ = file.Content.Close() // Only the existence and the capture time are needed here.
+
+	data := &components.ReplayViewData{
+		Title:      "Přehrání záznamu - " + seed.URL,
+		Seed:       seed,
+		ArchiveURL: ArchiveURL(seed.ShadowID),
+		ViewerURL:  handler.ReplayService.Origin.JoinPath(ViewerURL(seed.ShadowID)).String(),
+	}
+	if file.Capture != nil {
+		data.CapturedAt = file.Capture.CapturedAt
+	}
+	err := handler.View(w, r, data)
+	if err != nil {
+		handler.Log.Error("ReplayHandler.ServeHTTP failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
+		return
+	}
+	handler.Log.Info("ReplayHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+func (handler *ReplayHandler) View(w http.ResponseWriter, r *http.Request, data *components.ReplayViewData) error {
+	return components.ReplayView(data).Render(r.Context(), w)
+}
+
+func (handler *ReplayHandler) Routes(mux *http.ServeMux) {
+	mux.Handle("GET /seed/{id}/replay", handler)
+	mux.Handle("GET /seed/{id}/replay/archive.wacz", handler.ReplayArchiveHandler)
+	handler.ReplayViewerHandler.Routes(mux)
+}
+
+// Path of the replay page of the seed.
+func ReplayURL(shadowID string) string {
+	return "/seed/" + shadowID + "/replay"
+}
+
+// Path of the WACZ file of the seed.
+func ArchiveURL(shadowID string) string {
+	return ReplayURL(shadowID) + "/archive.wacz"
+}
+
+// Path of the viewer of the seed on the replay origin.
+func ViewerURL(shadowID string) string {
+	return ReplayBase + "seed/" + shadowID
+}
+
+// Path of the WACZ file of the seed on the replay origin. The viewer can only read files from its own origin.
+func ViewerArchiveURL(shadowID string) string {
+	return ViewerURL(shadowID) + "/archive.wacz"
+}
+
+// Fetch the seed requested by the path value "id" and open its WACZ. Writes error page and returns false if that fails.
+// The caller must close the file.
+func openReplayFile(
+	log *slog.Logger,
+	seedService *services.SeedService,
+	replayService *services.ReplayService,
+	errorHandler *httperror.ErrorHandler,
+	w http.ResponseWriter,
+	r *http.Request,
+) (*entities.Seed, *services.ReplayFile, bool) {
+	if !replayService.Enabled() {
+		errorHandler.PageNotFound(w, r)
+		return nil, nil, false
+	}
+	seed, err := seedService.GetSeed(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warn("replay.openReplayFile seed not found", "error", err.Error(), utils.LogRequestInfo(r))
+		errorHandler.PageNotFound(w, r)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Error("replay.openReplayFile failed to get Seed data from SeedService", "error", err.Error(), utils.LogRequestInfo(r))
+		errorHandler.InternalServerError(w, r)
+		return nil, nil, false
+	}
+	file, err := replayService.Open(r.Context(), seed)
+	if errors.Is(err, services.ErrNoReplayFile) {
+		log.Warn("replay.openReplayFile WACZ not found", "seed", seed.ShadowID, utils.LogRequestInfo(r))
+		errorHandler.ServeError(w, r, "", http.StatusNotFound, "Záznam není k dispozici",
+			"Soubor se záznamem tohoto semínka nebyl nalezen. Pokud sklizeň ještě probíhá, zkuste to prosím za chvíli znovu.")
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Error("replay.openReplayFile failed to open WACZ", "error", err.Error(), utils.LogRequestInfo(r))
+		errorHandler.InternalServerError(w, r)
+		return nil, nil, false
+	}
+	return seed, file, true
+}
@@ -0,0 +1,86 @@
+package replay
+
+import (
+	"jinovatka/assert"
+	"jinovatka/server/components"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// Serves the ReplayWeb.page viewer on the replay origin. Requests for the replay host are answered only by this handler,
+// so scripts of archived pages running in the viewer can't reach the rest of the application.
+type ReplayViewerHandler struct {
+	Log           *slog.Logger
+	SeedService   *services.SeedService
+	ReplayService *services.ReplayService
+	ErrorHandler  *httperror.ErrorHandler
+
+	// Subhandlers
+	ReplayArchiveHandler *ReplayArchiveHandler
+}
+
+func NewReplayViewerHandler(log *slog.Logger, seedService *services.SeedService, replayService *services.ReplayService, errorHandler *httperror.ErrorHandler) *ReplayViewerHandler {
+	assert.Must(log != nil, "NewReplayViewerHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewReplayViewerHandler: seedService can't be nil")
+	assert.Must(replayService != nil, "NewReplayViewerHandler: replayService can't be nil")
+	assert.Must(errorHandler != nil, "NewReplayViewerHandler: errorHandler can't be nil")
+	return &ReplayViewerHandler{
+		Log:                  log,
+		SeedService:          seedService,
+		ReplayService:        replayService,
+		ErrorHandler:         errorHandler,
+		ReplayArchiveHandler: NewReplayArchiveHandler(log, seedService, replayService, errorHandler),
+	}
+}
+
+func (handler *ReplayViewerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	seed, file, ok := openReplayFile(handler.Log, handler.SeedService, handler.ReplayService, handler.ErrorHandler, w, r)
+	if !ok {
+		return
+	}
+	_ = file.Content.Close() // Only the existence and the capture time are needed here.
+
+	data := &components.ReplayViewerData{
+		Title:      "Přehrání záznamu - " + seed.URL,
+		Seed:       seed,
+		ArchiveURL: ViewerArchiveURL(seed.ShadowID),
+		ReplayBase: ReplayBase,
+	}
+	if file.Capture != nil {
+		data.CapturedAt = file.Capture.CapturedAt
+	}
+	err := components.ReplayViewerPage(data).Render(r.Context(), w)
+	if err != nil {
+		handler.Log.Error("ReplayViewerHandler.ServeHTTP failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
+		return
+	}
+	handler.Log.Info("ReplayViewerHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Serves the vendored ReplayWeb.page files.
+func (handler *ReplayViewerHandler) ServeFile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("file")
+	if !handler.ReplayService.Enabled() || !slices.Contains(services.ReplayViewerFiles, name) {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFileFS(w, r, handler.ReplayService.Viewer, name)
+	handler.Log.Info("ReplayViewerHandler.ServeFile responded", utils.LogRequestInfo(r))
+}
+
+// Registers the routes only for the host of the replay origin. Without the origin replay is disabled and nothing is registered.
+func (handler *ReplayViewerHandler) Routes(mux *http.ServeMux) {
+	if handler.ReplayService.Origin == nil {
+		return
+	}
+	host := handler.ReplayService.Origin.Hostname()
+	// Everything else on the replay host is refused. Routes with host win over the routes of the application.
+	mux.HandleFunc(host+"/", http.NotFound)
+	mux.Handle("GET "+host+ViewerURL("{id}"), handler)
+	mux.Handle("GET "+host+ViewerArchiveURL("{id}"), handler.ReplayArchiveHandler)
+	mux.HandleFunc("GET "+host+ReplayBase+"{file}", handler.ServeFile)
+}
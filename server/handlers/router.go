@@ -3,6 +3,7 @@ package handlers
 import (
 	"jinovatka/assert"
 	"net/http"
+	"strings"
 )
 
 // Serves as default handler intended to be passed directly to server.
@@ -10,11 +11,14 @@ import (
 type RouterHandler struct {
 	// Mux shared among the handlers
 	Mux *http.ServeMux
+	// Handlers of path prefixes from PrefixHandler. They get the requests before Mux.
+	Prefixes map[string]http.Handler
 }
 
 func NewRouterHandler(mux *http.ServeMux) *RouterHandler {
 	return &RouterHandler{
-		Mux: mux,
+		Mux:      mux,
+		Prefixes: make(map[string]http.Handler),
 	}
 }
 
@@ -24,13 +28,37 @@ func (router *RouterHandler) AddHandlers(handlers ...Handler) {
 	assert.Must(router.Mux != nil, "RouterHandler.AddHandlers: router.Mux can't be nil; only use routers created by NewRouterHandler function")
 	for _, handler := range handlers {
 		handler.Routes(router.Mux)
+		if prefixHandler, ok := handler.(PrefixHandler); ok {
+			for prefix, handler := range prefixHandler.PrefixRoutes() {
+				assert.Must(strings.HasPrefix(prefix, "/") && strings.HasSuffix(prefix, "/"), "RouterHandler.AddHandlers: prefix must start and end with /, got "+prefix)
+				router.Prefixes[prefix] = handler
+			}
+		}
 	}
 }
 
 func (router *RouterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Hosts with their own routes (the replay origin) are served only by them.
+	if _, pattern := router.Mux.Handler(r); !isHostPattern(pattern) {
+		for prefix, handler := range router.Prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
 	router.Mux.ServeHTTP(w, r)
 }
 
+// ServeMux patterns are "[METHOD ][HOST]/[PATH]".
+func isHostPattern(pattern string) bool {
+	_, path, found := strings.Cut(pattern, " ")
+	if !found {
+		path = pattern
+	}
+	return path != "" && !strings.HasPrefix(path, "/")
+}
+
 // Handlers implementing this interface can have it's routes added to router.
 // Use the http.Hanlder interface in cases when the ServeHTTP method is necessary.
 type Handler interface {
@@ -39,3 +67,10 @@ type Handler interface {
 	// This should result in a tree of handlers. Names of the routes should reflect this.
 	Routes(*http.ServeMux)
 }
+
+// Handlers that need the request path exactly as it was sent can implement this interface.
+// ServeMux cleans the paths (for example "//" becomes "/"), that breaks URLs embedded in paths like /timegate/https://example.com/.
+type PrefixHandler interface {
+	// Handlers of all requests with path starting with the prefix. Methods are not checked.
+	PrefixRoutes() map[string]http.Handler
+}
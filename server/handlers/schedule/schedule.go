@@ -0,0 +1,131 @@
+package schedule
+
+import (
+	"errors"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/server/components"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Handler for setting and cancelling schedules of repeated captures of groups and seeds.
+type ScheduleHandler struct {
+	Log             *slog.Logger
+	SeedService     *services.SeedService
+	ScheduleService *services.ScheduleService
+	ErrorHandler    *httperror.ErrorHandler
+}
+
+func NewScheduleHandler(
+	log *slog.Logger,
+	seedService *services.SeedService,
+	scheduleService *services.ScheduleService,
+	errorHandler *httperror.ErrorHandler,
+) *ScheduleHandler {
+	assert.Must(log != nil, "NewScheduleHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewScheduleHandler: seedService can't be nil")
+	assert.Must(scheduleService != nil, "NewScheduleHandler: scheduleService can't be nil")
+	assert.Must(errorHandler != nil, "NewScheduleHandler: errorHandler can't be nil")
+	return &ScheduleHandler{
+		Log:             log,
+		SeedService:     seedService,
+		ScheduleService: scheduleService,
+		ErrorHandler:    errorHandler,
+	}
+}
+
+// Names of the form values.
+const (
+	actionKey = "action"
+	kindKey   = "kind"
+	startKey  = "start"
+	cronKey   = "cron"
+
+	cancelAction = "cancel"
+)
+
+func (handler *ScheduleHandler) ServeGroup(w http.ResponseWriter, r *http.Request) {
+	groupID := r.PathValue("id")
+	_, err := handler.SeedService.GetGroup(groupID)
+	if !handler.checkFound(w, r, err) {
+		return
+	}
+	schedule := &entities.Schedule{GroupShadowID: groupID}
+	if r.FormValue(actionKey) == cancelAction {
+		err = handler.ScheduleService.CancelGroupSchedule(groupID)
+	} else {
+		err = handler.set(schedule, r)
+	}
+	handler.respond(w, r, err, "/seeds/"+groupID)
+}
+
+func (handler *ScheduleHandler) ServeSeed(w http.ResponseWriter, r *http.Request) {
+	seedID := r.PathValue("id")
+	_, err := handler.SeedService.GetSeed(seedID)
+	if !handler.checkFound(w, r, err) {
+		return
+	}
+	schedule := &entities.Schedule{SeedShadowID: seedID}
+	if r.FormValue(actionKey) == cancelAction {
+		err = handler.ScheduleService.CancelSeedSchedule(seedID)
+	} else {
+		err = handler.set(schedule, r)
+	}
+	handler.respond(w, r, err, "/seed/"+seedID)
+}
+
+// Fill the schedule from the form and save it.
+func (handler *ScheduleHandler) set(schedule *entities.Schedule, r *http.Request) error {
+	start, err := time.ParseInLocation(components.ScheduleInputFormat, r.FormValue(startKey), handler.ScheduleService.Location)
+	if err != nil {
+		return errors.Join(services.ErrInvalidSchedule, err)
+	}
+	schedule.Kind = entities.ScheduleKind(r.FormValue(kindKey))
+	schedule.Start = start
+	schedule.Cron = strings.TrimSpace(r.FormValue(cronKey))
+	return handler.ScheduleService.SetSchedule(schedule)
+}
+
+// Returns false if the response was already written.
+func (handler *ScheduleHandler) checkFound(w http.ResponseWriter, r *http.Request, err error) bool {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handler.Log.Warn("ScheduleHandler.checkFound group or seed not found", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.PageNotFound(w, r)
+		return false
+	}
+	if err != nil {
+		handler.Log.Error("ScheduleHandler.checkFound failed to fetch group or seed", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return false
+	}
+	return true
+}
+
+func (handler *ScheduleHandler) respond(w http.ResponseWriter, r *http.Request, err error, redirect string) {
+	if errors.Is(err, services.ErrInvalidSchedule) {
+		handler.Log.Warn("ScheduleHandler.respond recieved invalid schedule", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusBadRequest, "Neplatný plán sklizní",
+			"Plán se nepodařilo uložit. Zkontrolujte prosím začátek a u opakování podle výrazu cron i samotný výraz. Začátek jednorázové sklizně musí být v budoucnosti.")
+		return
+	}
+	if err != nil {
+		handler.Log.Error("ScheduleHandler.respond failed to save schedule", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+	handler.Log.Info("ScheduleHandler.respond sucessfully responded", utils.LogRequestInfo(r))
+}
+
+func (handler *ScheduleHandler) Routes(mux *http.ServeMux) {
+	mux.Handle("POST /seeds/schedule/{id}", http.HandlerFunc(handler.ServeGroup))
+	mux.Handle("POST /seed/{id}/schedule", http.HandlerFunc(handler.ServeSeed))
+}
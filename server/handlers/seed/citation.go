@@ -0,0 +1,88 @@
+package seed
+
+import (
+	"errors"
+	"jinovatka/assert"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Names of the citation query values.
+const (
+	styleKey    = "style"
+	templateKey = "template"
+	downloadKey = "download"
+)
+
+// Serves citation of the seed as text. The style is selected by "style" query value, "template" replaces the template
+// of the style and with "download" the citation is sent as file.
+type SeedCitationHandler struct {
+	Log             *slog.Logger
+	SeedService     *services.SeedService
+	CitationService *services.CitationService
+	ErrorHandler    *httperror.ErrorHandler
+}
+
+func NewSeedCitationHandler(log *slog.Logger, seedService *services.SeedService, citationService *services.CitationService, errorHandler *httperror.ErrorHandler) *SeedCitationHandler {
+	assert.Must(log != nil, "NewSeedCitationHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewSeedCitationHandler: seedService can't be nil")
+	assert.Must(citationService != nil, "NewSeedCitationHandler: citationService can't be nil")
+	assert.Must(errorHandler != nil, "NewSeedCitationHandler: errorHandler can't be nil")
+	return &SeedCitationHandler{
+		Log:             log,
+		SeedService:     seedService,
+		CitationService: citationService,
+		ErrorHandler:    errorHandler,
+	}
+}
+
+func (handler *SeedCitationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	style, err := handler.CitationService.Style(query.Get(styleKey))
+	if err != nil {
+		handler.Log.Warn("SeedCitationHandler.ServeHTTP recieved unknown style", "style", query.Get(styleKey), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusBadRequest, "Neznámý citační styl", "Požadovaný citační styl není podporován. Vyberte prosím jeden ze stylů na stránce semínka.")
+		return
+	}
+	seed, err := handler.SeedService.GetSeed(r.PathValue("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handler.Log.Warn("SeedCitationHandler.ServeHTTP seed not found", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.PageNotFound(w, r)
+		return
+	}
+	if err != nil {
+		handler.Log.Error("SeedCitationHandler.ServeHTTP failed to get Seed data from SeedService", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	citation, err := handler.CitationService.CiteSeed(seed, style.Name, query.Get(templateKey), time.Now())
+	if errors.Is(err, services.ErrInvalidCitationTemplate) {
+		handler.Log.Warn("SeedCitationHandler.ServeHTTP recieved invalid template", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusBadRequest, "Neplatná šablona citace", "Šablonu se nepodařilo použít: "+err.Error())
+		return
+	}
+	if err != nil {
+		handler.Log.Error("SeedCitationHandler.ServeHTTP failed to create citation", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+
+	header := w.Header()
+	if query.Has(downloadKey) {
+		header.Set(utils.ContentType, style.ContentType)
+		filename := "citace-" + seed.ShadowID + "." + style.Extension
+		header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	} else {
+		// Show the citation in the browser, whatever the style is.
+		header.Set(utils.ContentType, "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(citation))
+	handler.Log.Info("SeedCitationHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
@@ -0,0 +1,130 @@
+package seed
+
+import (
+	"errors"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/server/components"
+	"jinovatka/server/handlers/httperror"
+	"jinovatka/services"
+	"jinovatka/utils"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Names of the diff query values.
+const (
+	oldKey = "old"
+	newKey = "new"
+)
+
+// Serves diff of the main text of two captures of the seed. The captures are selected by their IDs in "old" and "new"
+// query values. Without them the latest compared capture is shown with the capture it was compared with.
+type SeedDiffHandler struct {
+	Log           *slog.Logger
+	SeedService   *services.SeedService
+	ChangeService *services.ChangeService
+	ErrorHandler  *httperror.ErrorHandler
+}
+
+func NewSeedDiffHandler(log *slog.Logger, seedService *services.SeedService, changeService *services.ChangeService, errorHandler *httperror.ErrorHandler) *SeedDiffHandler {
+	assert.Must(log != nil, "NewSeedDiffHandler: log can't be nil")
+	assert.Must(seedService != nil, "NewSeedDiffHandler: seedService can't be nil")
+	assert.Must(changeService != nil, "NewSeedDiffHandler: changeService can't be nil")
+	assert.Must(errorHandler != nil, "NewSeedDiffHandler: errorHandler can't be nil")
+	return &SeedDiffHandler{
+		Log:           log,
+		SeedService:   seedService,
+		ChangeService: changeService,
+		ErrorHandler:  errorHandler,
+	}
+}
+
+func (handler *SeedDiffHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestedID := r.PathValue("id")
+	seed, err := handler.SeedService.GetSeed(requestedID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		handler.Log.Warn("SeedDiffHandler.ServeHTTP seed not found", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.PageNotFound(w, r)
+		return
+	}
+	if err != nil {
+		handler.Log.Error("SeedDiffHandler.ServeHTTP failed to get Seed data from SeedService", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	captures, err := handler.SeedService.GetCaptures(requestedID)
+	if err != nil {
+		handler.Log.Error("SeedDiffHandler.ServeHTTP failed to get captures from SeedService", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	old, new := selectCaptures(captures, r)
+	if old == nil || new == nil {
+		handler.Log.Warn("SeedDiffHandler.ServeHTTP captures not found", "old", r.URL.Query().Get(oldKey), "new", r.URL.Query().Get(newKey), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusNotFound, "Sklizně nenalezeny", "Semínko nemá sklizně, které by šlo porovnat. Porovnat lze úspěšné sklizně ze stránky semínka.")
+		return
+	}
+	comparison, err := handler.ChangeService.Compare(r.Context(), old, new)
+	if errors.Is(err, services.ErrTextUnavailable) || errors.Is(err, services.ErrArtifactsDisabled) {
+		handler.Log.Warn("SeedDiffHandler.ServeHTTP can't read captures", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.ServeError(w, r, "", http.StatusNotFound, "Sklizně nelze porovnat", "Soubor jedné ze sklizní chybí nebo je poškozený.")
+		return
+	}
+	if err != nil {
+		handler.Log.Error("SeedDiffHandler.ServeHTTP failed to compare captures", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	data := &components.DiffViewData{
+		Title:    "Změny semínka - " + seed.URL,
+		Seed:     seed,
+		Old:      comparison.Old,
+		New:      comparison.New,
+		Changed:  comparison.Changed,
+		IsText:   comparison.IsText,
+		Hunks:    comparison.Hunks,
+		Inserted: comparison.Inserted,
+		Deleted:  comparison.Deleted,
+	}
+	err = handler.View(w, r, data)
+	if err != nil {
+		handler.Log.Error("SeedDiffHandler.ServeHTTP failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
+		return
+	}
+	handler.Log.Info("SeedDiffHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
+}
+
+// Captures selected by the query values, or the latest compared capture and its previous capture.
+// Only successful captures of the seed can be selected. Returns nils if they don't exist.
+func selectCaptures(captures []*entities.SeedCapture, r *http.Request) (*entities.SeedCapture, *entities.SeedCapture) {
+	byID := make(map[uint]*entities.SeedCapture, len(captures))
+	for _, capture := range captures {
+		if capture.State == entities.DoneSuccess && capture.WaczKey != "" {
+			byID[capture.ID] = capture
+		}
+	}
+	query := r.URL.Query()
+	if !query.Has(oldKey) && !query.Has(newKey) {
+		// Captures are sorted newest first.
+		for _, capture := range captures {
+			if byID[capture.ID] != nil && capture.PreviousCaptureID != 0 {
+				return byID[capture.PreviousCaptureID], capture
+			}
+		}
+		return nil, nil
+	}
+	oldID, oldErr := strconv.ParseUint(query.Get(oldKey), 10, 0)
+	newID, newErr := strconv.ParseUint(query.Get(newKey), 10, 0)
+	if oldErr != nil || newErr != nil {
+		return nil, nil
+	}
+	return byID[uint(oldID)], byID[uint(newID)]
+}
+
+func (handler *SeedDiffHandler) View(w http.ResponseWriter, r *http.Request, data *components.DiffViewData) error {
+	return components.DiffView(data).Render(r.Context(), w)
+}
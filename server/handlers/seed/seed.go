@@ -1,32 +1,64 @@
 package seed
 
 import (
+	"context"
 	"errors"
 	"jinovatka/assert"
+	"jinovatka/entities"
 	"jinovatka/server/components"
 	"jinovatka/server/handlers/httperror"
+	"jinovatka/server/handlers/replay"
 	"jinovatka/services"
 	"jinovatka/utils"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type SeedHandler struct {
-	Log          *slog.Logger
-	SeedService  *services.SeedService
-	ErrorHandler *httperror.ErrorHandler
+	Log             *slog.Logger
+	SeedService     *services.SeedService
+	CitationService *services.CitationService
+	MementoService  *services.MementoService
+	ReplayService   *services.ReplayService
+	ScheduleService *services.ScheduleService
+	ErrorHandler    *httperror.ErrorHandler
+
+	// Subhandlers
+	SeedCitationHandler *SeedCitationHandler
+	SeedDiffHandler     *SeedDiffHandler
 }
 
-func NewSeedHandler(log *slog.Logger, seedService *services.SeedService, errorHandler *httperror.ErrorHandler) *SeedHandler {
+func NewSeedHandler(
+	log *slog.Logger,
+	seedService *services.SeedService,
+	citationService *services.CitationService,
+	mementoService *services.MementoService,
+	replayService *services.ReplayService,
+	scheduleService *services.ScheduleService,
+	changeService *services.ChangeService,
+	errorHandler *httperror.ErrorHandler,
+) *SeedHandler {
 	assert.Must(log != nil, "NewSeedHandler: log can't be nil")
 	assert.Must(seedService != nil, "NewSeedHandler: seedService can't be nil")
+	assert.Must(citationService != nil, "NewSeedHandler: citationService can't be nil")
+	assert.Must(mementoService != nil, "NewSeedHandler: mementoService can't be nil")
+	assert.Must(replayService != nil, "NewSeedHandler: replayService can't be nil")
+	assert.Must(scheduleService != nil, "NewSeedHandler: scheduleService can't be nil")
+	assert.Must(changeService != nil, "NewSeedHandler: changeService can't be nil")
 	assert.Must(errorHandler != nil, "NewSeedHandler: errorHandler can't be nil")
 	return &SeedHandler{
-		Log:          log,
-		SeedService:  seedService,
-		ErrorHandler: errorHandler,
+		Log:                 log,
+		SeedService:         seedService,
+		CitationService:     citationService,
+		MementoService:      mementoService,
+		ReplayService:       replayService,
+		ScheduleService:     scheduleService,
+		ErrorHandler:        errorHandler,
+		SeedCitationHandler: NewSeedCitationHandler(log, seedService, citationService, errorHandler),
+		SeedDiffHandler:     NewSeedDiffHandler(log, seedService, changeService, errorHandler),
 	}
 }
 
@@ -43,7 +75,39 @@ func (handler *SeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		handler.ErrorHandler.InternalServerError(w, r)
 		return
 	}
-	data := components.NewSeedViewData(seed, "Semínko - "+seed.URL)
+	captures, err := handler.SeedService.GetCaptures(requestedID)
+	if err != nil {
+		handler.Log.Error("SeedHandler.ServeHTTP failed to get captures from SeedService", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	citations, err := handler.citations(seed)
+	if err != nil {
+		handler.Log.Error("SeedHandler.ServeHTTP failed to create citations", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	schedule, err := handler.ScheduleService.GetSeedSchedule(requestedID)
+	if err != nil {
+		handler.Log.Error("SeedHandler.ServeHTTP failed to fetch schedule", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	runs, err := handler.ScheduleService.GetScheduleRuns(requestedID)
+	if err != nil {
+		handler.Log.Error("SeedHandler.ServeHTTP failed to fetch schedule runs", "error", err.Error(), utils.LogRequestInfo(r))
+		handler.ErrorHandler.InternalServerError(w, r)
+		return
+	}
+	data := components.NewSeedViewData(seed, captures, citations, "Semínko - "+seed.URL)
+	data.Schedule = components.NewScheduleViewData("/seed/"+requestedID+"/schedule", schedule, handler.ScheduleService.Location)
+	data.ScheduleRuns = runs
+	if handler.MementoService.TimeMapEnabled() {
+		data.Mementos = handler.mementos(r, seed)
+	}
+	if handler.ReplayService.Enabled() {
+		data.ReplayURL = handler.replayURL(r, seed)
+	}
 	err = handler.View(w, r, data)
 	if err != nil {
 		handler.Log.Error("SeedHandler.ServeHTTP failed to render view", "error", err.Error(), utils.LogRequestInfo(r))
@@ -52,10 +116,66 @@ func (handler *SeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler.Log.Info("SeedHandler.ServeHTTP sucessfully responded", utils.LogRequestInfo(r))
 }
 
+// Citations of the seed in all styles with their default templates.
+func (handler *SeedHandler) citations(seed *entities.Seed) ([]*components.SeedCitation, error) {
+	now := time.Now()
+	citations := make([]*components.SeedCitation, 0, len(handler.CitationService.Styles))
+	for _, style := range handler.CitationService.Styles {
+		text, err := handler.CitationService.CiteSeed(seed, style.Name, "", now)
+		if err != nil {
+			return nil, err
+		}
+		citations = append(citations, &components.SeedCitation{
+			Style:           style.Name,
+			Label:           style.Label,
+			Text:            text,
+			Template:        style.Template,
+			MachineReadable: style.MachineReadable,
+		})
+	}
+	return citations, nil
+}
+
+// Maximum number of mementos shown on the page. Popular pages have thousands of them.
+const maxShownMementos = 50
+
+// How long can the page wait for TimeMap. Slow archive is shown as failed rather than holding the page.
+const mementoTimeout = 3 * time.Second
+
+// Mementos of the seed in the web archive. Failure of the archive is shown on the page, it doesn't break it.
+func (handler *SeedHandler) mementos(r *http.Request, seed *entities.Seed) *components.MementoList {
+	ctx, cancel := context.WithTimeout(r.Context(), mementoTimeout)
+	defer cancel()
+	mementos, err := handler.MementoService.CachedTimeMap(ctx, seed.URL)
+	if err != nil {
+		handler.Log.Warn("SeedHandler.mementos failed to fetch TimeMap", "error", err.Error(), utils.LogRequestInfo(r))
+		return &components.MementoList{Failed: true}
+	}
+	return &components.MementoList{
+		Mementos: mementos[:min(len(mementos), maxShownMementos)],
+		Total:    len(mementos),
+	}
+}
+
+// Path of the replay page, if the WACZ of the seed exists. Empty otherwise.
+func (handler *SeedHandler) replayURL(r *http.Request, seed *entities.Seed) string {
+	file, err := handler.ReplayService.Open(r.Context(), seed)
+	if err != nil {
+		if !errors.Is(err, services.ErrNoReplayFile) {
+			handler.Log.Warn("SeedHandler.replayURL failed to open WACZ", "error", err.Error(), utils.LogRequestInfo(r))
+		}
+		return ""
+	}
+	_ = file.Content.Close()
+	return replay.ReplayURL(seed.ShadowID)
+}
+
 func (handler *SeedHandler) View(w http.ResponseWriter, r *http.Request, data *components.SeedViewData) error {
 	return components.SeedView(data).Render(r.Context(), w)
 }
 
 func (handler *SeedHandler) Routes(mux *http.ServeMux) {
 	mux.Handle("GET /seed/{id}", handler)
+	mux.Handle("GET /seed/{id}/citation", handler.SeedCitationHandler)
+	mux.Handle("GET /seed/{id}/diff", handler.SeedDiffHandler)
 }
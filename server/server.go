@@ -2,22 +2,26 @@ package server
 
 import (
 	"context"
+	"jinovatka/config"
 	"jinovatka/server/handlers"
 	"jinovatka/server/handlers/admin"
+	"jinovatka/server/handlers/api"
 	"jinovatka/server/handlers/generator"
 	"jinovatka/server/handlers/group"
 	"jinovatka/server/handlers/httperror"
 	"jinovatka/server/handlers/index"
+	"jinovatka/server/handlers/memento"
+	"jinovatka/server/handlers/replay"
+	"jinovatka/server/handlers/schedule"
 	"jinovatka/server/handlers/seed"
 	"jinovatka/server/handlers/static"
 	"jinovatka/services"
 	"log/slog"
 	"net"
 	"net/http"
-	"time"
 )
 
-func NewServer(ctx context.Context, log *slog.Logger, addr string, services *services.Services) *http.Server {
+func NewServer(ctx context.Context, log *slog.Logger, config *config.Config, services *services.Services) *http.Server {
 	// Create router
 	mux := http.NewServeMux()
 	router := handlers.NewRouterHandler(mux)
@@ -29,17 +33,22 @@ func NewServer(ctx context.Context, log *slog.Logger, addr string, services *ser
 	router.AddHandlers(
 		index.NewIndexHandler(log, errorHandler),
 		static.NewStaticHandler(log, staticFiles /* from embed.go */),
-		group.NewGroupHandler(log, services.SeedService, services.ExporterService, services.CaptureService, errorHandler),
-		admin.NewAdminHandler(log),
-		seed.NewSeedHandler(log, services.SeedService, errorHandler),
+		group.NewGroupHandler(log, services.SeedService, services.ExporterService, services.CitationService, services.CaptureService, services.ScheduleService, errorHandler, config.Server.PublicURL()),
+		admin.NewAdminHandler(log, services.SeedService, services.PolicyService, errorHandler),
+		seed.NewSeedHandler(log, services.SeedService, services.CitationService, services.MementoService, services.ReplayService, services.ScheduleService, services.ChangeService, errorHandler),
+		schedule.NewScheduleHandler(log, services.SeedService, services.ScheduleService, errorHandler),
+		replay.NewReplayHandler(log, services.SeedService, services.ReplayService, errorHandler),
 		generator.NewGeneratorHandler(log),
+		api.NewAPIHandler(log, services.SeedService, services.CaptureService),
+		memento.NewMementoHandler(log, services.SeedService, config.Server.PublicURL()),
 	)
 
 	server := &http.Server{
-		Addr:         addr,
+		Addr:         config.Server.Address,
 		Handler:      router,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		ReadTimeout:  config.Server.ReadTimeout.Duration,
+		WriteTimeout: config.Server.WriteTimeout.Duration,
+		IdleTimeout:  config.Server.IdleTimeout.Duration,
 		BaseContext:  func(l net.Listener) context.Context { return ctx },
 	}
 
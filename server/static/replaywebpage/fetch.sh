@@ -0,0 +1,17 @@
+#!/bin/sh
+# Downloads the pinned ReplayWeb.page build (ui.js and sw.js) into this directory. Commit the files after update.
+# The server serves them from the replay origin, see the replay section in README.md.
+# npm checks the package against the integrity recorded in the registry.
+set -eu
+
+VERSION=2.2.0
+
+cd "$(dirname "$0")"
+temporary=$(mktemp -d)
+trap 'rm -rf "$temporary"' EXIT
+
+npm pack --silent --pack-destination "$temporary" "replaywebpage@$VERSION" >/dev/null
+tar -xzf "$temporary/replaywebpage-$VERSION.tgz" -C "$temporary"
+cp "$temporary/package/ui.js" "$temporary/package/sw.js" .
+echo "$VERSION" >VERSION
+sha256sum ui.js sw.js
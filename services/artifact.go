@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"jinovatka/artifact"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/wacz"
+	"log/slog"
+	"strings"
+)
+
+var (
+	ErrArtifactsDisabled = errors.New("artifact storage is not configured")
+	ErrArtifactCorrupted = errors.New("artifact is corrupted")
+)
+
+// Access to the files created by captures. Storage is shared with the workers, they write and the server reads.
+type ArtifactService struct {
+	Log *slog.Logger
+	// Nil if the storage is not configured.
+	Storage artifact.Storage
+}
+
+func NewArtifactService(log *slog.Logger, storage artifact.Storage) *ArtifactService {
+	assert.Must(log != nil, "NewArtifactService: log can't be nil")
+	return &ArtifactService{
+		Log:     log,
+		Storage: storage,
+	}
+}
+
+func (service *ArtifactService) Enabled() bool {
+	return service.Storage != nil
+}
+
+// Open the artifact. The caller must close it. Returns artifact.ErrNotFound if there is no such artifact.
+func (service *ArtifactService) Open(ctx context.Context, key string) (io.ReadSeekCloser, *artifact.Info, error) {
+	if !service.Enabled() {
+		return nil, nil, ErrArtifactsDisabled
+	}
+	return service.Storage.Get(ctx, key)
+}
+
+// Fill size, hash and location of the WACZ the worker didn't report. Workers that only write the file
+// to shared directory (scoop worker) report just the key.
+func (service *ArtifactService) Describe(ctx context.Context, result *entities.CaptureResult) error {
+	if !service.Enabled() || result.WaczKey == "" || (result.WaczSize != 0 && result.WaczSHA256 != "" && result.WaczLocation != "") {
+		return nil
+	}
+	info, err := service.Storage.Stat(ctx, result.WaczKey)
+	if err != nil {
+		return fmt.Errorf("ArtifactService.Describe failed to stat %s: %w", result.WaczKey, err)
+	}
+	if result.WaczSHA256 == "" {
+		result.WaczSHA256, err = artifact.Hash(ctx, service.Storage, result.WaczKey)
+		if err != nil {
+			return fmt.Errorf("ArtifactService.Describe failed to hash %s: %w", result.WaczKey, err)
+		}
+	}
+	if result.WaczSize == 0 {
+		result.WaczSize = info.Size
+	}
+	if result.WaczLocation == "" {
+		result.WaczLocation = info.Location
+	}
+	return nil
+}
+
+// Check that the stored WACZ is the one the worker made. The content must have the expected SHA-256 (if known),
+// resources must match datapackage.json and the captured URL must be in the index (if known).
+// Returns artifact.ErrNotFound if the WACZ is missing and ErrArtifactCorrupted if it is damaged.
+// Other errors mean the check couldn't be done (storage is unavailable) and says nothing about the WACZ.
+func (service *ArtifactService) Verify(ctx context.Context, key string, expectedSHA256 string, capturedURL string, timestamp string) error {
+	if !service.Enabled() {
+		return ErrArtifactsDisabled
+	}
+	if expectedSHA256 != "" {
+		actual, err := artifact.Rehash(ctx, service.Storage, key)
+		if err != nil {
+			return fmt.Errorf("ArtifactService.Verify failed to hash %s: %w", key, err)
+		}
+		if !strings.EqualFold(actual, expectedSHA256) {
+			return fmt.Errorf("ArtifactService.Verify: %w: %s has SHA-256 %s, expected %s", ErrArtifactCorrupted, key, actual, expectedSHA256)
+		}
+	}
+	content, info, err := service.Storage.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("ArtifactService.Verify failed to open %s: %w", key, err)
+	}
+	defer content.Close()
+	archive, err := wacz.Open(artifact.ReaderAt(content), info.Size)
+	if err == nil {
+		err = archive.Validate()
+	}
+	if err == nil && capturedURL != "" && timestamp != "" {
+		_, err = archive.FindCapture(capturedURL, timestamp)
+	}
+	if errors.Is(err, wacz.ErrInvalidWACZ) || errors.Is(err, wacz.ErrNotInIndex) {
+		return fmt.Errorf("ArtifactService.Verify: %w: %s: %w", ErrArtifactCorrupted, key, err)
+	}
+	if err != nil {
+		return fmt.Errorf("ArtifactService.Verify failed to read %s: %w", key, err)
+	}
+	return nil
+}
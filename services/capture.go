@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"jinovatka/artifact"
 	"jinovatka/assert"
 	"jinovatka/entities"
 	"jinovatka/queue"
@@ -11,48 +13,147 @@ import (
 )
 
 type CaptureService struct {
-	Log         *slog.Logger
-	Queue       queue.Queue
-	SeedService *SeedService
+	Log            *slog.Logger
+	Queue          queue.Queue
+	SeedService    *SeedService
+	MementoService *MementoService
+	// Fills WACZ details the workers didn't report.
+	ArtifactService *ArtifactService
+	// If the archive has a memento of the seed younger than this, the memento is used instead of new capture. Zero always captures.
+	SkipCaptureFresherThan time.Duration
+	// If other seed with the same URL was captured more recently than this, its capture is used. Zero always captures.
+	ReuseCaptureFresherThan time.Duration
 }
 
-func NewCaptureService(log *slog.Logger, queue queue.Queue, seedService *SeedService) *CaptureService {
+func NewCaptureService(
+	log *slog.Logger,
+	queue queue.Queue,
+	seedService *SeedService,
+	mementoService *MementoService,
+	artifactService *ArtifactService,
+	skipCaptureFresherThan,
+	reuseCaptureFresherThan time.Duration,
+) *CaptureService {
 	assert.Must(log != nil, "NewCaptureService: log can't be nil")
 	assert.Must(queue != nil, "NewCaptureService: queue can't be nil")
 	assert.Must(seedService != nil, "NewCaptureService: seedService can't be nil")
+	assert.Must(mementoService != nil, "NewCaptureService: mementoService can't be nil")
+	assert.Must(artifactService != nil, "NewCaptureService: artifactService can't be nil")
+	assert.Must(skipCaptureFresherThan == 0 || mementoService.TimeGateEnabled(), "NewCaptureService: skipCaptureFresherThan needs TimeGate")
+	assert.Must(reuseCaptureFresherThan >= 0, "NewCaptureService: reuseCaptureFresherThan can't be negative")
 	return &CaptureService{
-		Log:         log,
-		Queue:       queue,
-		SeedService: seedService,
+		Log:                     log,
+		Queue:                   queue,
+		SeedService:             seedService,
+		MementoService:          mementoService,
+		ArtifactService:         artifactService,
+		SkipCaptureFresherThan:  skipCaptureFresherThan,
+		ReuseCaptureFresherThan: reuseCaptureFresherThan,
 	}
 }
 
+// Whether CaptureSeed may use existing capture instead of capturing the seed.
+type CaptureMode int
+
+const (
+	// Recent capture of the same URL or fresh memento is used if there is one.
+	CaptureReuseRecent CaptureMode = iota
+	// The seed is always enqueued for new capture.
+	CaptureFresh
+	// The request of the last capture got lost and the seed is enqueued again. Counts as another attempt of the same capture,
+	// other modes start again from the first attempt.
+	CaptureRetry
+)
+
 // Capture all seeds in group. This will create CaptureRequests for all seeds and enqueue them for capturing.
-func (service *CaptureService) CaptureGroup(ctx context.Context, group *entities.SeedsGroup) error {
+// Failure of one seed doesn't stop the others. All errors are returned joined together.
+func (service *CaptureService) CaptureGroup(ctx context.Context, group *entities.SeedsGroup, mode CaptureMode) error {
+	var errs []error
 	for _, seed := range group.Seeds {
-		err := service.CaptureSeed(ctx, seed)
-		if err != nil {
-			// TODO: Maybe wrap this error
-			return err
-		}
-		err = service.SeedService.UpdateState(seed.ShadowID, entities.Pending)
+		err := service.CaptureSeed(ctx, seed, mode)
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
-// Capture single seed. This will create CaptureRequest and enqueue it.
-func (service *CaptureService) CaptureSeed(ctx context.Context, seed *entities.Seed) error {
+// Capture single seed. This will mark the seed as Pending, create CaptureRequest and enqueue it.
+// The seed is marked before enqueuing, so if the request gets lost, StaleSeedReaper can enqueue it again.
+// With CaptureReuseRecent, if other seed with the same URL was captured recently or the archive already has fresh memento
+// of the seed, it is recorded as the capture and nothing is enqueued.
+func (service *CaptureService) CaptureSeed(ctx context.Context, seed *entities.Seed, mode CaptureMode) error {
+	if mode == CaptureReuseRecent && service.ReuseCaptureFresherThan > 0 {
+		used, err := service.reuseRecentCapture(seed)
+		if err != nil {
+			service.Log.Warn("CaptureService.CaptureSeed failed to look for recent capture", "seedShadowID", seed.ShadowID, "error", err.Error())
+		}
+		if used {
+			return nil
+		}
+	}
+	if mode == CaptureReuseRecent && service.SkipCaptureFresherThan > 0 {
+		used, err := service.useFreshMemento(ctx, seed)
+		if err != nil {
+			// The archive may be down, capture the seed as usual.
+			service.Log.Warn("CaptureService.CaptureSeed failed to look for fresh memento", "seedShadowID", seed.ShadowID, "error", err.Error())
+		}
+		if used {
+			return nil
+		}
+	}
 	request := entities.NewRequestFromSeed(seed)
-	err := service.Queue.Enqueue(ctx, request)
+	if mode != CaptureRetry {
+		request.Attempt = 1
+	}
+	err := service.SeedService.MarkEnqueued(seed.ShadowID, request.Attempt)
+	if err != nil {
+		return fmt.Errorf("CaptureService.CaptureSeed failed to mark seed as enqueued: %w", err)
+	}
+	err = service.Queue.Enqueue(ctx, request)
 	if err != nil {
 		return fmt.Errorf("CaptureService.CaptureSeed Queue.Enqueue returned error: %w", err)
 	}
 	return nil
 }
 
+// Record the latest memento of the seed as its capture, if it is younger than SkipCaptureFresherThan.
+// Returns true if the memento was used.
+func (service *CaptureService) useFreshMemento(ctx context.Context, seed *entities.Seed) (bool, error) {
+	now := time.Now()
+	latest, err := service.MementoService.Closest(ctx, seed.URL, now)
+	if errors.Is(err, ErrNoMemento) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if now.Sub(latest.Datetime) > service.SkipCaptureFresherThan {
+		return false, nil
+	}
+	err = service.SeedService.RecordMemento(seed, latest)
+	if err != nil {
+		return false, err
+	}
+	service.Log.Info("CaptureService used fresh memento instead of capture", "seedShadowID", seed.ShadowID, "memento", latest.URL)
+	return true, nil
+}
+
+// Record the latest capture of other seed with the same URL as capture of the seed, if it is younger than ReuseCaptureFresherThan.
+// Returns true if the capture was used.
+func (service *CaptureService) reuseRecentCapture(seed *entities.Seed) (bool, error) {
+	recent, err := service.SeedService.FindReusableCapture(seed, service.ReuseCaptureFresherThan)
+	if err != nil || recent == nil {
+		return false, err
+	}
+	err = service.SeedService.RecordReusedCapture(seed, recent)
+	if err != nil {
+		return false, err
+	}
+	service.Log.Info("CaptureService reused recent capture instead of capture", "seedShadowID", seed.ShadowID, "reusedSeedShadowID", recent.SeedShadowID, "archivalURL", recent.ArchivalURL)
+	return true, nil
+}
+
 // WARNING: This function blocks indefinitely and should be run in separate goroutine.
 //
 // If timeout is zero, this function blocks until CaptureResult can be dequeued.
@@ -62,44 +163,129 @@ func (service *CaptureService) AwaitResult(ctx context.Context, timeout time.Dur
 	return service.Queue.AwaitResult(ctx, timeout)
 }
 
+// Acknowledge that the result was handled. See queue.Queue.AckResult.
+func (service *CaptureService) AckResult(ctx context.Context, result *entities.CaptureResult) error {
+	return service.Queue.AckResult(ctx, result)
+}
+
+// Shadow IDs of the seeds with requests still in the queue. See queue.Queue.QueuedSeeds.
+func (service *CaptureService) QueuedSeeds(ctx context.Context) (map[string]bool, error) {
+	return service.Queue.QueuedSeeds(ctx)
+}
+
 // Starts a new goroutine that listens for and handles CaptureResults that are being enququed from workers.
 func (service *CaptureService) ListenForResults(ctx context.Context) {
 	go service.listenForResults(ctx)
 }
 
+// How long to wait for result before trying again. Waiting with timeout gives the queue a chance to do maintenance.
+const resultPollTimeout = 30 * time.Second
+
+// Bounds of the wait after the queue failed, it doubles with every failure in a row.
+const (
+	minQueueErrorBackoff = time.Second
+	maxQueueErrorBackoff = time.Minute
+)
+
 func (service *CaptureService) listenForResults(ctx context.Context) {
+	backoff := minQueueErrorBackoff
 	// While context is not done, try fetchig next result.
 	for ctx.Err() == nil {
-		const noTimeout = 0
-		result, err := service.AwaitResult(ctx, noTimeout)
-		if err != nil {
-			service.Log.Error("CaptureService.listenForResults failed to AwaitResult", "error", err.Error())
+		result, err := service.AwaitResult(ctx, resultPollTimeout)
+		if errors.Is(err, queue.QueueTimeoutError) {
+			continue
+		}
+		if err != nil && ctx.Err() != nil {
+			// We are shutting down.
 			break
 		}
-		service.Log.Info("Got result", "shadowID", result.SeedShadowID, "done", result.Done, "errors", result.ErrorMessages)
-
-		// Update state of seed
-		var state entities.CaptureState
-		if result.Done && len(result.ErrorMessages) == 0 {
-			state = entities.DoneSuccess
-		} else if result.Done {
-			state = entities.DoneFailure
-		} else {
-			// TODO add another option
-			state = entities.NotEnqueued
+		if errors.Is(err, queue.ErrMalformedResult) {
+			// The queue dropped the result, the next one can be handled.
+			service.Log.Error("CaptureService.listenForResults dropped malformed result", "error", err.Error())
+			continue
 		}
-		err = service.SeedService.UpdateState(result.SeedShadowID, state)
 		if err != nil {
-			service.Log.Error("CaptureService.listenForResults failed to update SeedState", "error", err.Error())
-			break
+			// The queue may be unavailable for a while. Wait, so the log is not flooded, and try again.
+			service.Log.Error("CaptureService.listenForResults failed to AwaitResult", "error", err.Error(), "retryIn", backoff)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxQueueErrorBackoff)
+			continue
 		}
-		// Update seed metadata
-		if result.CaptureMetadata != nil {
-			err = service.SeedService.UpdateMetadata(result.SeedShadowID, result.CaptureMetadata)
+		backoff = minQueueErrorBackoff
+		service.Log.Info("Got result", "shadowID", result.SeedShadowID, "done", result.Done, "errors", result.ErrorMessages)
+
+		err = service.handleResult(result)
+		if err != nil {
+			// Don't acknowledge the result. The queue will deliver it again later.
+			service.Log.Error("CaptureService.listenForResults failed to handle result", "shadowID", result.SeedShadowID, "error", err.Error())
+			err = service.Queue.ReleaseResult(ctx, result)
 			if err != nil {
-				service.Log.Error("CaptureService.listenForResults failed to update seed metadata", "error", err.Error())
+				service.Log.Warn("CaptureService.listenForResults failed to release result", "shadowID", result.SeedShadowID, "error", err.Error())
 			}
+			continue
+		}
+		err = service.AckResult(ctx, result)
+		if err != nil {
+			service.Log.Error("CaptureService.listenForResults failed to acknowledge result", "shadowID", result.SeedShadowID, "error", err.Error())
 		}
 	}
-	service.Log.Info("CaptureService.listenForResults context is done", "error", ctx.Err().Error())
+	service.Log.Info("CaptureService.listenForResults context is done", "error", assert.AddErrorMessage(ctx.Err()))
+}
+
+// Store state and metadata from the result. Handling the same result more than once is harmless.
+func (service *CaptureService) handleResult(result *entities.CaptureResult) error {
+	// Successful capture is only worth something if the WACZ really holds it.
+	if result.Done && len(result.ErrorMessages) == 0 {
+		service.verifyResult(result)
+	}
+	if !result.Done {
+		// TODO add another option
+		err := service.SeedService.UpdateState(result.SeedShadowID, entities.NotEnqueued)
+		if err != nil {
+			return fmt.Errorf("CaptureService.handleResult failed to update SeedState: %w", err)
+		}
+		return nil
+	}
+	// Missing size or hash of the WACZ only makes the record less useful, the capture is still recorded.
+	err := service.ArtifactService.Describe(context.Background(), result)
+	if err != nil {
+		service.Log.Warn("CaptureService.handleResult failed to describe WACZ", "shadowID", result.SeedShadowID, "error", err.Error())
+	}
+	// Store the capture in history. This also updates the seed state, errors and archival URL in one transaction,
+	// unless newer capture was already recorded.
+	err = service.SeedService.RecordCapture(result)
+	if errors.Is(err, ErrInvalidMetadata) {
+		// Delivering the result again won't fix it.
+		service.Log.Error("CaptureService.handleResult recieved invalid metadata", "shadowID", result.SeedShadowID, "error", err.Error())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("CaptureService.handleResult failed to record capture: %w", err)
+	}
+	return nil
+}
+
+// Check the WACZ of successful result. Missing or damaged WACZ turns the result into failure.
+// If the check can't be done (storage is unavailable), the result is left as it is.
+func (service *CaptureService) verifyResult(result *entities.CaptureResult) {
+	if !service.ArtifactService.Enabled() || result.WaczKey == "" {
+		return
+	}
+	capturedURL, timestamp := "", ""
+	if result.CaptureMetadata != nil {
+		capturedURL, timestamp = result.CaptureMetadata.CapturedUrl, result.CaptureMetadata.Timestamp
+	}
+	err := service.ArtifactService.Verify(context.Background(), result.WaczKey, result.WaczSHA256, capturedURL, timestamp)
+	if errors.Is(err, artifact.ErrNotFound) || errors.Is(err, ErrArtifactCorrupted) {
+		service.Log.Error("CaptureService.verifyResult recieved invalid WACZ", "shadowID", result.SeedShadowID, "error", err.Error())
+		result.ErrorMessages = append(result.ErrorMessages, err.Error())
+		result.ErrorCategory = entities.IntegrityError
+		return
+	}
+	if err != nil {
+		service.Log.Warn("CaptureService.verifyResult failed to verify WACZ", "shadowID", result.SeedShadowID, "error", err.Error())
+	}
 }
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"jinovatka/config"
+	"jinovatka/entities"
+	memoryq "jinovatka/queue/memory"
+	"jinovatka/storage"
+	gormStorage "jinovatka/storage/gorm"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Services on temporary sqlite database with the memory queue. Host lookups and the policy file are turned off,
+// so the tests don't need network.
+func newTestServices(t *testing.T) (*Services, *memoryq.Queue) {
+	t.Helper()
+	log := slog.New(slog.DiscardHandler)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "storage.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Queue.Backend = "memory"
+	cfg.Input.RejectNonPublicHosts = false
+	cfg.Input.PolicyPath = ""
+	repository := storage.NewRepository(
+		gormStorage.NewSeedRepository(log, db),
+		gormStorage.NewCaptureRepository(log, db),
+		gormStorage.NewScheduleRepository(log, db),
+	)
+	queue := memoryq.NewQueue(log)
+	return NewServices(log, cfg, repository, queue, nil), queue
+}
+
+// Wait until the seed gets into the state, or fail the test.
+func awaitSeedState(t *testing.T, services *Services, shadowID string, state entities.CaptureState) *entities.Seed {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		seed, err := services.SeedService.GetSeed(shadowID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seed.State == state {
+			return seed
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("seed %s is %s, expected %s", shadowID, seed.State, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCaptureGroup(t *testing.T) {
+	services, queue := newTestServices(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	capturedAt := time.Date(2024, 5, 17, 12, 30, 45, 0, time.UTC)
+	queue.Serve(ctx, func(ctx context.Context, request *entities.CaptureRequest) *entities.CaptureResult {
+		if request.SeedURL == "https://failing.example/" {
+			return memoryq.FailureResult(request, "net::ERR_NAME_NOT_RESOLVED")
+		}
+		return memoryq.SuccessResult(request, capturedAt)
+	})
+	services.CaptureService.ListenForResults(ctx)
+
+	group, _, err := services.SeedService.Save(ctx, "https://example.com/\nhttps://failing.example/", true, SaveAllOrNothing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Seeds) != 2 {
+		t.Fatalf("Save stored %d seeds, expected 2", len(group.Seeds))
+	}
+	err = services.CaptureService.CaptureGroup(ctx, group, CaptureReuseRecent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, seed := range group.Seeds {
+		switch seed.URL {
+		case "https://example.com/":
+			captured := awaitSeedState(t, services, seed.ShadowID, entities.DoneSuccess)
+			expectedURL := "https://wayback.webarchiv.cz/wayback/20240517123045/https://example.com/"
+			if captured.ArchivalURL != expectedURL {
+				t.Errorf("seed has archival URL %q, expected %q", captured.ArchivalURL, expectedURL)
+			}
+			if !captured.HarvestedAt.Equal(capturedAt) {
+				t.Errorf("seed was harvested at %s, expected %s", captured.HarvestedAt, capturedAt)
+			}
+			if captured.CaptureAttempts != 1 {
+				t.Errorf("seed has %d capture attempts, expected 1", captured.CaptureAttempts)
+			}
+		case "https://failing.example/":
+			failed := awaitSeedState(t, services, seed.ShadowID, entities.DoneFailure)
+			if failed.ArchivalURL != "" || len(failed.ErrorMessages) == 0 {
+				t.Errorf("failed seed has archival URL %q and errors %v", failed.ArchivalURL, failed.ErrorMessages)
+			}
+		default:
+			t.Errorf("Save stored unexpected seed %s", seed.URL)
+		}
+		captures, err := services.SeedService.GetCaptures(seed.ShadowID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(captures) != 1 {
+			t.Errorf("seed %s has %d captures, expected 1", seed.URL, len(captures))
+		}
+	}
+}
+
+func TestCaptureResultNotDone(t *testing.T) {
+	services, queue := newTestServices(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Serve(ctx, func(ctx context.Context, request *entities.CaptureRequest) *entities.CaptureResult {
+		return &entities.CaptureResult{SeedShadowID: request.SeedShadowID, Done: false}
+	})
+	services.CaptureService.ListenForResults(ctx)
+
+	group, _, err := services.SeedService.Save(ctx, "https://example.com/", true, SaveAllOrNothing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := group.Seeds[0]
+	err = services.CaptureService.CaptureSeed(ctx, seed, CaptureFresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	awaitSeedState(t, services, seed.ShadowID, entities.NotEnqueued)
+}
+
+func TestRecordCaptureDropsUnsafeCanonicalURL(t *testing.T) {
+	services, _ := newTestServices(t)
+	group, _, err := services.SeedService.Save(context.Background(), "https://example.com/", true, SaveAllOrNothing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := group.Seeds[0]
+	tests := []struct {
+		canonicalURL string
+		expected     string
+	}{
+		{"https://example.com/canonical", "https://example.com/canonical"},
+		{"HTTP://example.com/", "HTTP://example.com/"},
+		{"javascript:alert(1)", ""},
+		{"data:text/html,<script>alert(1)</script>", ""},
+		{"//example.com/", ""},
+		{"/relative", ""},
+	}
+	for i, test := range tests {
+		capturedAt := time.Date(2024, 5, 17, 12, 30, i, 0, time.UTC)
+		request := &entities.CaptureRequest{SeedShadowID: seed.ShadowID, SeedURL: seed.URL}
+		result := memoryq.SuccessResult(request, capturedAt)
+		result.PageMetadata = &entities.PageMetadata{Title: "Example", CanonicalURL: test.canonicalURL}
+		err := services.SeedService.RecordCapture(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded, err := services.SeedService.GetSeed(seed.ShadowID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recorded.PageMetadata == nil || recorded.PageMetadata.CanonicalURL != test.expected {
+			t.Errorf("RecordCapture stored page metadata %+v for canonical URL %q, expected %q", recorded.PageMetadata, test.canonicalURL, test.expected)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"jinovatka/entities"
+	"regexp"
+	"strings"
+)
+
+// Workers report errors as plain messages. Known patterns of the messages are used to find the category of the error.
+// The first message that matches any pattern decides the category.
+var captureErrorPatterns = []struct {
+	category entities.CaptureErrorCategory
+	pattern  *regexp.Regexp
+}{
+	{entities.DNSError, regexp.MustCompile(`(?i)no such host|enotfound|eai_again|err_name_not_resolved|dns`)},
+	{entities.TimeoutError, regexp.MustCompile(`(?i)timeout|timed out|deadline exceeded|etimedout`)},
+	{entities.HTTPClientError, regexp.MustCompile(`(?i)(status|http)[ :]*4\d\d\b`)},
+	{entities.HTTPServerError, regexp.MustCompile(`(?i)(status|http)[ :]*5\d\d\b`)},
+	{entities.WriteError, regexp.MustCompile(`(?i)failed to write|enospc|no space left`)},
+	{entities.MetadataError, regexp.MustCompile(`(?i)metadata`)},
+}
+
+// Find category of the capture error from the messages reported by worker.
+// Returns NoCaptureError if there are no messages.
+func classifyCaptureErrors(messages []string) entities.CaptureErrorCategory {
+	if len(messages) == 0 {
+		return entities.NoCaptureError
+	}
+	for _, message := range messages {
+		message = strings.TrimSpace(message)
+		for _, known := range captureErrorPatterns {
+			if known.pattern.MatchString(message) {
+				return known.category
+			}
+		}
+	}
+	return entities.UnknownError
+}
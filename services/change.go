@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"jinovatka/artifact"
+	"jinovatka/assert"
+	"jinovatka/cdxj"
+	"jinovatka/entities"
+	"jinovatka/pagetext"
+	"jinovatka/textdiff"
+	"jinovatka/wacz"
+	"log/slog"
+	"time"
+)
+
+// ErrTextUnavailable is returned when the page can't be read from the WACZ of the capture.
+var ErrTextUnavailable = errors.New("text of the capture is unavailable")
+
+// Number of unchanged lines shown around changes in the diff.
+const DiffContextLines = 3
+
+// ChangeService compares successive captures of the same seed. In the background it stores hash of the main text
+// of every new capture and whether it differs from the previous capture. Diff of two captures is made on demand.
+type ChangeService struct {
+	Log             *slog.Logger
+	SeedService     *SeedService
+	ArtifactService *ArtifactService
+
+	// How often to look for captures that weren't compared yet.
+	Interval time.Duration
+	// Maximum number of captures compared in one run.
+	BatchSize int
+}
+
+func NewChangeService(
+	log *slog.Logger,
+	seedService *SeedService,
+	artifactService *ArtifactService,
+	interval time.Duration,
+	batchSize int,
+) *ChangeService {
+	assert.Must(log != nil, "NewChangeService: log can't be nil")
+	assert.Must(seedService != nil, "NewChangeService: seedService can't be nil")
+	assert.Must(artifactService != nil, "NewChangeService: artifactService can't be nil")
+	assert.Must(interval > 0, "NewChangeService: interval must be positive")
+	assert.Must(batchSize > 0, "NewChangeService: batchSize must be positive")
+	return &ChangeService{
+		Log:             log,
+		SeedService:     seedService,
+		ArtifactService: artifactService,
+		Interval:        interval,
+		BatchSize:       batchSize,
+	}
+}
+
+// Main text of the captured page.
+type PageText struct {
+	// Lines of the main text. Nil if the page is not HTML or plain text.
+	Lines []string
+	// Lowercase hex SHA-256 of the text, or of the whole body if the page is not text.
+	Hash string
+}
+
+// Comparison of two captures of the same seed.
+type CaptureComparison struct {
+	Old *entities.SeedCapture
+	New *entities.SeedCapture
+	// True if the hashes differ.
+	Changed bool
+	// False if at least one of the pages is not text, then only the hashes are compared and there are no hunks.
+	IsText bool
+	// Changed lines with DiffContextLines lines around them.
+	Hunks []textdiff.Hunk
+	// Number of inserted and deleted lines.
+	Inserted int
+	Deleted  int
+}
+
+// Starts a new goroutine that periodically compares new captures until the context is done.
+// Does nothing if the artifact storage is not configured.
+func (service *ChangeService) Run(ctx context.Context) {
+	if !service.ArtifactService.Enabled() {
+		service.Log.Info("ChangeService.Run artifact storage is not configured, captures are not compared")
+		return
+	}
+	go service.run(ctx)
+}
+
+func (service *ChangeService) run(ctx context.Context) {
+	ticker := time.NewTicker(service.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			service.Log.Info("ChangeService.run context is done", "error", ctx.Err().Error())
+			return
+		case <-ticker.C:
+			service.DetectChanges(ctx)
+		}
+	}
+}
+
+// Compare one batch of captures with their previous captures. Errors are logged,
+// captures that couldn't be compared because of unavailable storage are compared again in the next run.
+func (service *ChangeService) DetectChanges(ctx context.Context) {
+	captures, err := service.SeedService.FindCapturesForChange(service.BatchSize)
+	if err != nil {
+		service.Log.Error("ChangeService.DetectChanges failed to find captures", "error", err.Error())
+		return
+	}
+	for _, capture := range captures {
+		if ctx.Err() != nil {
+			return
+		}
+		err = service.Detect(ctx, capture)
+		if err != nil {
+			service.Log.Error("ChangeService.DetectChanges failed to compare capture", "shadowID", capture.SeedShadowID, "captureID", capture.ID, "error", err.Error())
+		}
+	}
+}
+
+// Hash the main text of the capture, compare it with the previous capture of the seed and store the result.
+func (service *ChangeService) Detect(ctx context.Context, capture *entities.SeedCapture) error {
+	text, err := service.PageText(ctx, capture)
+	if errors.Is(err, ErrTextUnavailable) {
+		service.Log.Warn("ChangeService.Detect can't read the page", "shadowID", capture.SeedShadowID, "captureID", capture.ID, "error", err.Error())
+		return service.SeedService.UpdateChange(capture.ID, "", entities.ChangeUnavailable, 0)
+	}
+	if err != nil {
+		return fmt.Errorf("ChangeService.Detect failed to read page: %w", err)
+	}
+	previous, err := service.SeedService.GetPreviousCapture(capture.ID)
+	if err != nil {
+		return fmt.Errorf("ChangeService.Detect failed to get previous capture: %w", err)
+	}
+	status, previousID := entities.ChangeFirst, uint(0)
+	if previous != nil {
+		previousID = previous.ID
+		status = entities.ChangeUnchanged
+		if previous.ContentHash != text.Hash {
+			status = entities.ChangeChanged
+		}
+	}
+	err = service.SeedService.UpdateChange(capture.ID, text.Hash, status, previousID)
+	if err != nil {
+		return fmt.Errorf("ChangeService.Detect failed to store result: %w", err)
+	}
+	return nil
+}
+
+// Read the main text of the captured page from its WACZ.
+// Returns ErrTextUnavailable if the WACZ is missing, damaged or doesn't contain the page.
+func (service *ChangeService) PageText(ctx context.Context, capture *entities.SeedCapture) (*PageText, error) {
+	if capture.WaczKey == "" {
+		return nil, fmt.Errorf("ChangeService.PageText: %w: capture has no WACZ", ErrTextUnavailable)
+	}
+	content, info, err := service.ArtifactService.Open(ctx, capture.WaczKey)
+	if errors.Is(err, artifact.ErrNotFound) {
+		return nil, fmt.Errorf("ChangeService.PageText: %w: %w", ErrTextUnavailable, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ChangeService.PageText failed to open %s: %w", capture.WaczKey, err)
+	}
+	defer content.Close()
+	archive, err := wacz.Open(artifact.ReaderAt(content), info.Size)
+	if err != nil {
+		return nil, fmt.Errorf("ChangeService.PageText: %w: %w", ErrTextUnavailable, err)
+	}
+	capturedURL := capture.CapturedURL
+	if capturedURL == "" {
+		capturedURL = archive.Datapackage.MainPageURL
+	}
+	line, err := archive.FindCapture(capturedURL, cdxj.FormatTimestamp(capture.CapturedAt))
+	if err != nil {
+		return nil, fmt.Errorf("ChangeService.PageText: %w: %w", ErrTextUnavailable, err)
+	}
+	response, err := archive.Response(line)
+	if errors.Is(err, wacz.ErrInvalidWACZ) {
+		return nil, fmt.Errorf("ChangeService.PageText: %w: %w", ErrTextUnavailable, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ChangeService.PageText failed to read response: %w", err)
+	}
+	lines := pagetext.Extract(response.Header.Get("Content-Type"), response.Body)
+	text := &PageText{Lines: lines}
+	if lines != nil {
+		text.Hash = hashContent([]byte(pagetext.Join(lines)))
+	} else {
+		text.Hash = hashContent(response.Body)
+	}
+	return text, nil
+}
+
+// Compare main texts of two captures.
+func (service *ChangeService) Compare(ctx context.Context, old, new *entities.SeedCapture) (*CaptureComparison, error) {
+	oldText, err := service.PageText(ctx, old)
+	if err != nil {
+		return nil, fmt.Errorf("ChangeService.Compare failed to read old capture: %w", err)
+	}
+	newText, err := service.PageText(ctx, new)
+	if err != nil {
+		return nil, fmt.Errorf("ChangeService.Compare failed to read new capture: %w", err)
+	}
+	comparison := &CaptureComparison{
+		Old:     old,
+		New:     new,
+		Changed: oldText.Hash != newText.Hash,
+		IsText:  oldText.Lines != nil && newText.Lines != nil,
+	}
+	if !comparison.IsText {
+		return comparison, nil
+	}
+	lines := textdiff.Lines(oldText.Lines, newText.Lines)
+	for _, line := range lines {
+		switch line.Op {
+		case textdiff.Insert:
+			comparison.Inserted++
+		case textdiff.Delete:
+			comparison.Deleted++
+		}
+	}
+	comparison.Hunks = textdiff.Hunks(lines, DiffContextLines)
+	return comparison, nil
+}
+
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
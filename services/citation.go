@@ -0,0 +1,478 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jinovatka/entities"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+var ErrUnknownCitationStyle = errors.New("unknown citation style")
+
+// The custom template can't be parsed or executed.
+var ErrInvalidCitationTemplate = errors.New("invalid citation template")
+
+// Maximum length of custom template and of rendered citations. Custom templates come from users.
+const (
+	MaxCitationTemplateLength = 4 << 10
+	maxCitationOutputLength   = 1 << 20
+)
+
+// Citation style. The citation of one seed is rendered by Template,
+// citations of a group are joined with Separator and wrapped in Prefix and Suffix.
+type CitationStyle struct {
+	// Identifier used in URLs, for example "iso690".
+	Name string
+	// Name shown to people.
+	Label string
+	// Template for one seed. See CitationData for available values and citationFuncs for functions.
+	Template string
+
+	Prefix    string
+	Separator string
+	Suffix    string
+
+	// Extension of downloaded file without dot.
+	Extension   string
+	ContentType string
+	// Machine readable styles are shown preformatted.
+	MachineReadable bool
+}
+
+// Values available in citation templates.
+type CitationData struct {
+	// Key for bibliographic managers, for example "seed-abcd1234".
+	Key string
+	// Title of the page. The URL is used if the title is not known.
+	Title string
+	// Authors of the page. Empty if unknown.
+	Authors []string
+	// Publication date as written in the page. Empty if unknown.
+	PublishedAt string
+	// PublishedAt parsed. Zero if unknown or in unsupported format.
+	Published time.Time
+	// Language of the page. Empty if unknown.
+	Language string
+	// Name of the web site from the page, or the host without www.
+	Site string
+	// The original URL.
+	URL string
+	// Link into the archive. Empty if the seed wasn't archived yet.
+	ArchivalURL string
+	// ArchivalURL if the seed was archived, otherwise URL.
+	CitedURL string
+	// Time of the capture. Zero if the seed wasn't archived yet.
+	HarvestedAt time.Time
+	// Time the citation was created.
+	AccessedAt time.Time
+}
+
+func NewCitationData(seed *entities.Seed, accessedAt time.Time) *CitationData {
+	data := &CitationData{
+		Key:         "seed-" + strings.ToLower(seed.ShadowID[:min(8, len(seed.ShadowID))]),
+		Title:       seed.URL,
+		Site:        seed.URL,
+		URL:         seed.URL,
+		ArchivalURL: seed.ArchivalURL,
+		CitedURL:    seed.URL,
+		HarvestedAt: seed.HarvestedAt,
+		AccessedAt:  accessedAt,
+	}
+	if parsed, err := url.Parse(seed.URL); err == nil && parsed.Host != "" {
+		data.Site = strings.TrimPrefix(parsed.Hostname(), "www.")
+	}
+	if seed.ArchivalURL != "" {
+		data.CitedURL = seed.ArchivalURL
+	}
+	if metadata := seed.PageMetadata; metadata != nil {
+		if metadata.Title != "" {
+			data.Title = metadata.Title
+		}
+		if metadata.SiteName != "" {
+			data.Site = metadata.SiteName
+		}
+		data.Authors = metadata.Authors
+		data.PublishedAt = metadata.PublishedAt
+		data.Published = parsePublished(metadata.PublishedAt)
+		data.Language = metadata.Language
+	}
+	return data
+}
+
+// Formats of publication dates found in pages.
+var publishedFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", time.DateOnly, "2006-01", "2006"}
+
+func parsePublished(value string) time.Time {
+	for _, format := range publishedFormats {
+		// Dates without zone are in local time, same as other dates of citations.
+		if published, err := time.ParseInLocation(format, value, time.Local); err == nil {
+			return published
+		}
+	}
+	return time.Time{}
+}
+
+type CitationService struct {
+	// Styles in the order they are offered to users.
+	Styles []*CitationStyle
+}
+
+func NewCitationService() *CitationService {
+	return &CitationService{
+		Styles: DefaultCitationStyles(),
+	}
+}
+
+func (service *CitationService) Style(name string) (*CitationStyle, error) {
+	for _, style := range service.Styles {
+		if style.Name == name {
+			return style, nil
+		}
+	}
+	return nil, ErrUnknownCitationStyle
+}
+
+// Render citation of the seed. If customTemplate is not empty, it is used instead of the style template.
+func (service *CitationService) CiteSeed(seed *entities.Seed, styleName, customTemplate string, accessedAt time.Time) (string, error) {
+	return service.cite([]*entities.Seed{seed}, styleName, customTemplate, accessedAt, false)
+}
+
+// Render citations of all seeds of the group. If customTemplate is not empty, it is used instead of the style template.
+func (service *CitationService) CiteGroup(group *entities.SeedsGroup, styleName, customTemplate string, accessedAt time.Time) (string, error) {
+	return service.cite(group.Seeds, styleName, customTemplate, accessedAt, true)
+}
+
+func (service *CitationService) cite(seeds []*entities.Seed, styleName, customTemplate string, accessedAt time.Time, wrap bool) (string, error) {
+	style, err := service.Style(styleName)
+	if err != nil {
+		return "", fmt.Errorf("CitationService.cite recieved style %q: %w", styleName, err)
+	}
+	text := style.Template
+	if customTemplate != "" {
+		if len(customTemplate) > MaxCitationTemplateLength {
+			return "", fmt.Errorf("CitationService.cite recieved too long template: %w", ErrInvalidCitationTemplate)
+		}
+		text = customTemplate
+	}
+	citationTemplate, err := template.New(style.Name).Funcs(citationFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("CitationService.cite failed to parse template: %w: %w", ErrInvalidCitationTemplate, err)
+	}
+	if customTemplate != "" {
+		err = checkCitationTemplate(citationTemplate)
+		if err != nil {
+			return "", fmt.Errorf("CitationService.cite recieved forbidden template: %w: %w", ErrInvalidCitationTemplate, err)
+		}
+	}
+
+	output := &limitedBuilder{limit: maxCitationOutputLength}
+	if wrap {
+		output.WriteString(style.Prefix)
+	}
+	for i, seed := range seeds {
+		if i > 0 {
+			output.WriteString(style.Separator)
+		}
+		err = citationTemplate.Execute(output, NewCitationData(seed, accessedAt))
+		if err != nil {
+			return "", fmt.Errorf("CitationService.cite failed to execute template: %w: %w", ErrInvalidCitationTemplate, err)
+		}
+	}
+	if wrap {
+		output.WriteString(style.Suffix)
+	}
+	return output.String(), nil
+}
+
+var englishMonths = [...]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+
+// Functions available in citation templates. The printing builtins are replaced,
+// because printf can allocate huge amounts of memory with user supplied width.
+var citationFuncs = template.FuncMap{
+	"printf":  disabledFunc("printf"),
+	"print":   disabledFunc("print"),
+	"println": disabledFunc("println"),
+	// Date as 2. 1. 2006 or "n. d." for zero time.
+	"czDate": func(t time.Time) string {
+		if t.IsZero() {
+			return "n. d."
+		}
+		return t.Local().Format("2. 1. 2006")
+	},
+	// Date as 2006-01-02 or "n. d." for zero time.
+	"isoDate": func(t time.Time) string {
+		if t.IsZero() {
+			return "n. d."
+		}
+		return t.Local().Format(time.DateOnly)
+	},
+	// Date as January 2, 2006 or "n.d." for zero time.
+	"usDate": func(t time.Time) string {
+		if t.IsZero() {
+			return "n.d."
+		}
+		t = t.Local()
+		return fmt.Sprintf("%s %d, %d", englishMonths[t.Month()-1], t.Day(), t.Year())
+	},
+	// Date as 2 Jan. 2006 or "n.d." for zero time.
+	"mlaDate": func(t time.Time) string {
+		if t.IsZero() {
+			return "n.d."
+		}
+		t = t.Local()
+		month := englishMonths[t.Month()-1]
+		if len(month) > 4 {
+			month = month[:3] + "."
+		}
+		return fmt.Sprintf("%d %s %d", t.Day(), month, t.Year())
+	},
+	// Date as 2006/01/02 used by RIS.
+	"risDate": func(t time.Time) string {
+		return t.Local().Format("2006/01/02")
+	},
+	// Date as CSL-JSON date object.
+	"cslDate": func(t time.Time) string {
+		t = t.Local()
+		return fmt.Sprintf(`{"date-parts": [[%d, %d, %d]]}`, t.Year(), int(t.Month()), t.Day())
+	},
+	"hasDate": func(t time.Time) bool {
+		return !t.IsZero()
+	},
+	// Value as JSON string.
+	"json": func(value string) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	// Value in BibTeX braces with special characters escaped.
+	"bibtex": func(value string) string {
+		return "{" + bibtexEscaper.Replace(value) + "}"
+	},
+	// Value on single line for RIS.
+	"ris": func(value string) string {
+		return strings.Join(strings.Fields(value), " ")
+	},
+	// Join values with separator, for example authors.
+	"join":   func(values []string, separator string) string { return strings.Join(values, separator) },
+	"upper":  strings.ToUpper,
+	"concat": func(values ...string) string { return strings.Join(values, "") },
+}
+
+var bibtexEscaper = strings.NewReplacer(`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`)
+
+// Builtin functions allowed in custom templates besides citationFuncs.
+var citationBuiltins = []string{"and", "or", "not", "eq", "ne", "len"}
+
+// Custom templates come from anonymous users, so they must run in time linear to their length.
+// Loops (range), with and nested templates are refused, only values, functions and if are allowed.
+func checkCitationTemplate(citationTemplate *template.Template) error {
+	if len(citationTemplate.Templates()) > 1 {
+		return errors.New("define and block are not allowed")
+	}
+	return checkCitationNode(citationTemplate.Tree.Root)
+}
+
+func checkCitationNode(node parse.Node) error {
+	switch node := node.(type) {
+	case nil:
+		return nil
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			err := checkCitationNode(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parse.IfNode:
+		return errors.Join(checkCitationNode(node.Pipe), checkCitationNode(node.List), checkCitationNode(node.ElseList))
+	case *parse.ActionNode:
+		return checkCitationNode(node.Pipe)
+	case *parse.PipeNode:
+		if node == nil {
+			return nil
+		}
+		for _, command := range node.Cmds {
+			for _, arg := range command.Args {
+				err := checkCitationNode(arg)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case *parse.ChainNode:
+		return checkCitationNode(node.Node)
+	case *parse.IdentifierNode:
+		_, isCitationFunc := citationFuncs[node.Ident]
+		if isCitationFunc || slices.Contains(citationBuiltins, node.Ident) {
+			return nil
+		}
+		return fmt.Errorf("function %s is not allowed", node.Ident)
+	case *parse.TextNode, *parse.CommentNode, *parse.FieldNode, *parse.VariableNode, *parse.DotNode,
+		*parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+		return nil
+	case *parse.RangeNode:
+		return errors.New("range is not allowed")
+	case *parse.WithNode:
+		return errors.New("with is not allowed, use if")
+	case *parse.TemplateNode:
+		return errors.New("template is not allowed")
+	}
+	return fmt.Errorf("%s is not allowed", node.String())
+}
+
+func disabledFunc(name string) func(...any) (string, error) {
+	return func(...any) (string, error) {
+		return "", errors.New(name + " is not available in citation templates, use concat")
+	}
+}
+
+// Builder that fails when the output is too long.
+type limitedBuilder struct {
+	strings.Builder
+	limit int
+}
+
+func (builder *limitedBuilder) Write(p []byte) (int, error) {
+	if builder.Len()+len(p) > builder.limit {
+		return 0, errors.New("citation is too long")
+	}
+	return builder.Builder.Write(p)
+}
+
+func DefaultCitationStyles() []*CitationStyle {
+	return []*CitationStyle{
+		{
+			Name:        "iso690",
+			Label:       "ČSN ISO 690",
+			Template:    `{{if .Authors}}{{join .Authors "; "}}. {{end}}{{.Title}}. Online. {{.Site}}{{if hasDate .Published}}, {{isoDate .Published}}{{end}}. Dostupné z: {{.URL}}. [cit. {{isoDate .AccessedAt}}].{{if .ArchivalURL}} Archivováno {{isoDate .HarvestedAt}} z: {{.ArchivalURL}}.{{end}}`,
+			Separator:   "\n",
+			Suffix:      "\n",
+			Extension:   "txt",
+			ContentType: "text/plain; charset=utf-8",
+		},
+		{
+			Name:        "apa",
+			Label:       "APA",
+			Template:    `{{if .Authors}}{{join .Authors ", "}}. {{end}}({{if hasDate .Published}}{{.Published.Year}}{{else}}n.d.{{end}}). {{.Title}}. {{.Site}}. Retrieved {{usDate .AccessedAt}}, from {{.CitedURL}}`,
+			Separator:   "\n",
+			Suffix:      "\n",
+			Extension:   "txt",
+			ContentType: "text/plain; charset=utf-8",
+		},
+		{
+			Name:        "mla",
+			Label:       "MLA",
+			Template:    `{{if .Authors}}{{join .Authors ", "}}. {{end}}"{{.Title}}." {{.Site}}, {{if hasDate .Published}}{{mlaDate .Published}}, {{end}}{{if .ArchivalURL}}archived {{mlaDate .HarvestedAt}}, {{end}}{{.CitedURL}}. Accessed {{mlaDate .AccessedAt}}.`,
+			Separator:   "\n",
+			Suffix:      "\n",
+			Extension:   "txt",
+			ContentType: "text/plain; charset=utf-8",
+		},
+		{
+			Name:        "chicago",
+			Label:       "Chicago",
+			Template:    `{{if .Authors}}{{join .Authors ", "}}. {{end}}"{{.Title}}." {{.Site}}. {{if hasDate .Published}}{{usDate .Published}}. {{end}}{{if .ArchivalURL}}Archived {{usDate .HarvestedAt}}. {{end}}Accessed {{usDate .AccessedAt}}. {{.CitedURL}}.`,
+			Separator:   "\n",
+			Suffix:      "\n",
+			Extension:   "txt",
+			ContentType: "text/plain; charset=utf-8",
+		},
+		{
+			Name:  "bibtex",
+			Label: "BibTeX",
+			Template: `@misc{ {{- .Key -}} ,
+  title = {{bibtex .Title}},
+{{- if .Authors}}
+  author = {{bibtex (join .Authors " and ")}},
+{{- end}}
+{{- if hasDate .Published}}
+  date = {{bibtex (isoDate .Published)}},
+{{- end}}
+{{- if .Language}}
+  language = {{bibtex .Language}},
+{{- end}}
+  howpublished = {{bibtex .URL}},
+  url = {{bibtex .CitedURL}},
+  urldate = {{bibtex (isoDate .AccessedAt)}},
+{{- if .ArchivalURL}}
+  note = {{bibtex (concat "Archivováno " (isoDate .HarvestedAt))}},
+{{- end}}
+}`,
+			Separator:       "\n\n",
+			Suffix:          "\n",
+			Extension:       "bib",
+			ContentType:     "application/x-bibtex; charset=utf-8",
+			MachineReadable: true,
+		},
+		{
+			Name:  "ris",
+			Label: "RIS",
+			Template: `TY  - ELEC
+ID  - {{.Key}}
+TI  - {{ris .Title}}
+{{- range .Authors}}
+AU  - {{ris .}}
+{{- end}}
+{{- if hasDate .Published}}
+DA  - {{risDate .Published}}
+PY  - {{.Published.Year}}
+{{- end}}
+{{- if .Language}}
+LA  - {{ris .Language}}
+{{- end}}
+UR  - {{ris .CitedURL}}
+Y2  - {{risDate .AccessedAt}}
+{{- if .ArchivalURL}}
+DB  - Webarchiv
+N1  - {{ris (concat "Původní URL: " .URL)}}
+{{- end}}
+ER  - `,
+			Separator:       "\n",
+			Suffix:          "\n",
+			Extension:       "ris",
+			ContentType:     "application/x-research-info-systems; charset=utf-8",
+			MachineReadable: true,
+		},
+		{
+			Name:  "csl-json",
+			Label: "CSL-JSON",
+			Template: `{
+  "id": {{json .Key}},
+  "type": "webpage",
+  "title": {{json .Title}},
+{{- if .Authors}}
+  "author": [{{range $i, $author := .Authors}}{{if $i}}, {{end}}{"literal": {{json $author}}}{{end}}],
+{{- end}}
+{{- if .Language}}
+  "language": {{json .Language}},
+{{- end}}
+{{- if hasDate .Published}}
+  "issued": {{cslDate .Published}},
+{{- end}}
+  "container-title": {{json .Site}},
+  "URL": {{json .CitedURL}},
+  "accessed": {{cslDate .AccessedAt}}
+{{- if .ArchivalURL}},
+  "archive": "Webarchiv",
+  "archive_location": {{json .ArchivalURL}}
+{{- end}}
+}`,
+			Prefix:          "[\n",
+			Separator:       ",\n",
+			Suffix:          "\n]\n",
+			Extension:       "json",
+			ContentType:     "application/vnd.citationstyles.csl+json; charset=utf-8",
+			MachineReadable: true,
+		},
+	}
+}
@@ -1,103 +1,259 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"jinovatka/entities"
 	"net/url"
-
-	"github.com/xuri/excelize/v2"
+	"strings"
+	"time"
 )
 
-type ExporterService struct{}
+var ErrUnknownExportFormat = errors.New("unknown export format")
 
-func NewExporterService() *ExporterService {
-	return &ExporterService{}
+// Format of exported file.
+type ExportFormat string
+
+const (
+	FormatXLSX ExportFormat = "xlsx"
+	FormatCSV  ExportFormat = "csv"
+	FormatJSON ExportFormat = "json"
+	FormatODS  ExportFormat = "ods"
+)
+
+// Writes the exported table in one file format. Implementations are in exporter_*.go files.
+type TableWriter interface {
+	// MIME type of the written file.
+	ContentType() string
+	// Write the table. Rows have the same length as columns.
+	Write(w io.Writer, columns []*ExportColumn, rows [][]ExportCell) error
 }
 
-// Convert SeedsGroup to nice excel sheet for users to keep track of their submited seeds.
-// The excel data will be written to the provided io.Writer.
-func (service ExporterService) GroupToExcel(group *entities.SeedsGroup, w io.Writer, seedUrlPrefix *url.URL) error {
-	header := []any{"URL", "Odkaz na detail", "Stav", "Odkaz do Webarchivu"}
-	const sheet = "Semínka"
+// Column of the exported table. Columns are defined once in ExporterService.Columns and used by all formats.
+type ExportColumn struct {
+	// Header shown to people.
+	Header string
+	// Key used by machine readable formats.
+	Key string
+	// Create the cell of the column for the seed. detailLink is the URL of the seed detail page.
+	Cell func(seed *entities.Seed, detailLink *url.URL) ExportCell
+}
 
-	f := excelize.NewFile()
-	defer f.Close()
+type ExportCell struct {
+	// Value shown to people.
+	Text string
+	// Target of hyperlink. Empty if the cell is not a link.
+	Link string
+	// Value for machine readable formats. If nil, Link or Text is used.
+	Data any
+}
 
-	defaultSheet := f.GetSheetName(f.GetActiveSheetIndex())
-	err := f.SetSheetName(defaultSheet, sheet)
-	if err != nil {
-		return fmt.Errorf("ExporterService.GroupToExcel could not rename sheet: %w", err)
+// Value of the cell for formats without hyperlinks.
+func (cell ExportCell) PlainText() string {
+	if cell.Link != "" {
+		return cell.Link
 	}
+	return cell.Text
+}
 
-	err = service.writeExcelRow(f, sheet, 1, header)
-	if err != nil {
-		return fmt.Errorf("ExporterService.GroupToExcel could not write header to sheet: %w", err)
+// Value of the cell for machine readable formats.
+func (cell ExportCell) Value() any {
+	if cell.Data != nil {
+		return cell.Data
 	}
+	return cell.PlainText()
+}
 
-	for i, seed := range group.Seeds {
-		rowIndex := i + 2 // This is excel, data starts at row 2 :)
-		fmt.Println("string:", seedUrlPrefix.String(), "host:", seedUrlPrefix.Host, "path:", seedUrlPrefix.Path)
-		detailLink := seedUrlPrefix.JoinPath("/" + seed.ShadowID)
-		fmt.Println("string:", detailLink.String(), "host:", detailLink.Host, "path:", detailLink.Path)
+type ExporterService struct {
+	// Columns of all exports.
+	Columns []*ExportColumn
+	// Supported formats.
+	Writers map[ExportFormat]TableWriter
+}
 
-		state := "Nesklizeno"
-		if seed.State == entities.DoneSuccess {
-			state = "Sklizeno"
-		}
-		row := []any{
-			possibleLink{IsLink: true, Value: seed.URL, Link: seed.URL},                 // URL
-			possibleLink{IsLink: true, Value: seed.ShadowID, Link: detailLink.String()}, // Odkaz na detail
-			possibleLink{IsLink: false, Value: state},                                   // Stav
-			possibleLink{IsLink: true, Value: seed.ArchivalURL, Link: seed.ArchivalURL}, // Odkaz do Webarchivu
-		}
-		err = service.writeExcelRow(f, sheet, rowIndex, row)
-		if err != nil {
-			return fmt.Errorf("ExporterService.GroupToExcel could not write row to sheet: %w", err)
-		}
+func NewExporterService() *ExporterService {
+	return &ExporterService{
+		Columns: DefaultExportColumns(),
+		Writers: map[ExportFormat]TableWriter{
+			FormatXLSX: new(xlsxWriter),
+			FormatCSV:  new(csvWriter),
+			FormatJSON: new(jsonWriter),
+			FormatODS:  new(odsWriter),
+		},
 	}
+}
 
-	_, err = f.WriteTo(w)
-	if err != nil {
-		return fmt.Errorf("ExporterService.GroupToExcel could not write sheet into writer: %w", err)
+// Columns for users to keep track of their submited seeds.
+func DefaultExportColumns() []*ExportColumn {
+	return []*ExportColumn{
+		{
+			Header: "URL",
+			Key:    "url",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				return ExportCell{Text: seed.URL, Link: seed.URL}
+			},
+		},
+		{
+			Header: "Odkaz na detail",
+			Key:    "detailURL",
+			Cell: func(seed *entities.Seed, detailLink *url.URL) ExportCell {
+				return ExportCell{Text: seed.ShadowID, Link: detailLink.String()}
+			},
+		},
+		{
+			Header: "Stav",
+			Key:    "state",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				state := "Nesklizeno"
+				if seed.State == entities.DoneSuccess {
+					state = "Sklizeno"
+				}
+				return ExportCell{Text: state, Data: seed.State}
+			},
+		},
+		{
+			Header: "Odkaz do Webarchivu",
+			Key:    "archivalURL",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				return ExportCell{Text: seed.ArchivalURL, Link: seed.ArchivalURL}
+			},
+		},
+		{
+			Header: "Datum sklizně",
+			Key:    "harvestedAt",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				if seed.HarvestedAt.IsZero() {
+					return ExportCell{Data: (*time.Time)(nil)}
+				}
+				return ExportCell{Text: seed.HarvestedAt.Local().Format("2. 1. 2006 15:04:05"), Data: seed.HarvestedAt}
+			},
+		},
+		{
+			Header: "Název stránky",
+			Key:    "title",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				return ExportCell{Text: pageMetadata(seed).Title}
+			},
+		},
+		{
+			Header: "Autoři",
+			Key:    "authors",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				authors := pageMetadata(seed).Authors
+				if authors == nil {
+					authors = []string{}
+				}
+				return ExportCell{Text: strings.Join(authors, "; "), Data: authors}
+			},
+		},
+		{
+			Header: "Datum publikace",
+			Key:    "publishedAt",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				return ExportCell{Text: pageMetadata(seed).PublishedAt}
+			},
+		},
+		{
+			Header: "Jazyk",
+			Key:    "language",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				return ExportCell{Text: pageMetadata(seed).Language}
+			},
+		},
+		{
+			Header: "Kanonická URL",
+			Key:    "canonicalURL",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				canonicalURL := pageMetadata(seed).CanonicalURL
+				return ExportCell{Text: canonicalURL, Link: canonicalURL}
+			},
+		},
+		{
+			Header: "Chyba",
+			Key:    "errorCategory",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				return ExportCell{Text: seed.ErrorCategory.Description(), Data: seed.ErrorCategory}
+			},
+		},
+		{
+			Header: "Podrobnosti chyby",
+			Key:    "errorMessages",
+			Cell: func(seed *entities.Seed, _ *url.URL) ExportCell {
+				messages := seed.ErrorMessages
+				if messages == nil {
+					messages = []string{}
+				}
+				return ExportCell{Text: strings.Join(seed.ErrorMessages, "\n"), Data: messages}
+			},
+		},
 	}
+}
 
-	return nil
+// Metadata of the seed page. Never nil, so the columns don't have to check it.
+func pageMetadata(seed *entities.Seed) *entities.PageMetadata {
+	if seed.PageMetadata == nil {
+		return new(entities.PageMetadata)
+	}
+	return seed.PageMetadata
 }
 
-type possibleLink struct {
-	IsLink bool
-	Value  any
-	Link   string
+// Find format by its name, for example "csv".
+func (service *ExporterService) Format(name string) (ExportFormat, error) {
+	format := ExportFormat(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := service.Writers[format]; !ok {
+		return "", ErrUnknownExportFormat
+	}
+	return format, nil
 }
 
-// Rows are indexed from 1!
-func (service ExporterService) writeExcelRow(f *excelize.File, sheet string, rowIndex int, row []any) error {
-	for i := range row {
-		colIndex := i + 1
-		cellName, err := excelize.CoordinatesToCellName(colIndex, rowIndex)
-		if err != nil {
-			return err
+// Find format by MIME type, for example "text/csv". Parameters of the type are ignored.
+func (service *ExporterService) FormatByContentType(contentType string) (ExportFormat, error) {
+	mime, _, _ := strings.Cut(contentType, ";")
+	mime = strings.ToLower(strings.TrimSpace(mime))
+	for format, writer := range service.Writers {
+		writerMime, _, _ := strings.Cut(writer.ContentType(), ";")
+		if mime == writerMime {
+			return format, nil
 		}
+	}
+	return "", ErrUnknownExportFormat
+}
 
-		// There is definetly a way to do this more cleanly. I am certain of it. But who cares actually? If you do then please open an issue.
-		if cellValue, ok := row[i].(possibleLink); ok {
-			err = f.SetCellValue(sheet, cellName, cellValue.Value)
-			if err != nil {
-				return err
-			}
-			if cellValue.IsLink {
-				err = f.SetCellHyperLink(sheet, cellName, cellValue.Link, "External")
-				if err != nil {
-					return err
-				}
-			}
-		} else {
-			err = f.SetCellValue(sheet, cellName, row[i])
-			if err != nil {
-				return err
-			}
+// MIME type of the format.
+func (service *ExporterService) ContentType(format ExportFormat) string {
+	writer, ok := service.Writers[format]
+	if !ok {
+		return ""
+	}
+	return writer.ContentType()
+}
+
+// Export SeedsGroup in the given format for users to keep track of their submited seeds.
+// The data will be written to the provided io.Writer.
+func (service *ExporterService) ExportGroup(group *entities.SeedsGroup, format ExportFormat, w io.Writer, seedUrlPrefix *url.URL) error {
+	writer, ok := service.Writers[format]
+	if !ok {
+		return fmt.Errorf("ExporterService.ExportGroup recieved format %q: %w", format, ErrUnknownExportFormat)
+	}
+	rows := make([][]ExportCell, 0, len(group.Seeds))
+	for _, seed := range group.Seeds {
+		detailLink := seedUrlPrefix.JoinPath("/" + seed.ShadowID)
+		row := make([]ExportCell, 0, len(service.Columns))
+		for _, column := range service.Columns {
+			row = append(row, column.Cell(seed, detailLink))
 		}
+		rows = append(rows, row)
+	}
+	err := writer.Write(w, service.Columns, rows)
+	if err != nil {
+		return fmt.Errorf("ExporterService.ExportGroup failed to write %s: %w", format, err)
 	}
 	return nil
 }
+
+// Convert SeedsGroup to nice excel sheet for users to keep track of their submited seeds.
+// The excel data will be written to the provided io.Writer.
+func (service *ExporterService) GroupToExcel(group *entities.SeedsGroup, w io.Writer, seedUrlPrefix *url.URL) error {
+	return service.ExportGroup(group, FormatXLSX, w, seedUrlPrefix)
+}
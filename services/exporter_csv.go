@@ -0,0 +1,58 @@
+package services
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+type csvWriter struct{}
+
+func (writer *csvWriter) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// CSV is written for Czech Excel. It needs the BOM to recognize UTF-8 and it expects semicolon as separator,
+// because comma is the decimal separator in Czech locale.
+func (writer *csvWriter) Write(w io.Writer, columns []*ExportColumn, rows [][]ExportCell) error {
+	const bom = "\xEF\xBB\xBF"
+	_, err := io.WriteString(w, bom)
+	if err != nil {
+		return err
+	}
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = ';'
+	csvWriter.UseCRLF = true
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.Header
+	}
+	err = csvWriter.Write(record)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			record[i] = escapeFormula(cell.PlainText())
+		}
+		err = csvWriter.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// Spreadsheets run cells starting with these characters as formulas, so submitted titles or URLs could inject them.
+// https://owasp.org/www-community/attacks/CSV_Injection
+const formulaPrefixes = "=+-@\t\r"
+
+// Prefix the text with apostrophe if it would be read as formula. The apostrophe is not shown by spreadsheets.
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune(formulaPrefixes, rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
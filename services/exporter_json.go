@@ -0,0 +1,27 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonWriter struct{}
+
+func (writer *jsonWriter) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+// Writes array of objects. Keys of the objects are ExportColumn.Key.
+func (writer *jsonWriter) Write(w io.Writer, columns []*ExportColumn, rows [][]ExportCell) error {
+	objects := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		object := make(map[string]any, len(columns))
+		for i, column := range columns {
+			object[column.Key] = row[i].Value()
+		}
+		objects = append(objects, object)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(objects)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writes OpenDocument spreadsheet https://docs.oasis-open.org/office/OpenDocument/v1.3/
+// Only the parts required by the specification are written, styles are left to the application.
+type odsWriter struct{}
+
+const odsMimetype = "application/vnd.oasis.opendocument.spreadsheet"
+
+const odsManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="` + odsMimetype + `"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
+
+func (writer *odsWriter) ContentType() string {
+	return odsMimetype
+}
+
+func (writer *odsWriter) Write(w io.Writer, columns []*ExportColumn, rows [][]ExportCell) error {
+	archive := zip.NewWriter(w)
+
+	// The mimetype must be the first file and it must not be compressed.
+	files := []struct {
+		path   string
+		data   []byte
+		method uint16
+	}{
+		{"mimetype", []byte(odsMimetype), zip.Store},
+		{"META-INF/manifest.xml", []byte(odsManifest), zip.Deflate},
+		{"content.xml", writer.content(columns, rows), zip.Deflate},
+	}
+	for _, file := range files {
+		fileWriter, err := archive.CreateHeader(&zip.FileHeader{Name: file.path, Method: file.method})
+		if err != nil {
+			return err
+		}
+		_, err = fileWriter.Write(file.data)
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (writer *odsWriter) content(columns []*ExportColumn, rows [][]ExportCell) []byte {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	buffer.WriteString(`<office:document-content` +
+		` xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"` +
+		` xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"` +
+		` xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"` +
+		` xmlns:xlink="http://www.w3.org/1999/xlink"` +
+		` office:version="1.2">`)
+	buffer.WriteString(`<office:body><office:spreadsheet><table:table table:name="Semínka">`)
+	buffer.WriteString(`<table:table-column table:number-columns-repeated="` + strconv.Itoa(len(columns)) + `"/>`)
+
+	header := make([]ExportCell, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, ExportCell{Text: column.Header})
+	}
+	writer.writeRow(buffer, header)
+	for _, row := range rows {
+		writer.writeRow(buffer, row)
+	}
+
+	buffer.WriteString(`</table:table></office:spreadsheet></office:body></office:document-content>`)
+	return buffer.Bytes()
+}
+
+func (writer *odsWriter) writeRow(buffer *bytes.Buffer, row []ExportCell) {
+	buffer.WriteString(`<table:table-row>`)
+	for _, cell := range row {
+		if cell.Text == "" {
+			buffer.WriteString(`<table:table-cell/>`)
+			continue
+		}
+		// Cells are always strings without table:formula, so text starting with "=" is never run as formula.
+		buffer.WriteString(`<table:table-cell office:value-type="string">`)
+		// Every line is separate paragraph.
+		for _, line := range strings.Split(cell.Text, "\n") {
+			buffer.WriteString(`<text:p>`)
+			if cell.Link != "" {
+				buffer.WriteString(`<text:a xlink:type="simple" xlink:href="` + escapeXML(cell.Link) + `">`)
+				buffer.WriteString(escapeXML(line))
+				buffer.WriteString(`</text:a>`)
+			} else {
+				buffer.WriteString(escapeXML(line))
+			}
+			buffer.WriteString(`</text:p>`)
+		}
+		buffer.WriteString(`</table:table-cell>`)
+	}
+	buffer.WriteString(`</table:table-row>`)
+}
+
+func escapeXML(text string) string {
+	buffer := new(strings.Builder)
+	_ = xml.EscapeText(buffer, []byte(text)) // Writing to strings.Builder never fails.
+	return buffer.String()
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type xlsxWriter struct{}
+
+func (writer *xlsxWriter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (writer *xlsxWriter) Write(w io.Writer, columns []*ExportColumn, rows [][]ExportCell) error {
+	const sheet = "Semínka"
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	defaultSheet := f.GetSheetName(f.GetActiveSheetIndex())
+	err := f.SetSheetName(defaultSheet, sheet)
+	if err != nil {
+		return fmt.Errorf("xlsxWriter.Write could not rename sheet: %w", err)
+	}
+
+	header := make([]ExportCell, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, ExportCell{Text: column.Header})
+	}
+	err = writer.writeRow(f, sheet, 1, header)
+	if err != nil {
+		return fmt.Errorf("xlsxWriter.Write could not write header to sheet: %w", err)
+	}
+
+	for i, row := range rows {
+		rowIndex := i + 2 // This is excel, data starts at row 2 :)
+		err = writer.writeRow(f, sheet, rowIndex, row)
+		if err != nil {
+			return fmt.Errorf("xlsxWriter.Write could not write row to sheet: %w", err)
+		}
+	}
+
+	_, err = f.WriteTo(w)
+	if err != nil {
+		return fmt.Errorf("xlsxWriter.Write could not write sheet into writer: %w", err)
+	}
+	return nil
+}
+
+// Rows are indexed from 1!
+func (writer *xlsxWriter) writeRow(f *excelize.File, sheet string, rowIndex int, row []ExportCell) error {
+	for i, cell := range row {
+		colIndex := i + 1
+		cellName, err := excelize.CoordinatesToCellName(colIndex, rowIndex)
+		if err != nil {
+			return err
+		}
+		err = f.SetCellValue(sheet, cellName, cell.Text)
+		if err != nil {
+			return err
+		}
+		if cell.Link != "" {
+			err = f.SetCellHyperLink(sheet, cellName, cell.Link, "External")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"jinovatka/artifact"
+	"jinovatka/assert"
+	"jinovatka/cdxj"
+	"jinovatka/entities"
+	"log/slog"
+	"time"
+)
+
+// FixityChecker periodically hashes and validates stored WACZ files again, so files that went missing
+// or got corrupted in the artifact storage are found before anyone needs them.
+type FixityChecker struct {
+	Log             *slog.Logger
+	SeedService     *SeedService
+	ArtifactService *ArtifactService
+
+	// How often to look for WACZ files due for check.
+	Interval time.Duration
+	// How long until checked WACZ is checked again.
+	RecheckAfter time.Duration
+	// Maximum number of WACZ files checked in one run.
+	BatchSize int
+}
+
+func NewFixityChecker(
+	log *slog.Logger,
+	seedService *SeedService,
+	artifactService *ArtifactService,
+	interval,
+	recheckAfter time.Duration,
+	batchSize int,
+) *FixityChecker {
+	assert.Must(log != nil, "NewFixityChecker: log can't be nil")
+	assert.Must(seedService != nil, "NewFixityChecker: seedService can't be nil")
+	assert.Must(artifactService != nil, "NewFixityChecker: artifactService can't be nil")
+	assert.Must(interval > 0, "NewFixityChecker: interval must be positive")
+	assert.Must(recheckAfter > 0, "NewFixityChecker: recheckAfter must be positive")
+	assert.Must(batchSize > 0, "NewFixityChecker: batchSize must be positive")
+	return &FixityChecker{
+		Log:             log,
+		SeedService:     seedService,
+		ArtifactService: artifactService,
+		Interval:        interval,
+		RecheckAfter:    recheckAfter,
+		BatchSize:       batchSize,
+	}
+}
+
+// Starts a new goroutine that periodically checks WACZ files until the context is done.
+// Does nothing if the artifact storage is not configured.
+func (checker *FixityChecker) Run(ctx context.Context) {
+	if !checker.ArtifactService.Enabled() {
+		checker.Log.Info("FixityChecker.Run artifact storage is not configured, fixity is not checked")
+		return
+	}
+	go checker.run(ctx)
+}
+
+func (checker *FixityChecker) run(ctx context.Context) {
+	ticker := time.NewTicker(checker.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			checker.Log.Info("FixityChecker.run context is done", "error", ctx.Err().Error())
+			return
+		case <-ticker.C:
+			checker.Check(ctx)
+		}
+	}
+}
+
+// Check one batch of WACZ files. Errors are logged, the files will be checked again in the next run.
+func (checker *FixityChecker) Check(ctx context.Context) {
+	captures, err := checker.SeedService.FindCapturesForFixity(checker.RecheckAfter, checker.BatchSize)
+	if err != nil {
+		checker.Log.Error("FixityChecker.Check failed to find captures", "error", err.Error())
+		return
+	}
+	for _, capture := range captures {
+		if ctx.Err() != nil {
+			return
+		}
+		timestamp := ""
+		if !capture.CapturedAt.IsZero() {
+			timestamp = cdxj.FormatTimestamp(capture.CapturedAt)
+		}
+		err = checker.ArtifactService.Verify(ctx, capture.WaczKey, capture.WaczSHA256, capture.CapturedURL, timestamp)
+		var status entities.FixityStatus
+		switch {
+		case err == nil:
+			status = entities.FixityOK
+		case errors.Is(err, artifact.ErrNotFound):
+			status = entities.FixityMissing
+		case errors.Is(err, ErrArtifactCorrupted):
+			status = entities.FixityCorrupted
+		default:
+			// Unavailable storage says nothing about the file.
+			checker.Log.Error("FixityChecker.Check failed to verify WACZ", "shadowID", capture.SeedShadowID, "key", capture.WaczKey, "error", err.Error())
+			continue
+		}
+		if status.IsProblem() {
+			checker.Log.Warn("FixityChecker.Check found damaged WACZ", "shadowID", capture.SeedShadowID, "key", capture.WaczKey, "status", status, "error", err.Error())
+		}
+		err = checker.SeedService.UpdateFixity(capture.ID, status)
+		if err != nil {
+			checker.Log.Error("FixityChecker.Check failed to store fixity", "shadowID", capture.SeedShadowID, "key", capture.WaczKey, "error", err.Error())
+		}
+	}
+}
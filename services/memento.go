@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"jinovatka/memento"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMementoDisabled = errors.New("memento lookups are disabled")
+	ErrNoMemento       = errors.New("no memento found")
+)
+
+// TimeMaps of popular sites can be huge. Larger TimeMaps are refused.
+const maxTimeMapSize = 16 << 20
+
+// How long CachedTimeMap keeps TimeMaps and failures, and how many URLs it keeps at most.
+const (
+	timeMapCacheTTL        = 5 * time.Minute
+	timeMapFailureCacheTTL = 30 * time.Second
+	maxCachedTimeMaps      = 1000
+)
+
+// Client of Memento (RFC 7089) endpoints of a web archive. Used to find out what the archive already has.
+type MementoService struct {
+	Log *slog.Logger
+	// Client used for all requests. Redirects are not followed, TimeGate redirects are the answer.
+	Client *http.Client
+	// Prefix of link-format TimeMaps. Empty disables TimeMap.
+	TimeMapURL string
+	// Prefix of TimeGates. Empty disables Closest.
+	TimeGateURL string
+
+	// Guards timeMapCache.
+	mutex sync.Mutex
+	// Recent results of TimeMap by URL, see CachedTimeMap.
+	timeMapCache map[string]*cachedTimeMap
+}
+
+type cachedTimeMap struct {
+	Mementos []*entities.Memento
+	Err      error
+	Expires  time.Time
+}
+
+func NewMementoService(log *slog.Logger, client *http.Client, timeMapURL, timeGateURL string) *MementoService {
+	assert.Must(log != nil, "NewMementoService: log can't be nil")
+	assert.Must(client != nil, "NewMementoService: client can't be nil")
+	// Copy the client, so we don't change the callers client.
+	clientCopy := *client
+	clientCopy.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &MementoService{
+		Log:          log,
+		Client:       &clientCopy,
+		TimeMapURL:   timeMapURL,
+		TimeGateURL:  timeGateURL,
+		timeMapCache: make(map[string]*cachedTimeMap),
+	}
+}
+
+func (service *MementoService) TimeMapEnabled() bool {
+	return service.TimeMapURL != ""
+}
+
+func (service *MementoService) TimeGateEnabled() bool {
+	return service.TimeGateURL != ""
+}
+
+// List all mementos of the URL from the TimeMap, newest first.
+// Returns empty list if the archive has no memento of the URL.
+func (service *MementoService) TimeMap(ctx context.Context, seedURL string) ([]*entities.Memento, error) {
+	if !service.TimeMapEnabled() {
+		return nil, ErrMementoDisabled
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, service.TimeMapURL+seedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("MementoService.TimeMap failed to create request: %w", err)
+	}
+	request.Header.Set("Accept", memento.LinkFormat)
+	response, err := service.Client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("MementoService.TimeMap request failed: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return []*entities.Memento{}, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("MementoService.TimeMap recieved unexpected status %s", response.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxTimeMapSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("MementoService.TimeMap failed to read response: %w", err)
+	}
+	if len(body) > maxTimeMapSize {
+		return nil, fmt.Errorf("MementoService.TimeMap recieved TimeMap larger than %d bytes", maxTimeMapSize)
+	}
+	links, err := memento.ParseLinks(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("MementoService.TimeMap recieved invalid TimeMap: %w", err)
+	}
+
+	mementos := make([]*entities.Memento, 0, len(links))
+	for _, link := range links {
+		datetime := link.Datetime()
+		if !link.HasRel(memento.RelMemento) || datetime.IsZero() {
+			continue
+		}
+		mementos = append(mementos, &entities.Memento{URL: link.URL, Datetime: datetime})
+	}
+	slices.SortStableFunc(mementos, func(a, b *entities.Memento) int {
+		return b.Datetime.Compare(a.Datetime)
+	})
+	return mementos, nil
+}
+
+// TimeMap that is fetched again only if the last result is older than a few minutes. Failures are remembered
+// for shorter time, so slow or broken archive is not asked on every page view. Returned mementos must not be changed.
+// Timed out requests count as failures, cancelled requests are not remembered.
+func (service *MementoService) CachedTimeMap(ctx context.Context, seedURL string) ([]*entities.Memento, error) {
+	now := time.Now()
+	service.mutex.Lock()
+	cached, ok := service.timeMapCache[seedURL]
+	service.mutex.Unlock()
+	if ok && now.Before(cached.Expires) {
+		return cached.Mementos, cached.Err
+	}
+
+	mementos, err := service.TimeMap(ctx, seedURL)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// The caller went away, the archive may be fine.
+		return mementos, err
+	}
+	ttl := timeMapCacheTTL
+	if err != nil {
+		ttl = timeMapFailureCacheTTL
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if len(service.timeMapCache) >= maxCachedTimeMaps {
+		for url, cached := range service.timeMapCache {
+			if !now.Before(cached.Expires) {
+				delete(service.timeMapCache, url)
+			}
+		}
+		if len(service.timeMapCache) >= maxCachedTimeMaps {
+			clear(service.timeMapCache)
+		}
+	}
+	service.timeMapCache[seedURL] = &cachedTimeMap{Mementos: mementos, Err: err, Expires: now.Add(ttl)}
+	return mementos, err
+}
+
+// Ask the TimeGate for the memento of the URL closest to the given time.
+// Returns ErrNoMemento if the archive has no memento of the URL.
+func (service *MementoService) Closest(ctx context.Context, seedURL string, datetime time.Time) (*entities.Memento, error) {
+	if !service.TimeGateEnabled() {
+		return nil, ErrMementoDisabled
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, service.TimeGateURL+seedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("MementoService.Closest failed to create request: %w", err)
+	}
+	request.Header.Set(memento.AcceptDatetimeHeader, memento.FormatDatetime(datetime))
+	response, err := service.Client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("MementoService.Closest request failed: %w", err)
+	}
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return nil, ErrNoMemento
+	case response.StatusCode == http.StatusOK:
+		// The TimeGate is the memento itself (RFC 7089 pattern 1.1 and 3).
+		found, err := mementoFromHeaders(response, request.URL.String())
+		if err != nil {
+			return nil, fmt.Errorf("MementoService.Closest recieved invalid memento: %w", err)
+		}
+		return found, nil
+	case response.StatusCode >= 300 && response.StatusCode < 400:
+		location, err := response.Location()
+		if err != nil {
+			return nil, fmt.Errorf("MementoService.Closest recieved redirect without location: %w", err)
+		}
+		found := &entities.Memento{URL: location.String()}
+		// The datetime is in the Link header of the TimeGate, if the archive sends it. Otherwise ask the memento.
+		links, _ := memento.ParseLinks(response.Header.Get("Link"))
+		for _, link := range links {
+			if link.HasRel(memento.RelMemento) && link.URL == found.URL {
+				found.Datetime = link.Datetime()
+			}
+		}
+		if found.Datetime.IsZero() {
+			found, err = service.memento(ctx, found.URL)
+			if err != nil {
+				return nil, fmt.Errorf("MementoService.Closest failed to get datetime of memento: %w", err)
+			}
+		}
+		return found, nil
+	}
+	return nil, fmt.Errorf("MementoService.Closest recieved unexpected status %s", response.Status)
+}
+
+// Fetch headers of the memento.
+func (service *MementoService) memento(ctx context.Context, mementoURL string) (*entities.Memento, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, mementoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := service.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("memento responded with status %s", response.Status)
+	}
+	return mementoFromHeaders(response, mementoURL)
+}
+
+func mementoFromHeaders(response *http.Response, mementoURL string) (*entities.Memento, error) {
+	datetime, err := memento.ParseDatetime(response.Header.Get(memento.MementoDatetimeHeader))
+	if err != nil {
+		return nil, fmt.Errorf("missing or invalid %s header: %w", memento.MementoDatetimeHeader, err)
+	}
+	if location := response.Header.Get("Content-Location"); location != "" {
+		if resolved, err := response.Request.URL.Parse(location); err == nil {
+			mementoURL = resolved.String()
+		}
+	}
+	return &entities.Memento{URL: mementoURL, Datetime: datetime}, nil
+}
+
+// Memento with datetime closest to the given time. If two are equally close, the older one is returned. Nil for empty list.
+func ClosestMemento(mementos []*entities.Memento, datetime time.Time) *entities.Memento {
+	var closest *entities.Memento
+	var closestDistance time.Duration
+	for _, candidate := range mementos {
+		distance := candidate.Datetime.Sub(datetime).Abs()
+		if closest == nil || distance < closestDistance || (distance == closestDistance && candidate.Datetime.Before(closest.Datetime)) {
+			closest = candidate
+			closestDistance = distance
+		}
+	}
+	return closest
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// The rule can't be used, for example the regular expression doesn't compile.
+	ErrInvalidPolicyRule = errors.New("invalid policy rule")
+	// The URL matches deny rule.
+	ErrPolicyDenied = errors.New("the URL is denied by policy")
+	// There are allow rules and the URL matches none of them.
+	ErrPolicyNotAllowed = errors.New("the URL is not allowed by policy")
+)
+
+// Error returned for URLs refused by the policy. It can be tested with errors.Is against ErrPolicyDenied
+// and ErrPolicyNotAllowed, errors.As gives the rule that refused the URL.
+type PolicyError struct {
+	// The matched deny rule. Nil if the URL didn't match any allow rule.
+	Rule *entities.PolicyRule
+}
+
+func (err *PolicyError) Error() string {
+	if err.Rule == nil {
+		return ErrPolicyNotAllowed.Error()
+	}
+	if err.Rule.Reason == "" {
+		return fmt.Sprintf("%s (%s %s)", ErrPolicyDenied.Error(), err.Rule.Kind, err.Rule.Pattern)
+	}
+	return ErrPolicyDenied.Error() + ": " + err.Rule.Reason
+}
+
+func (err *PolicyError) Unwrap() error {
+	if err.Rule == nil {
+		return ErrPolicyNotAllowed
+	}
+	return ErrPolicyDenied
+}
+
+// Content of the policy file.
+type policyFile struct {
+	Rules []*entities.PolicyRule `json:"rules"`
+}
+
+type compiledRule struct {
+	Rule  *entities.PolicyRule
+	Regex *regexp.Regexp
+}
+
+func NewPolicyService(log *slog.Logger, urlParser *UrlParserService, path string) *PolicyService {
+	assert.Must(log != nil, "NewPolicyService: log can't be nil")
+	assert.Must(urlParser != nil, "NewPolicyService: urlParser can't be nil")
+	return &PolicyService{
+		Log:       log,
+		UrlParser: urlParser,
+		Path:      path,
+	}
+}
+
+// Decides which submitted URLs are accepted. Deny rules always win. If there is at least one allow rule,
+// only URLs matching some allow rule are accepted, so "allow TLD cz" restricts the deployment to czech sites.
+// Without rules everything is accepted.
+//
+// The rules are read from JSON file at Path when the server starts, they are changed only by editing the file.
+type PolicyService struct {
+	Log       *slog.Logger
+	UrlParser *UrlParserService
+	// File with the rules. Empty means no rules.
+	Path string
+
+	mutex sync.RWMutex
+	rules []*compiledRule
+}
+
+// Load the rules from Path. Missing file means no rules.
+func (service *PolicyService) Load() error {
+	if service.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(service.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		service.Log.Info("PolicyService.Load found no policy file, all URLs are allowed", "path", service.Path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("PolicyService.Load failed to read %s: %w", service.Path, err)
+	}
+	file := new(policyFile)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(file)
+	if err != nil {
+		return fmt.Errorf("PolicyService.Load failed to parse %s: %w", service.Path, err)
+	}
+	rules := make([]*compiledRule, 0, len(file.Rules))
+	for i, rule := range file.Rules {
+		if rule == nil {
+			return fmt.Errorf("PolicyService.Load found empty rule %d in %s", i+1, service.Path)
+		}
+		compiled, err := service.compile(rule)
+		if err != nil {
+			return fmt.Errorf("PolicyService.Load found invalid rule %d in %s: %w", i+1, service.Path, err)
+		}
+		if compiled.Rule.ID == "" {
+			compiled.Rule.ID = rand.Text()
+		}
+		rules = append(rules, compiled)
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.rules = rules
+	service.Log.Info("PolicyService loaded rules", "path", service.Path, "count", len(rules))
+	return nil
+}
+
+// Copy of the rules in the order they were added.
+func (service *PolicyService) Rules() []*entities.PolicyRule {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+	rules := make([]*entities.PolicyRule, 0, len(service.rules))
+	for _, compiled := range service.rules {
+		rule := *compiled.Rule
+		rules = append(rules, &rule)
+	}
+	return rules
+}
+
+// Check the URL (cleaned and canonicalised) against the rules. Returns *PolicyError if the URL is refused.
+func (service *PolicyService) Check(u *url.URL) error {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+	if len(service.rules) == 0 {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	surt := service.UrlParser.SURTKey(u.String())
+	var allowedBy *entities.PolicyRule
+	hasAllowRules := false
+	for _, compiled := range service.rules {
+		rule := compiled.Rule
+		if rule.Action == entities.PolicyAllow {
+			hasAllowRules = true
+			if allowedBy != nil {
+				continue // Deny rules still need to be checked.
+			}
+		}
+		if !compiled.matches(u, host, surt) {
+			continue
+		}
+		if rule.Action == entities.PolicyDeny {
+			service.Log.Info("PolicyService denied URL", "url", u.String(), "rule", rule.ID, "kind", rule.Kind, "pattern", rule.Pattern, "reason", rule.Reason)
+			ruleCopy := *rule
+			return &PolicyError{Rule: &ruleCopy}
+		}
+		allowedBy = rule
+	}
+	if hasAllowRules && allowedBy == nil {
+		service.Log.Info("PolicyService refused URL not matching any allow rule", "url", u.String())
+		return &PolicyError{}
+	}
+	if allowedBy != nil {
+		service.Log.Debug("PolicyService allowed URL", "url", u.String(), "rule", allowedBy.ID)
+	}
+	return nil
+}
+
+func (compiled *compiledRule) matches(u *url.URL, host string, surt string) bool {
+	pattern := compiled.Rule.Pattern
+	switch compiled.Rule.Kind {
+	case entities.PolicyDomain:
+		return host == pattern || strings.HasSuffix(host, "."+pattern)
+	case entities.PolicyTLD:
+		return strings.HasSuffix(host, "."+pattern)
+	case entities.PolicySURTPrefix:
+		return strings.HasPrefix(surt, pattern)
+	case entities.PolicyRegex:
+		return compiled.Regex.MatchString(u.String())
+	}
+	return false
+}
+
+// Validate the rule and return its copy with normalised pattern.
+func (service *PolicyService) compile(rule *entities.PolicyRule) (*compiledRule, error) {
+	normalized := *rule
+	normalized.Pattern = strings.TrimSpace(normalized.Pattern)
+	normalized.Reason = strings.TrimSpace(normalized.Reason)
+	if !normalized.Action.IsPolicyAction() {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidPolicyRule, normalized.Action)
+	}
+	if normalized.Pattern == "" {
+		return nil, fmt.Errorf("%w: empty pattern", ErrInvalidPolicyRule)
+	}
+	compiled := &compiledRule{Rule: &normalized}
+	switch normalized.Kind {
+	case entities.PolicyDomain, entities.PolicyTLD:
+		domain := normalized.Pattern
+		// Take the host from URL pasted instead of domain.
+		if strings.Contains(domain, "://") {
+			parsed, err := url.Parse(domain)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidPolicyRule, err)
+			}
+			domain = parsed.Hostname()
+		}
+		domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+		domain, err := canonicalHost(domain)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPolicyRule, err)
+		}
+		if domain == "" || strings.ContainsAny(domain, "/:@ ") {
+			return nil, fmt.Errorf("%w: %q is not domain", ErrInvalidPolicyRule, normalized.Pattern)
+		}
+		if normalized.Kind == entities.PolicyTLD && strings.Contains(domain, ".") {
+			return nil, fmt.Errorf("%w: %q is not top-level domain", ErrInvalidPolicyRule, normalized.Pattern)
+		}
+		normalized.Pattern = domain
+	case entities.PolicySURTPrefix:
+		if strings.Contains(normalized.Pattern, "://") {
+			normalized.Pattern = service.UrlParser.SURTKey(normalized.Pattern)
+		} else {
+			// Keys are lowercase, see cdxj.SURT.
+			normalized.Pattern = strings.ToLower(normalized.Pattern)
+		}
+	case entities.PolicyRegex:
+		regex, err := regexp.Compile(normalized.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPolicyRule, err)
+		}
+		compiled.Regex = regex
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidPolicyRule, normalized.Kind)
+	}
+	return compiled, nil
+}
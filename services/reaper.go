@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"log/slog"
+	"time"
+)
+
+// StaleSeedReaper periodically looks for seeds that are Pending for too long and enqueues them again.
+// Requests and results may get lost in the queue (see package queue), this makes sure the seeds don't wait forever.
+// Seeds with requests still in the queue are skipped, the queue delivers them again by itself and enqueueing them
+// here too would capture the seed twice. Seeds that were enqueued MaxAttempts times are marked as DoneFailure.
+type StaleSeedReaper struct {
+	Log            *slog.Logger
+	SeedService    *SeedService
+	CaptureService *CaptureService
+
+	// How often to look for stale seeds.
+	Interval time.Duration
+	// How long can seed be Pending before it is considered lost.
+	Deadline time.Duration
+	// Maximum number of capture attempts of one seed.
+	MaxAttempts int
+	// Maximum number of seeds handled in one run.
+	BatchSize int
+}
+
+func NewStaleSeedReaper(
+	log *slog.Logger,
+	seedService *SeedService,
+	captureService *CaptureService,
+	interval,
+	deadline time.Duration,
+	maxAttempts int,
+) *StaleSeedReaper {
+	assert.Must(log != nil, "NewStaleSeedReaper: log can't be nil")
+	assert.Must(seedService != nil, "NewStaleSeedReaper: seedService can't be nil")
+	assert.Must(captureService != nil, "NewStaleSeedReaper: captureService can't be nil")
+	assert.Must(interval > 0, "NewStaleSeedReaper: interval must be positive")
+	assert.Must(deadline > 0, "NewStaleSeedReaper: deadline must be positive")
+	assert.Must(maxAttempts > 0, "NewStaleSeedReaper: maxAttempts must be positive")
+	return &StaleSeedReaper{
+		Log:            log,
+		SeedService:    seedService,
+		CaptureService: captureService,
+		Interval:       interval,
+		Deadline:       deadline,
+		MaxAttempts:    maxAttempts,
+		BatchSize:      100,
+	}
+}
+
+// Starts a new goroutine that periodically enqueues stale seeds until the context is done.
+func (reaper *StaleSeedReaper) Run(ctx context.Context) {
+	go reaper.run(ctx)
+}
+
+func (reaper *StaleSeedReaper) run(ctx context.Context) {
+	ticker := time.NewTicker(reaper.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			reaper.Log.Info("StaleSeedReaper.run context is done", "error", ctx.Err().Error())
+			return
+		case <-ticker.C:
+			reaper.Reap(ctx)
+		}
+	}
+}
+
+// Handle one batch of stale seeds. Errors are logged, the seeds will be tried again in the next run.
+func (reaper *StaleSeedReaper) Reap(ctx context.Context) {
+	seeds, err := reaper.SeedService.FindStalePending(reaper.Deadline, reaper.BatchSize)
+	if err != nil {
+		reaper.Log.Error("StaleSeedReaper.Reap failed to find stale seeds", "error", err.Error())
+		return
+	}
+	if len(seeds) == 0 {
+		return
+	}
+	// Without knowing what is in the queue any seed could be captured twice, so wait for the next run.
+	queued, err := reaper.CaptureService.QueuedSeeds(ctx)
+	if err != nil {
+		reaper.Log.Error("StaleSeedReaper.Reap failed to get seeds in the queue", "error", err.Error())
+		return
+	}
+	for _, seed := range seeds {
+		if queued[seed.ShadowID] {
+			reaper.Log.Debug("StaleSeedReaper.Reap skipped seed still in the queue", "shadowID", seed.ShadowID)
+			continue
+		}
+		if seed.CaptureAttempts >= reaper.MaxAttempts {
+			err = reaper.SeedService.UpdateState(seed.ShadowID, entities.DoneFailure)
+			if err != nil {
+				reaper.Log.Error("StaleSeedReaper.Reap failed to mark seed as failed", "shadowID", seed.ShadowID, "error", err.Error())
+				continue
+			}
+			reaper.Log.Warn("StaleSeedReaper.Reap gave up on seed", "shadowID", seed.ShadowID, "attempts", seed.CaptureAttempts)
+			continue
+		}
+		// It was already decided the seed needs capture, only the request got lost.
+		err = reaper.CaptureService.CaptureSeed(ctx, seed, CaptureRetry)
+		if err != nil {
+			reaper.Log.Error("StaleSeedReaper.Reap failed to enqueue seed again", "shadowID", seed.ShadowID, "error", err.Error())
+			continue
+		}
+		reaper.Log.Info("StaleSeedReaper.Reap enqueued stale seed again", "shadowID", seed.ShadowID, "attempt", seed.CaptureAttempts+1)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"jinovatka/artifact"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var ErrNoReplayFile = errors.New("no WACZ file of the seed found")
+
+// Files of the ReplayWeb.page viewer, they must be in the root of the viewer fs.FS.
+var ReplayViewerFiles = []string{"ui.js", "sw.js"}
+
+// Finds WACZ files of seeds, so they can be replayed before the archive ingests them.
+type ReplayService struct {
+	Log             *slog.Logger
+	SeedService     *SeedService
+	ArtifactService *ArtifactService
+	// Origin the viewer is served from (scheme and host). Nil disables replay.
+	Origin *url.URL
+	// Files of ReplayWeb.page, see ReplayViewerFiles. Nil disables replay.
+	Viewer fs.FS
+}
+
+// Origin and viewer are optional, replay is disabled without them.
+func NewReplayService(log *slog.Logger, seedService *SeedService, artifactService *ArtifactService, origin *url.URL, viewer fs.FS) *ReplayService {
+	assert.Must(log != nil, "NewReplayService: log can't be nil")
+	assert.Must(seedService != nil, "NewReplayService: seedService can't be nil")
+	assert.Must(artifactService != nil, "NewReplayService: artifactService can't be nil")
+	if viewer != nil {
+		for _, name := range ReplayViewerFiles {
+			if _, err := fs.Stat(viewer, name); err != nil {
+				log.Warn("NewReplayService did not find ReplayWeb.page file, replay is disabled", "file", name)
+				viewer = nil
+				break
+			}
+		}
+	}
+	return &ReplayService{
+		Log:             log,
+		SeedService:     seedService,
+		ArtifactService: artifactService,
+		Origin:          origin,
+		Viewer:          viewer,
+	}
+}
+
+// Replay needs the artifact storage, the replay origin and the viewer files.
+func (service *ReplayService) Enabled() bool {
+	return service.ArtifactService.Enabled() && service.Origin != nil && service.Viewer != nil
+}
+
+// Opened WACZ file of the seed. The caller must close Content.
+type ReplayFile struct {
+	Content io.ReadSeekCloser
+	Info    *artifact.Info
+	// Capture that created the file. Nil if the file was found only by the ShadowID of the seed.
+	Capture *entities.SeedCapture
+}
+
+// Find the WACZ of the latest successful capture of the seed.
+// Workers store every capture as <ShadowID>/<timestamp>.wacz and report the key.
+// Older captures have only the location reported by the worker, its file name is used as the key then.
+// Before that workers named the files <ShadowID>.wacz, that is used when no capture has the file.
+func (service *ReplayService) Open(ctx context.Context, seed *entities.Seed) (*ReplayFile, error) {
+	if !service.Enabled() {
+		return nil, ErrArtifactsDisabled
+	}
+	captures, err := service.SeedService.GetCaptures(seed.ShadowID)
+	if err != nil {
+		return nil, fmt.Errorf("ReplayService.Open failed to get captures: %w", err)
+	}
+	// Captures are newest first.
+	for _, capture := range captures {
+		if capture.State != entities.DoneSuccess {
+			continue
+		}
+		key := capture.WaczKey
+		if key == "" && strings.HasSuffix(capture.WaczLocation, ".wacz") {
+			key = path.Base(strings.ReplaceAll(capture.WaczLocation, "\\", "/"))
+		}
+		if key == "" {
+			continue
+		}
+		file, err := service.open(ctx, key)
+		if errors.Is(err, artifact.ErrNotFound) || errors.Is(err, artifact.ErrInvalidKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ReplayService.Open failed to open WACZ of capture: %w", err)
+		}
+		file.Capture = capture
+		return file, nil
+	}
+	file, err := service.open(ctx, seed.ShadowID+".wacz")
+	if errors.Is(err, artifact.ErrNotFound) {
+		return nil, ErrNoReplayFile
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ReplayService.Open failed to open WACZ: %w", err)
+	}
+	return file, nil
+}
+
+func (service *ReplayService) open(ctx context.Context, key string) (*ReplayFile, error) {
+	content, info, err := service.ArtifactService.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayFile{Content: content, Info: info}, nil
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jinovatka/assert"
+	"jinovatka/cron"
+	"jinovatka/entities"
+	"jinovatka/storage"
+	"log/slog"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// Maximum number of schedule runs shown in the seed history.
+const MaxShownScheduleRuns = 50
+
+// ScheduleService keeps schedules of repeated captures and periodically enqueues seeds whose schedule is due.
+// Every run is recorded in the history of the seed, including seeds that were skipped because they were still Pending.
+type ScheduleService struct {
+	Log            *slog.Logger
+	Repository     storage.ScheduleRepository
+	SeedService    *SeedService
+	CaptureService *CaptureService
+
+	// Location of the times entered by users. Recurring schedules keep the time of day in it.
+	Location *time.Location
+	// How often to look for due schedules.
+	Interval time.Duration
+	// Maximum number of schedules handled in one run.
+	BatchSize int
+}
+
+func NewScheduleService(
+	log *slog.Logger,
+	repository storage.ScheduleRepository,
+	seedService *SeedService,
+	captureService *CaptureService,
+	location *time.Location,
+	interval time.Duration,
+) *ScheduleService {
+	assert.Must(log != nil, "NewScheduleService: log can't be nil")
+	assert.Must(repository != nil, "NewScheduleService: repository can't be nil")
+	assert.Must(seedService != nil, "NewScheduleService: seedService can't be nil")
+	assert.Must(captureService != nil, "NewScheduleService: captureService can't be nil")
+	assert.Must(location != nil, "NewScheduleService: location can't be nil")
+	assert.Must(interval > 0, "NewScheduleService: interval must be positive")
+	return &ScheduleService{
+		Log:            log,
+		Repository:     repository,
+		SeedService:    seedService,
+		CaptureService: captureService,
+		Location:       location,
+		Interval:       interval,
+		BatchSize:      100,
+	}
+}
+
+// Validate the schedule, plan its first run and store it. The previous schedule of the group or seed is replaced.
+// Returns ErrInvalidSchedule if the schedule can't be used.
+func (service *ScheduleService) SetSchedule(schedule *entities.Schedule) error {
+	if (schedule.GroupShadowID == "") == (schedule.SeedShadowID == "") {
+		return fmt.Errorf("ScheduleService.SetSchedule: %w: schedule must belong to either group or seed", ErrInvalidSchedule)
+	}
+	if !schedule.Kind.IsScheduleKind() {
+		return fmt.Errorf("ScheduleService.SetSchedule: %w: unknown kind %q", ErrInvalidSchedule, schedule.Kind)
+	}
+	if schedule.Start.IsZero() {
+		return fmt.Errorf("ScheduleService.SetSchedule: %w: start is not set", ErrInvalidSchedule)
+	}
+	schedule.Start = schedule.Start.In(service.Location)
+	if schedule.Kind == entities.ScheduleCron {
+		expression, err := cron.Parse(schedule.Cron)
+		if err != nil {
+			return fmt.Errorf("ScheduleService.SetSchedule: %w: %w", ErrInvalidSchedule, err)
+		}
+		schedule.Cron = expression.Source
+	} else {
+		schedule.Cron = ""
+	}
+	next, err := service.NextRun(schedule, time.Now())
+	if err != nil {
+		return fmt.Errorf("ScheduleService.SetSchedule: %w", err)
+	}
+	if next.IsZero() {
+		return fmt.Errorf("ScheduleService.SetSchedule: %w: the schedule has no run in the future", ErrInvalidSchedule)
+	}
+	schedule.NextRunAt = next
+	schedule.LastRunAt = time.Time{}
+	err = service.Repository.SaveSchedule(schedule)
+	if err != nil {
+		return fmt.Errorf("ScheduleService.SetSchedule failed to save schedule: %w", err)
+	}
+	return nil
+}
+
+// Schedule of the group. Nil if the group has none.
+func (service *ScheduleService) GetGroupSchedule(groupShadow string) (*entities.Schedule, error) {
+	return service.Repository.GetSchedule(groupShadow, "")
+}
+
+// Schedule of the single seed. Nil if the seed has none. Schedule of its group is not included.
+func (service *ScheduleService) GetSeedSchedule(seedShadow string) (*entities.Schedule, error) {
+	return service.Repository.GetSchedule("", seedShadow)
+}
+
+func (service *ScheduleService) CancelGroupSchedule(groupShadow string) error {
+	return service.Repository.DeleteSchedule(groupShadow, "")
+}
+
+func (service *ScheduleService) CancelSeedSchedule(seedShadow string) error {
+	return service.Repository.DeleteSchedule("", seedShadow)
+}
+
+// Latest runs of schedules for the seed, newest first.
+func (service *ScheduleService) GetScheduleRuns(seedShadow string) ([]*entities.ScheduleRun, error) {
+	return service.Repository.GetScheduleRuns(seedShadow, MaxShownScheduleRuns)
+}
+
+// The first run of the schedule after the given time. Zero value if there is no such run.
+func (service *ScheduleService) NextRun(schedule *entities.Schedule, after time.Time) (time.Time, error) {
+	start := schedule.Start.In(service.Location)
+	after = after.In(service.Location)
+	if start.After(after) && schedule.Kind != entities.ScheduleCron {
+		return start, nil
+	}
+	switch schedule.Kind {
+	case entities.ScheduleOnce:
+		return time.Time{}, nil
+	case entities.ScheduleDaily:
+		return nextOccurrence(start, after, 24*time.Hour, func(n int) time.Time { return start.AddDate(0, 0, n) }), nil
+	case entities.ScheduleWeekly:
+		return nextOccurrence(start, after, 7*24*time.Hour, func(n int) time.Time { return start.AddDate(0, 0, 7*n) }), nil
+	case entities.ScheduleMonthly:
+		return nextOccurrence(start, after, 28*24*time.Hour, func(n int) time.Time { return addMonths(start, n) }), nil
+	case entities.ScheduleCron:
+		expression, err := cron.Parse(schedule.Cron)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+		}
+		// Next looks after the given minute, the start itself can be the first run.
+		return expression.Next(later(after, start.Add(-time.Nanosecond))), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: unknown kind %q", ErrInvalidSchedule, schedule.Kind)
+}
+
+// The first occurrence(n) after the given time. Occurrences are counted from the start on the clock,
+// so the time of day is kept across daylight saving changes. period is the shortest gap between them.
+func nextOccurrence(start, after time.Time, period time.Duration, occurrence func(n int) time.Time) time.Time {
+	// Skip the occurrences that are surely in the past, then find the first one after.
+	n := max(int(after.Sub(start)/(period+time.Hour))-1, 0)
+	for !occurrence(n).After(after) {
+		n++
+	}
+	return occurrence(n)
+}
+
+// The same day of the month n months later. Days that the month doesn't have become its last day.
+func addMonths(t time.Time, n int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return firstOfMonth.AddDate(0, 0, min(t.Day(), lastDay)-1)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Starts a new goroutine that periodically enqueues seeds of due schedules until the context is done.
+func (service *ScheduleService) Run(ctx context.Context) {
+	go service.run(ctx)
+}
+
+func (service *ScheduleService) run(ctx context.Context) {
+	ticker := time.NewTicker(service.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			service.Log.Info("ScheduleService.run context is done", "error", ctx.Err().Error())
+			return
+		case <-ticker.C:
+			service.RunDue(ctx)
+		}
+	}
+}
+
+// Handle one batch of due schedules. Runs missed while the server was down are not made up, only one run is made
+// and the next one is planned after now. Errors are logged, schedules that failed are tried again in the next run.
+func (service *ScheduleService) RunDue(ctx context.Context) {
+	now := time.Now()
+	schedules, err := service.Repository.FindDueSchedules(now, service.BatchSize)
+	if err != nil {
+		service.Log.Error("ScheduleService.RunDue failed to find due schedules", "error", err.Error())
+		return
+	}
+	for _, schedule := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+		err = service.runSchedule(ctx, schedule, now)
+		if err != nil {
+			service.Log.Error("ScheduleService.RunDue failed to run schedule", "scheduleID", schedule.ID, "error", err.Error())
+		}
+	}
+}
+
+func (service *ScheduleService) runSchedule(ctx context.Context, schedule *entities.Schedule, now time.Time) error {
+	var seeds []*entities.Seed
+	if schedule.GroupShadowID != "" {
+		group, err := service.SeedService.GetGroup(schedule.GroupShadowID)
+		if err != nil {
+			return fmt.Errorf("ScheduleService.runSchedule failed to get group: %w", err)
+		}
+		seeds = group.Seeds
+	} else {
+		seed, err := service.SeedService.GetSeed(schedule.SeedShadowID)
+		if err != nil {
+			return fmt.Errorf("ScheduleService.runSchedule failed to get seed: %w", err)
+		}
+		seeds = []*entities.Seed{seed}
+	}
+
+	runs := make([]*entities.ScheduleRun, 0, len(seeds))
+	for _, seed := range seeds {
+		run := &entities.ScheduleRun{SeedShadowID: seed.ShadowID, ScheduledAt: schedule.NextRunAt, RanAt: now}
+		// Scheduled capture is meant to record the page as it is now, reused capture or memento would defeat it.
+		if seed.State == entities.Pending {
+			run.Skipped = true
+		} else if err := service.CaptureService.CaptureSeed(ctx, seed, CaptureFresh); err != nil {
+			service.Log.Error("ScheduleService.runSchedule failed to enqueue seed", "scheduleID", schedule.ID, "shadowID", seed.ShadowID, "error", err.Error())
+			run.Error = err.Error()
+		}
+		runs = append(runs, run)
+	}
+
+	next, err := service.NextRun(schedule, now)
+	if err != nil {
+		// Stored schedule was valid when it was set, drop it rather than running it every time.
+		service.Log.Error("ScheduleService.runSchedule failed to plan next run", "scheduleID", schedule.ID, "error", err.Error())
+		next = time.Time{}
+	}
+	schedule.LastRunAt = now
+	schedule.NextRunAt = next
+	err = service.Repository.RecordRuns(schedule, runs)
+	if err != nil {
+		return fmt.Errorf("ScheduleService.runSchedule failed to record runs: %w", err)
+	}
+	service.Log.Info("ScheduleService ran schedule", "scheduleID", schedule.ID, "seeds", len(runs), "next", next)
+	return nil
+}
@@ -1,46 +1,79 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"jinovatka/assert"
+	"jinovatka/cdxj"
 	"jinovatka/entities"
 	"jinovatka/storage"
+	"jinovatka/utils"
 	"log/slog"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
-var ErrEmptyList = errors.New("list was empty")
+// Errors returned by Save and SaveList.
+var (
+	ErrEmptyList     = errors.New("list was empty")
+	ErrInputTooLarge = errors.New("input data is too large")
+	ErrTooManyLines  = errors.New("input has too many lines")
+	// Some lines of the list are invalid. The reasons are in the returned LineValidation results.
+	ErrInvalidLines = errors.New("list contains invalid URLs")
+	ErrURLTooLong   = errors.New("the URL is too long")
+)
+
+// The CaptureMetadata can't be stored, because they are malformed. Repeating the call won't help.
+var ErrInvalidMetadata = errors.New("invalid capture metadata")
 
 func NewSeedService(
 	log *slog.Logger,
 	repository storage.SeedRepository,
+	captureRepository storage.CaptureRepository,
 	maxInputListLineLength,
 	maxInputListLines int,
+	waybackURL string,
+	urlParser *UrlParserService,
+	policy *PolicyService,
 ) *SeedService {
 	assert.Must(log != nil, "NewSeedService: log can't be nil")
 	assert.Must(repository != nil, "NewSeedService: repository can't be nil")
+	assert.Must(captureRepository != nil, "NewSeedService: captureRepository can't be nil")
+	assert.Must(waybackURL != "", "NewSeedService: waybackURL can't be empty")
+	assert.Must(urlParser != nil, "NewSeedService: urlParser can't be nil")
+	assert.Must(policy != nil, "NewSeedService: policy can't be nil")
 	return &SeedService{
 		Log:                    log,
 		Repository:             repository,
-		UrlParser:              new(UrlParserService),
+		CaptureRepository:      captureRepository,
+		UrlParser:              urlParser,
+		Policy:                 policy,
 		MaxInputListLineLength: maxInputListLineLength,
 		MaxInputListLines:      maxInputListLines,
+		WaybackURL:             waybackURL,
 	}
 }
 
 type SeedService struct {
-	Log        *slog.Logger
-	Repository storage.SeedRepository
+	Log               *slog.Logger
+	Repository        storage.SeedRepository
+	CaptureRepository storage.CaptureRepository
 
 	UrlParser *UrlParserService
+	// Decides which URLs can be saved.
+	Policy *PolicyService
 
 	// Maximum length of seed URL adress
 	MaxInputListLineLength int
 	// Maximum number of lines (seeds) that can be parsed in one call
 	MaxInputListLines int
+	// Prefix of archival URLs.
+	WaybackURL string
 }
 
 type SeedState int
@@ -52,14 +85,72 @@ const (
 )
 
 type FindSeedsArgs struct {
-	URL       string
+	// Part of the seed URL.
+	URL string
+	// Match URL only at the beginning of seed URL.
+	URLPrefix bool
+	// Match seeds of the same page as URL by their SURT keys instead. URLPrefix is ignored.
+	SamePage bool
+	// Seeds harvested on or after this day.
 	StartDate *time.Time
-	EndDate   *time.Time
+	// Seeds harvested on or before this day (the whole day is included).
+	EndDate *time.Time
+	// If not empty, only seeds in this state are returned.
+	State entities.CaptureState
+	// If not nil, only public or only private seeds are returned.
+	Public *bool
+	// If not empty, only seeds from this group are returned.
+	GroupShadowID string
+	// If true, only seeds with missing or corrupted WACZ are returned.
+	FixityProblem bool
+
+	// Requested page. Pages are indexed from 1.
+	Page int
+	// Number of seeds on one page. If not positive, utils.DefaultLinesPerPage is used.
+	LinesPerPage int
 }
 
-func (service *SeedService) FindSeeds(arguments *FindSeedsArgs) ([]*entities.Seed, error) {
-	seeds := make([]*entities.Seed, 58)
-	return seeds, nil
+// Find one page of seeds matching the arguments. Returns the seeds and total number of matching seeds.
+func (service *SeedService) FindSeeds(arguments *FindSeedsArgs) ([]*entities.Seed, int, error) {
+	if arguments == nil {
+		arguments = new(FindSeedsArgs)
+	}
+	if arguments.State != "" && !arguments.State.IsCaptureState() {
+		return nil, 0, errors.New("SeedService.FindSeeds received invalid state argument")
+	}
+	linesPerPage := arguments.LinesPerPage
+	if linesPerPage <= 0 {
+		linesPerPage = utils.DefaultLinesPerPage
+	}
+	page := max(arguments.Page, 1)
+
+	query := &storage.SeedQuery{
+		URL:           strings.TrimSpace(arguments.URL),
+		URLPrefix:     arguments.URLPrefix,
+		State:         arguments.State,
+		Public:        arguments.Public,
+		GroupShadowID: arguments.GroupShadowID,
+		FixityProblem: arguments.FixityProblem,
+		Offset:        (page - 1) * linesPerPage,
+		Limit:         linesPerPage,
+	}
+	if arguments.SamePage && query.URL != "" {
+		query.SURT = service.UrlParser.SURTKey(query.URL)
+		query.URL = ""
+	}
+	if arguments.StartDate != nil {
+		query.HarvestedFrom = *arguments.StartDate
+	}
+	if arguments.EndDate != nil {
+		// Include the whole end day.
+		query.HarvestedTo = arguments.EndDate.AddDate(0, 0, 1)
+	}
+
+	seeds, count, err := service.Repository.FindSeeds(query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("SeedService.FindSeeds failed to find seeds in repository: %w", err)
+	}
+	return seeds, count, nil
 }
 
 // Save single seed to repository. This function is deprecated.
@@ -70,6 +161,7 @@ func (service *SeedService) SaveSeed(seedURL string) error {
 
 	seed := &entities.Seed{
 		URL:      seedURL,
+		SURT:     service.UrlParser.SURTKey(seedURL),
 		Public:   true,
 		State:    entities.NotEnqueued,
 		ShadowID: shadow,
@@ -85,51 +177,97 @@ func (service *SeedService) SaveSeed(seedURL string) error {
 
 // Takes string consisting of newline delimited list of URL adresses.
 // Checks input data size, parses them into slice of strings and delegates to SaveList.
-func (service *SeedService) Save(urlsList string, storeGroup bool) (*entities.SeedsGroup, error) {
+func (service *SeedService) Save(ctx context.Context, urlsList string, storeGroup bool, mode SaveMode) (*entities.SeedsGroup, []*LineValidation, error) {
 	if urlsList == "" {
-		return nil, errors.New("SeedServie.Save no input data")
+		return nil, nil, ErrEmptyList
 	}
 	// Check the entire length of the string.
 	if len(urlsList) > (service.MaxInputListLineLength * service.MaxInputListLines) {
-		return nil, errors.New("SeedService.Save input data is too large")
+		return nil, nil, ErrInputTooLarge
 	}
 	lines := strings.Split(urlsList, "\n")
 	// Now check just the number of lines.
 	if len(lines) > service.MaxInputListLines {
-		return nil, errors.New("SeedService.Save too many lines")
+		return nil, nil, ErrTooManyLines
 	}
-	return service.SaveList(lines, storeGroup)
+	return service.SaveList(ctx, lines, storeGroup, mode)
+}
+
+// What SaveList does when some lines are invalid.
+type SaveMode int
+
+const (
+	// Nothing is saved if any line is invalid.
+	SaveAllOrNothing SaveMode = iota
+	// Valid lines are saved, invalid lines are only reported.
+	SaveValidOnly
+)
+
+// Result of validation of one non empty line of the input list.
+type LineValidation struct {
+	// Number of the line in the input. Lines are numbered from 1.
+	Line int
+	// The line as it was recieved.
+	Input string
+	// Cleaned URL. Empty if the line is invalid.
+	URL string
+	// ShadowID of the saved seed. Empty if the line is invalid or nothing was saved.
+	ShadowID string
+	// Reason of rejection. It can be tested with errors.Is against ErrURLTooLong, the UrlParserService errors
+	// and ErrPolicyDenied or ErrPolicyNotAllowed (the error is *PolicyError then).
+	// Nil if the line is valid.
+	Err error
+}
+
+func (validation *LineValidation) Valid() bool {
+	return validation.Err == nil
 }
 
-// Save list of URL adresses as Seeds. Does format validation but does not check input data size.
-// For saving input from untrusted source use SeedService.Save instead.
-func (service *SeedService) SaveList(lines []string, storeGroup bool) (*entities.SeedsGroup, error) {
+// Save list of URL adresses as Seeds. Every non empty line is validated with ValidateURLs and the results are returned
+// in the same order as the lines. If any line is invalid and mode is SaveAllOrNothing, nothing is saved and ErrInvalidLines is returned.
+// Does not check size of the whole input. For saving input from untrusted source use SeedService.Save instead.
+func (service *SeedService) SaveList(ctx context.Context, lines []string, storeGroup bool, mode SaveMode) (*entities.SeedsGroup, []*LineValidation, error) {
 	if len(lines) == 0 {
-		return nil, errors.New("SeedService.SaveList no input data")
+		return nil, nil, ErrEmptyList
 	}
-	seeds := make([]*entities.Seed, 0, len(lines))
-	for _, url := range lines {
-		url = strings.TrimSpace(url)
-		if url == "" { // Skip empty lines
+	results := make([]*LineValidation, 0, len(lines))
+	inputs := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" { // Skip empty lines
 			continue
 		}
-		url, err := service.UrlParser.ParseAndCleanURL(url, false)
-		if err != nil {
-			// TODO: Log this in some smart way.
-			return nil, fmt.Errorf("SeedService.SaveList failed to parse URL: %w", err)
+		results = append(results, &LineValidation{Line: i + 1, Input: line})
+		inputs = append(inputs, line)
+	}
+	cleaned, errs := service.ValidateURLs(ctx, inputs)
+
+	seeds := make([]*entities.Seed, 0, len(results))
+	invalid := 0
+	for i, result := range results {
+		result.URL, result.Err = cleaned[i], errs[i]
+		if result.Err != nil {
+			service.Log.Info("SeedService.SaveList rejected line", "line", result.Line, "error", result.Err.Error())
+			invalid++
+			continue
 		}
-		shadow := rand.Text()
-		seed := &entities.Seed{
-			URL:      url.String(),
+		result.ShadowID = rand.Text()
+		seeds = append(seeds, &entities.Seed{
+			URL:      result.URL,
+			SURT:     service.UrlParser.SURTKey(result.URL),
 			Public:   true,
 			State:    entities.NotEnqueued,
-			ShadowID: shadow,
-		}
-		seeds = append(seeds, seed)
+			ShadowID: result.ShadowID,
+		})
 	}
 
-	if len(seeds) == 0 {
-		return nil, ErrEmptyList
+	if len(results) == 0 {
+		return nil, nil, ErrEmptyList
+	}
+	if invalid > 0 && (mode == SaveAllOrNothing || len(seeds) == 0) {
+		for _, result := range results {
+			result.ShadowID = ""
+		}
+		return nil, results, ErrInvalidLines
 	}
 
 	var err error
@@ -142,10 +280,55 @@ func (service *SeedService) SaveList(lines []string, storeGroup bool) (*entities
 		err = service.Repository.Save(seeds)
 	}
 	if err != nil {
-		return group, fmt.Errorf("SeedService.SaveList failed to save seeds to repository: %w", err)
+		return group, results, fmt.Errorf("SeedService.SaveList failed to save seeds to repository: %w", err)
+	}
+
+	return group, results, nil
+}
+
+// Limits of validation of one list of URLs. Host lookups are slow, so the URLs are validated concurrently
+// and the whole list must be validated within validationTimeout. Lines left after the timeout are unresolvable.
+const (
+	validationConcurrency = 8
+	validationTimeout     = 30 * time.Second
+)
+
+// Check the URLs the same way SaveList does. The cleaned URLs and the errors are in the same order as the inputs,
+// cleaned URL is empty where the error is not nil.
+func (service *SeedService) ValidateURLs(ctx context.Context, inputs []string) ([]string, []error) {
+	ctx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+	cleaned := make([]string, len(inputs))
+	errs := make([]error, len(inputs))
+	limit := make(chan struct{}, validationConcurrency)
+	var wait sync.WaitGroup
+	for i, input := range inputs {
+		wait.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wait.Done()
+			defer func() { <-limit }()
+			cleaned[i], errs[i] = service.ValidateURL(ctx, input)
+		}()
 	}
+	wait.Wait()
+	return cleaned, errs
+}
 
-	return group, nil
+// Check single URL adress the same way SaveList does and return its cleaned form.
+func (service *SeedService) ValidateURL(ctx context.Context, seedURL string) (string, error) {
+	if len(seedURL) > service.MaxInputListLineLength {
+		return "", ErrURLTooLong
+	}
+	url, err := service.UrlParser.ParseAndCleanURL(ctx, seedURL, false)
+	if err != nil {
+		return "", err
+	}
+	err = service.Policy.Check(url)
+	if err != nil {
+		return "", err
+	}
+	return url.String(), nil
 }
 
 func (service *SeedService) GetGroup(shadow string) (*entities.SeedsGroup, error) {
@@ -163,34 +346,207 @@ func (service *SeedService) UpdateState(shadow string, state entities.CaptureSta
 	return service.Repository.UpdateState(shadow, state)
 }
 
-func (service *SeedService) UpdateMetadata(shadow string, metadata *entities.CaptureMetadata) error {
-	// Check that timestamp is valid. It needs to be 14 (second precision) or 17 (nanosecond precision) chars long.
-	timestampLength := len(metadata.Timestamp)
-	if timestampLength != 14 && timestampLength != 17 {
-		return errors.New("SeedService.UpdateMetadata recieved CaptureMetadata with invalid timestamp length")
+// Store capture described by the result in the seed capture history.
+// Successful capture with metadata also becomes the latest harvest of the seed if it is newer.
+// If the metadata are invalid, the capture is stored as failed and ErrInvalidMetadata is returned.
+func (service *SeedService) RecordCapture(result *entities.CaptureResult) error {
+	capture := &entities.SeedCapture{
+		SeedShadowID:  result.SeedShadowID,
+		State:         entities.DoneFailure,
+		ErrorMessages: slices.Clone(result.ErrorMessages),
+		WaczLocation:  result.WaczLocation,
+		WaczKey:       result.WaczKey,
+		WaczSize:      result.WaczSize,
+		WaczSHA256:    result.WaczSHA256,
+		WorkerID:      result.WorkerID,
+		DeliveryID:    result.DeliveryID,
+		PageMetadata:  service.checkPageMetadata(result.SeedShadowID, result.PageMetadata),
+	}
+	var metadataErr error
+	if result.CaptureMetadata != nil {
+		capture.CapturedURL = result.CaptureMetadata.CapturedUrl
+		capture.ArchivalURL, capture.CapturedAt, metadataErr = service.parseMetadata(result.CaptureMetadata)
+		if metadataErr != nil {
+			capture.ArchivalURL = ""
+			capture.ErrorMessages = append(capture.ErrorMessages, metadataErr.Error())
+		}
+	}
+	if result.Done && len(capture.ErrorMessages) == 0 && capture.ArchivalURL != "" {
+		capture.State = entities.DoneSuccess
+	}
+	if capture.State == entities.DoneFailure {
+		switch {
+		case result.ErrorCategory != entities.NoCaptureError && result.ErrorCategory.IsCaptureErrorCategory():
+			capture.ErrorCategory = result.ErrorCategory
+		case metadataErr != nil && len(result.ErrorMessages) == 0:
+			capture.ErrorCategory = entities.MetadataError
+		case len(capture.ErrorMessages) == 0:
+			// Worker reported no error, but there is no archival URL either.
+			capture.ErrorCategory = entities.MetadataError
+			capture.ErrorMessages = append(capture.ErrorMessages, "worker didn't report capture metadata")
+		default:
+			capture.ErrorCategory = classifyCaptureErrors(capture.ErrorMessages)
+		}
+	}
+
+	err := service.CaptureRepository.SaveCapture(capture)
+	if err != nil {
+		return fmt.Errorf("SeedService.RecordCapture failed to save capture: %w", err)
+	}
+	return metadataErr
+}
+
+// Identifies captures taken over from mementos of the web archive. Used as WorkerID.
+const MementoWorkerID = "memento"
+
+// Record existing memento from the web archive as successful capture of the seed.
+func (service *SeedService) RecordMemento(seed *entities.Seed, memento *entities.Memento) error {
+	capture := &entities.SeedCapture{
+		SeedShadowID:  seed.ShadowID,
+		State:         entities.DoneSuccess,
+		CapturedAt:    memento.Datetime,
+		CapturedURL:   seed.URL,
+		ArchivalURL:   memento.URL,
+		ErrorMessages: []string{},
+		WorkerID:      MementoWorkerID,
+	}
+	err := service.CaptureRepository.SaveCapture(capture)
+	if err != nil {
+		return fmt.Errorf("SeedService.RecordMemento failed to save capture: %w", err)
+	}
+	return nil
+}
+
+// The latest successful capture of the URL of the seed made for other seed in the last freshness.
+// Returns nil if there is none.
+func (service *SeedService) FindReusableCapture(seed *entities.Seed, freshness time.Duration) (*entities.SeedCapture, error) {
+	return service.CaptureRepository.FindReusableCapture(seed.URL, seed.ShadowID, time.Now().Add(-freshness))
+}
+
+// Record capture of another seed with the same URL as capture of the seed. The seed gets the same archival URL,
+// WACZ and metadata, and the capture remembers where it came from.
+func (service *SeedService) RecordReusedCapture(seed *entities.Seed, reused *entities.SeedCapture) error {
+	capture := &entities.SeedCapture{
+		SeedShadowID:    seed.ShadowID,
+		State:           entities.DoneSuccess,
+		CapturedAt:      reused.CapturedAt,
+		CapturedURL:     reused.CapturedURL,
+		ArchivalURL:     reused.ArchivalURL,
+		WaczLocation:    reused.WaczLocation,
+		WaczKey:         reused.WaczKey,
+		WaczSize:        reused.WaczSize,
+		WaczSHA256:      reused.WaczSHA256,
+		ErrorMessages:   []string{},
+		WorkerID:        reused.WorkerID,
+		PageMetadata:    reused.PageMetadata,
+		ReusedCaptureID: reused.ID,
+	}
+	err := service.CaptureRepository.SaveCapture(capture)
+	if err != nil {
+		return fmt.Errorf("SeedService.RecordReusedCapture failed to save capture: %w", err)
+	}
+	return nil
+}
+
+// Copy of the page metadata without canonical URL that is not absolute http(s) URL. The canonical URL comes
+// from the captured page and is shown as link on the seed page and in the exports, so "javascript:" must not get there.
+func (service *SeedService) checkPageMetadata(seedShadowID string, metadata *entities.PageMetadata) *entities.PageMetadata {
+	if metadata == nil {
+		return nil
+	}
+	checked := *metadata
+	if checked.CanonicalURL != "" && !isWebURL(checked.CanonicalURL) {
+		service.Log.Warn("SeedService.RecordCapture dropped canonical URL that is not http(s)", "shadowID", seedShadowID, "canonicalURL", checked.CanonicalURL)
+		checked.CanonicalURL = ""
+	}
+	return &checked
+}
+
+// Absolute http or https URL with host.
+func isWebURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	return (scheme == "http" || scheme == "https") && parsed.Host != ""
+}
+
+// Create archival URL and parse capture time from metadata.
+func (service *SeedService) parseMetadata(metadata *entities.CaptureMetadata) (string, time.Time, error) {
+	archivedAt, err := cdxj.ParseTimestamp(metadata.Timestamp)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("SeedService.parseMetadata failed to parse timestamp: %w: %w", ErrInvalidMetadata, err)
+	}
+	// The archival URL must point to this capture, shorter timestamp could point to another capture of the same day.
+	if cdxj.Precision(metadata.Timestamp) < len(cdxj.TimestampFormat) {
+		return "", time.Time{}, fmt.Errorf("SeedService.parseMetadata recieved CaptureMetadata with timestamp shorter than seconds: %w", ErrInvalidMetadata)
 	}
 
 	// Create archivalURL
-	// TODO: Move this to config
-	const waybackURL = "https://wayback.webarchiv.cz/wayback/"
 	// Intentinally left unescaped. Escaping the capturedUrl, while it may seem reasonable, will break compatibility with openwayback.
 	waybackPagePath := metadata.Timestamp + "/" + metadata.CapturedUrl
-	archivalURL := waybackURL + waybackPagePath
+	archivalURL := service.WaybackURL + waybackPagePath
 
-	// If timestamp is the long version, then add decimal point before the fractional second part to allow parsing by time.Parse.
-	timestamp := metadata.Timestamp
-	if timestampLength == 17 {
-		timestamp = timestamp[:14] + "." + timestamp[14:]
-	}
+	return archivalURL, archivedAt, nil
+}
 
-	service.Log.Info("Timestamp: " + timestamp)
+// All captures of the seed, newest first.
+func (service *SeedService) GetCaptures(shadow string) ([]*entities.SeedCapture, error) {
+	return service.CaptureRepository.GetCaptures(shadow)
+}
 
-	// Parse timestamp into time.Time. This format covers both short and long variants as specifying fractional seconds part is optinal.
-	const format = "20060102150405"
-	archivedAt, err := time.Parse(format, timestamp)
+// Mementos of the URL made from successful captures of public seeds, oldest first.
+// The same archival URL is listed only once, even if more seeds share it.
+func (service *SeedService) FindMementos(url string) ([]*entities.Memento, error) {
+	captures, err := service.CaptureRepository.FindSuccessfulCaptures(url)
 	if err != nil {
-		return fmt.Errorf("SeedService.UpdateMetadata failed to parse timestamp: %w", err)
+		return nil, fmt.Errorf("SeedService.FindMementos failed to find captures: %w", err)
+	}
+	seen := make(map[string]bool, len(captures))
+	mementos := make([]*entities.Memento, 0, len(captures))
+	for _, capture := range captures {
+		if seen[capture.ArchivalURL] {
+			continue
+		}
+		seen[capture.ArchivalURL] = true
+		mementos = append(mementos, &entities.Memento{URL: capture.ArchivalURL, Datetime: capture.CapturedAt})
 	}
+	return mementos, nil
+}
+
+// Mark seed as Pending and record the enqueue time and the attempt number. Call this before enqueuing the seed,
+// so lost requests can be found later.
+func (service *SeedService) MarkEnqueued(shadow string, attempt int) error {
+	return service.Repository.MarkEnqueued(shadow, time.Now(), attempt)
+}
+
+// Find seeds that are Pending for longer than the given duration.
+func (service *SeedService) FindStalePending(olderThan time.Duration, limit int) ([]*entities.Seed, error) {
+	return service.Repository.FindStalePending(time.Now().Add(-olderThan), limit)
+}
+
+// Find successful captures with WACZ that weren't checked for longer than the given duration.
+func (service *SeedService) FindCapturesForFixity(olderThan time.Duration, limit int) ([]*entities.SeedCapture, error) {
+	return service.CaptureRepository.FindCapturesForFixity(time.Now().Add(-olderThan), limit)
+}
+
+// Store result of fixity check of the capture. The seed is marked if the status is a problem.
+func (service *SeedService) UpdateFixity(captureID uint, status entities.FixityStatus) error {
+	return service.CaptureRepository.UpdateFixity(captureID, status, time.Now())
+}
+
+// Find successful captures with WACZ that weren't compared with their previous capture yet, oldest first.
+func (service *SeedService) FindCapturesForChange(limit int) ([]*entities.SeedCapture, error) {
+	return service.CaptureRepository.FindCapturesForChange(limit)
+}
+
+// The latest earlier capture of the same seed with content hash. Nil if there is none.
+func (service *SeedService) GetPreviousCapture(captureID uint) (*entities.SeedCapture, error) {
+	return service.CaptureRepository.GetPreviousCapture(captureID)
+}
 
-	return service.Repository.UpdateMetadata(shadow, archivalURL, archivedAt)
+// Store the content hash of the capture and result of its comparison with the previous capture.
+func (service *SeedService) UpdateChange(captureID uint, contentHash string, status entities.ChangeStatus, previousCaptureID uint) error {
+	return service.CaptureRepository.UpdateChange(captureID, contentHash, status, previousCaptureID)
 }
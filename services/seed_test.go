@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"jinovatka/hostcheck"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Resolver that answers only after the context is done and counts the lookups running at once.
+type blockingResolver struct {
+	running    atomic.Int32
+	maxRunning atomic.Int32
+}
+
+func (resolver *blockingResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	running := resolver.running.Add(1)
+	defer resolver.running.Add(-1)
+	for {
+		maxRunning := resolver.maxRunning.Load()
+		if running <= maxRunning || resolver.maxRunning.CompareAndSwap(maxRunning, running) {
+			break
+		}
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestValidateURLsStopsWithContext(t *testing.T) {
+	services, _ := newTestServices(t)
+	resolver := new(blockingResolver)
+	services.SeedService.UrlParser.HostChecker = hostcheck.NewChecker(resolver, 0)
+
+	inputs := []string{
+		"https://one.example/", "https://two.example/", "ftp://three.example/", "https://four.example/",
+		"https://five.example/", "https://six.example/", "https://seven.example/", "https://eight.example/",
+		"https://nine.example/", "https://ten.example/",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	cleaned, errs := services.SeedService.ValidateURLs(ctx, inputs)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ValidateURLs took %s after the context was done", elapsed)
+	}
+	if maxRunning := resolver.maxRunning.Load(); maxRunning < 2 || maxRunning > validationConcurrency {
+		t.Errorf("%d lookups ran at once, expected more than one and at most %d", maxRunning, validationConcurrency)
+	}
+	for i, input := range inputs {
+		expected := ErrUnresolvableHost
+		if input == "ftp://three.example/" {
+			expected = ErrForbiddenScheme
+		}
+		if !errors.Is(errs[i], expected) || cleaned[i] != "" {
+			t.Errorf("ValidateURLs(%q) = %q, %v, expected %v", input, cleaned[i], errs[i], expected)
+		}
+	}
+}
@@ -1,35 +1,125 @@
 package services
 
 import (
+	"io/fs"
+	"jinovatka/artifact"
 	"jinovatka/assert"
+	"jinovatka/config"
+	"jinovatka/hostcheck"
 	"jinovatka/queue"
 	"jinovatka/storage"
 	"log/slog"
+	"net"
+	"net/http"
 )
 
-// TODO: Make some better way for dealing with settings/constants
-const (
-	// This sets the maximum allowed size of URL adresses.
-	// 64kB. Some quick reaserch seems to show that larger URLs could cause issues during crawls.
-	MaxUrlAdressLength     = 64 << 10
-	MaxInputedUrlAddresses = 20
-)
-
-func NewServices(log *slog.Logger, repository *storage.Repository, queue queue.Queue) *Services {
+// The replayViewer holds the vendored ReplayWeb.page files, nil disables replay.
+func NewServices(log *slog.Logger, config *config.Config, repository *storage.Repository, queue queue.Queue, replayViewer fs.FS) *Services {
 	assert.Must(log != nil, "NewServices: log can't be nil")
+	assert.Must(config != nil, "NewServices: config can't be nil")
 	assert.Must(repository != nil, "NewServices: repository can't be nil")
-	seedService := NewSeedService(log, repository.SeedRepository, MaxUrlAdressLength, MaxInputedUrlAddresses)
+	var hostChecker *hostcheck.Checker
+	if config.Input.RejectNonPublicHosts {
+		hostChecker = hostcheck.NewChecker(net.DefaultResolver, config.Input.HostLookupTimeout.Duration)
+	}
+	urlParser := &UrlParserService{
+		Canonical:           config.Input.CanonicalizeURLs,
+		StripTrackingParams: config.Input.StripTrackingParams,
+		StripFragment:       config.Input.StripFragments,
+		HostChecker:         hostChecker,
+	}
+	policyService := NewPolicyService(log, urlParser, config.Input.PolicyPath)
+	err := policyService.Load()
+	assert.Must(err == nil, "NewServices: failed to load URL policy: "+assert.AddErrorMessage(err))
+	seedService := NewSeedService(
+		log,
+		repository.SeedRepository,
+		repository.CaptureRepository,
+		config.Input.MaxURLLength,
+		config.Input.MaxURLs,
+		config.Archive.WaybackURL,
+		urlParser,
+		policyService,
+	)
 	exporterService := NewExporterService()
-	captureService := NewCaptureService(log, queue, seedService)
+	citationService := NewCitationService()
+	mementoService := NewMementoService(
+		log,
+		&http.Client{Timeout: config.Memento.Timeout.Duration},
+		config.Memento.TimeMapURL,
+		config.Memento.TimeGateURL,
+	)
+	artifactStorage, err := artifact.NewStorage(&config.Artifacts, &http.Client{})
+	assert.Must(err == nil, "NewServices: failed to create artifact storage, the configuration should be validated: "+assert.AddErrorMessage(err))
+	artifactService := NewArtifactService(log, artifactStorage)
+	replayService := NewReplayService(log, seedService, artifactService, config.Replay.OriginURL(), replayViewer)
+	captureService := NewCaptureService(
+		log,
+		queue,
+		seedService,
+		mementoService,
+		artifactService,
+		config.Memento.SkipCaptureFresherThan.Duration,
+		config.Capture.ReuseCaptureFresherThan.Duration,
+	)
+	staleSeedReaper := NewStaleSeedReaper(
+		log,
+		seedService,
+		captureService,
+		config.Capture.StalePendingCheckInterval.Duration,
+		config.Capture.StalePendingDeadline.Duration,
+		config.Capture.MaxCaptureAttempts,
+	)
+	fixityChecker := NewFixityChecker(
+		log,
+		seedService,
+		artifactService,
+		config.Artifacts.FixityCheckInterval.Duration,
+		config.Artifacts.FixityRecheckAfter.Duration,
+		config.Artifacts.FixityBatchSize,
+	)
+	changeService := NewChangeService(
+		log,
+		seedService,
+		artifactService,
+		config.Artifacts.ChangeCheckInterval.Duration,
+		config.Artifacts.ChangeBatchSize,
+	)
+	scheduleService := NewScheduleService(
+		log,
+		repository.ScheduleRepository,
+		seedService,
+		captureService,
+		config.Capture.ScheduleLocation(),
+		config.Capture.ScheduleCheckInterval.Duration,
+	)
 	return &Services{
 		SeedService:     seedService,
 		ExporterService: exporterService,
+		CitationService: citationService,
+		MementoService:  mementoService,
+		ArtifactService: artifactService,
+		ReplayService:   replayService,
 		CaptureService:  captureService,
+		StaleSeedReaper: staleSeedReaper,
+		FixityChecker:   fixityChecker,
+		ChangeService:   changeService,
+		ScheduleService: scheduleService,
+		PolicyService:   policyService,
 	}
 }
 
 type Services struct {
 	SeedService     *SeedService
 	ExporterService *ExporterService
+	CitationService *CitationService
+	MementoService  *MementoService
+	ArtifactService *ArtifactService
+	ReplayService   *ReplayService
 	CaptureService  *CaptureService
+	StaleSeedReaper *StaleSeedReaper
+	FixityChecker   *FixityChecker
+	ChangeService   *ChangeService
+	ScheduleService *ScheduleService
+	PolicyService   *PolicyService
 }
@@ -1,17 +1,33 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"jinovatka/assert"
+	"jinovatka/cdxj"
+	"jinovatka/hostcheck"
 	"net/netip"
 	"net/url"
 	"slices"
 	"strconv"
 	"strings"
+
+	"golang.org/x/net/idna"
 )
 
-type UrlParserService struct{}
+// Zero value only cleans the URLs, see ParseAndCleanURL.
+type UrlParserService struct {
+	// Canonicalise cleaned URLs with CanonicalizeURL.
+	Canonical bool
+	// Remove known tracking parameters (utm_source, fbclid...) from the query during canonicalisation.
+	StripTrackingParams bool
+	// Remove fragment during canonicalisation. Crawlers don't send it anyway.
+	StripFragment bool
+	// Resolves the host and rejects it if it points to non-public address. Nil disables the lookups,
+	// only IP addresses written in the URL are checked then.
+	HostChecker *hostcheck.Checker
+}
 
 // This variables can be used to test what the returned error represents and customize user facing message.
 // This might need a refactor (as it looks ugly).
@@ -23,6 +39,11 @@ var (
 	ErrLoopback        = errors.New("the URL must not be a loopback adress")
 	ErrPrivateIP       = errors.New("the URL host must not be a private IP adress")
 	ErrWellKnownPort   = errors.New("the URL port must not be in well-known range")
+	ErrInvalidHost     = errors.New("the URL host is not valid domain name")
+	// The host resolves to loopback, private, link-local or other non-public address.
+	ErrNonPublicHost = hostcheck.ErrNonPublic
+	// The host could not be resolved, so it could not be checked.
+	ErrUnresolvableHost = hostcheck.ErrUnresolvable
 )
 
 // Parse provided uri. Do some paranoid checks before storing and crawling the URL.
@@ -30,10 +51,12 @@ var (
 // User credentials are removed. Scheme is checked to be http or https
 // or filled in if empty and strict is false.
 // Host is checked to not contain loopback, private IP or well-known port.
+// If Canonical is set, the URL is canonicalised before the host is checked.
+// If HostChecker is set, the host is resolved and all its addresses must be public. The lookup ends when ctx is done.
 //
 // This function does not check the uri lenght.
 // It also does not check if the resource itself is malicious or NSFW.
-func (service *UrlParserService) ParseAndCleanURL(uri string, strict bool) (*url.URL, error) {
+func (service *UrlParserService) ParseAndCleanURL(ctx context.Context, uri string, strict bool) (*url.URL, error) {
 	const (
 		http  = "http"
 		https = "https"
@@ -78,18 +101,28 @@ func (service *UrlParserService) ParseAndCleanURL(uri string, strict bool) (*url
 		return nil, ErrForbiddenScheme
 	}
 
+	if service.Canonical {
+		parsedUri, err = service.CanonicalizeURL(parsedUri)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// IMPORTANT: Never allow loopback and private addresses!
-	host := parsedUri.Hostname()
-	if host == "localhost" {
+	host := strings.TrimSuffix(strings.ToLower(parsedUri.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
 		return nil, ErrLoopback
 	}
 	ip, err := netip.ParseAddr(host)
 	// If error is nil, then host is IP adress.
 	if err == nil && ip.IsValid() {
+		// IPv4-mapped IPv6 adress is the IPv4 adress for the crawler.
+		ip = ip.Unmap()
 		if ip.IsLoopback() {
 			return nil, ErrLoopback
 		}
-		if ip.IsPrivate() {
+		// Also link-local (cloud metadata), CGNAT, multicast...
+		if !hostcheck.IsPublic(ip) {
 			return nil, ErrPrivateIP
 		}
 	}
@@ -106,6 +139,222 @@ func (service *UrlParserService) ParseAndCleanURL(uri string, strict bool) (*url
 		}
 	}
 
+	// Host names can point anywhere, ask DNS.
+	if service.HostChecker != nil {
+		err = service.HostChecker.CheckHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// If we got here then the URL should be OK.
 	return parsedUri, nil
 }
+
+// Query parameters used only to track where the visitor came from. Parameters starting with "utm_" are removed too.
+var TrackingParams = []string{
+	"fbclid", "gclid", "gbraid", "wbraid", "dclid", "msclkid", "yclid", "twclid", "ttclid", "igshid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok", "vero_id", "oly_anon_id", "oly_enc_id",
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Return canonical form of the URL, so different spellings of the same address are equal.
+// Scheme and host are lowercased, internationalised host is converted to punycode and default port is removed.
+// Dot segments of the path are resolved and percent-encoding is normalised (unreserved characters decoded,
+// the rest encoded with uppercase hex digits). Tracking parameters and fragment are removed if the service says so.
+//
+// The URL is not checked, use ParseAndCleanURL for untrusted input.
+func (service *UrlParserService) CanonicalizeURL(parsed *url.URL) (*url.URL, error) {
+	canonical := *parsed
+	canonical.User = nil
+	canonical.Scheme = strings.ToLower(canonical.Scheme)
+
+	host, err := canonicalHost(canonical.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(host, ":") { // IPv6
+		host = "[" + host + "]"
+	}
+	if port := canonical.Port(); port != "" && port != defaultPorts[canonical.Scheme] {
+		host += ":" + port
+	}
+	canonical.Host = host
+
+	if canonical.Opaque == "" {
+		path := removeDotSegments(normalizeEscapes(canonical.EscapedPath(), isPathChar))
+		if path == "" && canonical.Host != "" {
+			path = "/"
+		}
+		canonical.Path, err = url.PathUnescape(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unescape normalised path: %w", err)
+		}
+		canonical.RawPath = path
+	}
+
+	canonical.RawQuery = normalizeEscapes(canonical.RawQuery, isQueryChar)
+	if service.StripTrackingParams {
+		canonical.RawQuery = stripTrackingParams(canonical.RawQuery)
+	}
+	canonical.ForceQuery = false
+
+	if service.StripFragment {
+		canonical.Fragment = ""
+		canonical.RawFragment = ""
+	}
+	return &canonical, nil
+}
+
+// Sort-friendly key of the page the URL points to (see cdxj.SURT), used to find seeds of the same page.
+// The URL is canonicalised first even if Canonical is not set. Missing scheme is filled in like in ParseAndCleanURL.
+// Input that is not URL at all still gets some key, it just won't match anything useful.
+func (service *UrlParserService) SURTKey(uri string) string {
+	uri = strings.TrimSpace(uri)
+	parsed, err := url.Parse(uri)
+	if err == nil && parsed.Scheme == "" {
+		parsed, err = url.Parse("https://" + uri)
+	}
+	if err == nil && parsed.Host != "" {
+		canonical, err := service.CanonicalizeURL(parsed)
+		if err == nil {
+			uri = canonical.String()
+		}
+	}
+	return cdxj.SURT(uri)
+}
+
+// Lowercase the host and convert internationalised domain name to punycode. IP addresses are only normalised.
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip.String(), nil
+	}
+	isASCII := true
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			isASCII = false
+			break
+		}
+	}
+	// ASCII hosts are left alone, the IDNA rules would reject some names that work (underscores...).
+	if isASCII {
+		return host, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidHost, err)
+	}
+	return ascii, nil
+}
+
+// Decode percent-encoded unreserved characters, uppercase the hex digits of the rest
+// and encode characters that are not allowed.
+func normalizeEscapes(escaped string, allowed func(c byte) bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var normalized strings.Builder
+	normalized.Grow(len(escaped))
+	for i := 0; i < len(escaped); i++ {
+		c := escaped[i]
+		if c == '%' && i+2 < len(escaped) && isHex(escaped[i+1]) && isHex(escaped[i+2]) {
+			decoded := unhex(escaped[i+1])<<4 | unhex(escaped[i+2])
+			if isUnreserved(decoded) {
+				normalized.WriteByte(decoded)
+			} else {
+				normalized.WriteByte('%')
+				normalized.WriteByte(hexDigits[decoded>>4])
+				normalized.WriteByte(hexDigits[decoded&15])
+			}
+			i += 2
+			continue
+		}
+		// Lone % is encoded too.
+		if c == '%' || !allowed(c) {
+			normalized.WriteByte('%')
+			normalized.WriteByte(hexDigits[c>>4])
+			normalized.WriteByte(hexDigits[c&15])
+			continue
+		}
+		normalized.WriteByte(c)
+	}
+	return normalized.String()
+}
+
+// Remove "." and ".." segments from absolute path (RFC 3986 section 5.2.4).
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		switch segment {
+		case ".":
+		case "..":
+			// Keep the empty segment before the leading slash.
+			if len(output) > 1 {
+				output = output[:len(output)-1]
+			}
+		default:
+			output = append(output, segment)
+			continue
+		}
+		// Path ending with dot segment points to directory.
+		if i == len(segments)-1 {
+			output = append(output, "")
+		}
+	}
+	return strings.Join(output, "/")
+}
+
+// Remove tracking parameters and empty pairs from the query. Order of the rest is kept.
+func stripTrackingParams(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	kept := make([]string, 0)
+	for pair := range strings.SplitSeq(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "utm_") || slices.Contains(TrackingParams, key) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	return strings.Join(kept, "&")
+}
+
+// Characters allowed in path and query (RFC 3986 section 3.3 and 3.4).
+func isPathChar(c byte) bool {
+	return isUnreserved(c) || strings.IndexByte("!$&'()*+,;=:@/", c) >= 0
+}
+
+func isQueryChar(c byte) bool {
+	return isPathChar(c) || c == '?'
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
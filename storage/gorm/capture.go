@@ -0,0 +1,429 @@
+package gormStorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"log/slog"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Single capture of a seed. Seed has many captures.
+type Capture struct {
+	gorm.Model
+
+	// Foreign key for Seed.
+	SeedID uint `gorm:"index"`
+	Seed   *Seed
+
+	// DoneSuccess or DoneFailure.
+	State string
+
+	// Time the capture was taken. If Null, the worker didn't report it.
+	CapturedAt sql.NullTime `gorm:"index"`
+
+	// URL that was captured as recorded in the index.
+	CapturedURL string
+
+	// URL of the archived resource. Null if the capture failed.
+	ArchivalURL sql.NullString
+
+	// Where the worker stored the WACZ file.
+	WaczLocation string
+
+	// Key, size and SHA-256 of the WACZ in the artifact storage.
+	WaczKey    string
+	WaczSize   int64
+	WaczSHA256 string
+
+	// Result and time of the last fixity check of the WACZ. Empty and Null if it wasn't checked yet.
+	FixityStatus    string       `gorm:"index"`
+	FixityCheckedAt sql.NullTime `gorm:"index"`
+
+	// Hash of the main text, result of comparison with the previous capture and ID of that capture.
+	// Empty and Null if the capture wasn't compared yet.
+	ContentHash       string
+	ChangeStatus      string `gorm:"index"`
+	PreviousCaptureID *uint
+
+	// Errors reported by the worker.
+	ErrorMessages []string `gorm:"serializer:json"`
+
+	// Category of the error. Empty for successful captures.
+	ErrorCategory string
+
+	// Identifier of the worker that made the capture.
+	WorkerID string
+
+	// Identifier of the queue message the capture was recorded from. Empty if unknown.
+	DeliveryID string `gorm:"index"`
+
+	// Capture of another seed this capture was taken over from. Null if the seed was really captured.
+	ReusedCaptureID *uint
+
+	// Metadata of the captured page. Null if the worker didn't report it.
+	PageMetadata *entities.PageMetadata `gorm:"serializer:json"`
+}
+
+// Create new capture record of the seed with the given ID.
+func NewCaptureRecord(seedID uint, capture *entities.SeedCapture) *Capture {
+	assert.Must(capture != nil, "NewCaptureRecord: capture can't be nil")
+	assert.Must(capture.State == entities.DoneSuccess || capture.State == entities.DoneFailure, "NewCaptureRecord: capture.State must be DoneSuccess or DoneFailure")
+	record := &Capture{
+		SeedID:        seedID,
+		State:         string(capture.State),
+		CapturedURL:   capture.CapturedURL,
+		WaczLocation:  capture.WaczLocation,
+		WaczKey:       capture.WaczKey,
+		WaczSize:      capture.WaczSize,
+		WaczSHA256:    capture.WaczSHA256,
+		ErrorMessages: capture.ErrorMessages,
+		ErrorCategory: string(capture.ErrorCategory),
+		WorkerID:      capture.WorkerID,
+		DeliveryID:    capture.DeliveryID,
+		PageMetadata:  capture.PageMetadata,
+	}
+	if capture.ReusedCaptureID != 0 {
+		reusedID := capture.ReusedCaptureID
+		record.ReusedCaptureID = &reusedID
+	}
+	if !capture.CapturedAt.IsZero() {
+		record.CapturedAt = sql.NullTime{Valid: true, Time: capture.CapturedAt}
+	}
+	if capture.ArchivalURL != "" {
+		record.ArchivalURL = sql.NullString{Valid: true, String: capture.ArchivalURL}
+	}
+	return record
+}
+
+// Seed must be preloaded.
+func (capture *Capture) ToEntity() *entities.SeedCapture {
+	entity := &entities.SeedCapture{
+		ID:            capture.ID,
+		State:         entities.CaptureState(capture.State),
+		CapturedURL:   capture.CapturedURL,
+		WaczLocation:  capture.WaczLocation,
+		WaczKey:       capture.WaczKey,
+		WaczSize:      capture.WaczSize,
+		WaczSHA256:    capture.WaczSHA256,
+		FixityStatus:  entities.FixityStatus(capture.FixityStatus),
+		ContentHash:   capture.ContentHash,
+		ChangeStatus:  entities.ChangeStatus(capture.ChangeStatus),
+		ErrorMessages: capture.ErrorMessages,
+		ErrorCategory: entities.CaptureErrorCategory(capture.ErrorCategory),
+		WorkerID:      capture.WorkerID,
+		DeliveryID:    capture.DeliveryID,
+		PageMetadata:  capture.PageMetadata,
+		CreatedAt:     capture.CreatedAt,
+	}
+	if capture.FixityCheckedAt.Valid {
+		entity.FixityCheckedAt = capture.FixityCheckedAt.Time
+	}
+	if capture.PreviousCaptureID != nil {
+		entity.PreviousCaptureID = *capture.PreviousCaptureID
+	}
+	if capture.ReusedCaptureID != nil {
+		entity.ReusedCaptureID = *capture.ReusedCaptureID
+	}
+	if capture.Seed != nil {
+		entity.SeedShadowID = capture.Seed.ShadowID
+	}
+	if capture.CapturedAt.Valid {
+		entity.CapturedAt = capture.CapturedAt.Time
+	}
+	if capture.ArchivalURL.Valid {
+		entity.ArchivalURL = capture.ArchivalURL.String
+	}
+	return entity
+}
+
+func NewCaptureRepository(log *slog.Logger, db *gorm.DB) *CaptureRepository {
+	assert.Must(log != nil, "NewCaptureRepository: log can't be nil")
+	assert.Must(db != nil, "NewCaptureRepository: db can't be nil")
+	err := db.AutoMigrate(Capture{})
+	assert.Must(err == nil, "NewCaptureRepository: db.AutoMigrate failed for Capture with error: "+assert.AddErrorMessage(err))
+	return &CaptureRepository{
+		Log: log,
+		DB:  db,
+	}
+}
+
+type CaptureRepository struct {
+	Log *slog.Logger
+	DB  *gorm.DB
+}
+
+func (repository *CaptureRepository) SaveCapture(capture *entities.SeedCapture) error {
+	if capture == nil {
+		return errors.New("CaptureRepository.SaveCapture recieved nil capture")
+	}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		seed := new(Seed)
+		err := tx.First(seed, "shadow_id = ?", capture.SeedShadowID).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch Seed: %w", err)
+		}
+		record := NewCaptureRecord(seed.ID, capture)
+
+		// The same result may be delivered more than once. Results are identified by their queue message,
+		// successful captures also by their time and URL.
+		duplicates := tx.Model(&Capture{}).Where("seed_id = ?", seed.ID)
+		switch {
+		case record.DeliveryID != "":
+			duplicates = duplicates.Where("delivery_id = ?", record.DeliveryID)
+		case record.CapturedAt.Valid:
+			duplicates = duplicates.Where("captured_at = ? AND captured_url = ?", record.CapturedAt, record.CapturedURL)
+		default:
+			duplicates = nil
+		}
+		if duplicates != nil {
+			var count int64
+			err = duplicates.Count(&count).Error
+			if err != nil {
+				return fmt.Errorf("failed to look for duplicate capture: %w", err)
+			}
+			if count > 0 {
+				return nil
+			}
+		}
+
+		// Results may arrive out of order. Captures are ordered by the time they were taken,
+		// failures don't report it and count as taken when they are recorded.
+		takenAt := time.Now()
+		if record.CapturedAt.Valid {
+			takenAt = record.CapturedAt.Time
+		}
+		latest := new(Capture)
+		err = tx.Where("seed_id = ?", seed.ID).Order("COALESCE(captured_at, created_at) DESC").Limit(1).Find(latest).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch latest capture: %w", err)
+		}
+		latestTakenAt := latest.CreatedAt
+		if latest.CapturedAt.Valid {
+			latestTakenAt = latest.CapturedAt.Time
+		}
+
+		err = tx.Create(record).Error
+		if err != nil {
+			return fmt.Errorf("failed to create Capture: %w", err)
+		}
+
+		// State and errors of the seed are taken from its latest capture. The seed points to its latest successful capture.
+		columns := []string{}
+		update := Seed{}
+		if latest.ID == 0 || !takenAt.Before(latestTakenAt) {
+			update.State, update.ErrorMessages, update.ErrorCategory = record.State, record.ErrorMessages, record.ErrorCategory
+			columns = append(columns, "State", "ErrorMessages", "ErrorCategory")
+		}
+		isSuccess := record.State == string(entities.DoneSuccess) && record.ArchivalURL.Valid && record.CapturedAt.Valid
+		isNewer := !seed.HarvestedAt.Valid || record.CapturedAt.Time.After(seed.HarvestedAt.Time)
+		if isSuccess && isNewer {
+			update.ArchivalURL = record.ArchivalURL
+			update.HarvestedAt = record.CapturedAt
+			update.PageMetadata = record.PageMetadata
+			columns = append(columns, "ArchivalURL", "HarvestedAt", "PageMetadata")
+		}
+		if len(columns) == 0 {
+			return nil
+		}
+		err = tx.Model(seed).Select(columns).Updates(update).Error
+		if err != nil {
+			return fmt.Errorf("failed to update Seed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("CaptureRepository.SaveCapture failed for seed with shadow %s : %w", capture.SeedShadowID, err)
+	}
+	return nil
+}
+
+func (repository *CaptureRepository) GetCaptures(seedShadow string) ([]*entities.SeedCapture, error) {
+	records := make([]*Capture, 0)
+	err := repository.DB.
+		Joins("Seed").
+		Where("Seed.shadow_id = ?", seedShadow).
+		Order("captures.created_at DESC").
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("CaptureRepository.GetCaptures failed to fetch captures: %w", err)
+	}
+	captures := make([]*entities.SeedCapture, 0, len(records))
+	for _, record := range records {
+		captures = append(captures, record.ToEntity())
+	}
+	return captures, nil
+}
+
+func (repository *CaptureRepository) FindSuccessfulCaptures(url string) ([]*entities.SeedCapture, error) {
+	records := make([]*Capture, 0)
+	err := repository.DB.
+		Joins("Seed").
+		Where("captures.state = ? AND captures.archival_url IS NOT NULL AND captures.captured_at IS NOT NULL", entities.DoneSuccess).
+		Where("Seed.public = ?", true).
+		Where(repository.DB.Where("Seed.url = ?", url).Or("captures.captured_url = ?", url)).
+		Order("captures.captured_at ASC").
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("CaptureRepository.FindSuccessfulCaptures failed to fetch captures: %w", err)
+	}
+	captures := make([]*entities.SeedCapture, 0, len(records))
+	for _, record := range records {
+		captures = append(captures, record.ToEntity())
+	}
+	return captures, nil
+}
+
+func (repository *CaptureRepository) FindReusableCapture(url string, excludedSeedShadow string, capturedAfter time.Time) (*entities.SeedCapture, error) {
+	records := make([]*Capture, 0, 1)
+	sameURL := repository.DB.Where("Seed.url = ?", url).Or("captures.captured_url = ?", url)
+	err := repository.DB.
+		Joins("Seed").
+		Where("captures.state = ? AND captures.archival_url IS NOT NULL AND captures.captured_at >= ?", entities.DoneSuccess, capturedAfter).
+		Where("Seed.shadow_id <> ? AND captures.reused_capture_id IS NULL", excludedSeedShadow).
+		// Captures of private seeds must not leak to other users.
+		Where("Seed.public = ?", true).
+		Where(sameURL).
+		Order("captures.captured_at DESC").
+		Limit(1).
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("CaptureRepository.FindReusableCapture failed to fetch captures: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0].ToEntity(), nil
+}
+
+func (repository *CaptureRepository) FindCapturesForFixity(checkedBefore time.Time, limit int) ([]*entities.SeedCapture, error) {
+	records := make([]*Capture, 0)
+	db := repository.DB.
+		Joins("Seed").
+		Where("captures.state = ? AND captures.wacz_key <> ''", entities.DoneSuccess).
+		Where("captures.fixity_checked_at IS NULL OR captures.fixity_checked_at < ?", checkedBefore).
+		Order("captures.fixity_checked_at IS NOT NULL").
+		Order("captures.fixity_checked_at").
+		Order("captures.id")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("CaptureRepository.FindCapturesForFixity failed to fetch captures: %w", err)
+	}
+	captures := make([]*entities.SeedCapture, 0, len(records))
+	for _, record := range records {
+		captures = append(captures, record.ToEntity())
+	}
+	return captures, nil
+}
+
+func (repository *CaptureRepository) UpdateFixity(captureID uint, status entities.FixityStatus, checkedAt time.Time) error {
+	if !status.IsFixityStatus() {
+		return errors.New("CaptureRepository.UpdateFixity recieved invalid status")
+	}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		record := new(Capture)
+		err := tx.First(record, captureID).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch Capture: %w", err)
+		}
+		update := Capture{FixityStatus: string(status), FixityCheckedAt: sql.NullTime{Valid: !checkedAt.IsZero(), Time: checkedAt}}
+		err = tx.Model(record).Select("FixityStatus", "FixityCheckedAt").Updates(update).Error
+		if err != nil {
+			return fmt.Errorf("failed to update Capture: %w", err)
+		}
+
+		// The seed shows the worst status of its captures, so one broken WACZ is not hidden by the others.
+		statuses := make([]string, 0)
+		err = tx.Model(&Capture{}).Where("seed_id = ?", record.SeedID).Distinct().Pluck("fixity_status", &statuses).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch fixity of captures: %w", err)
+		}
+		worst := entities.FixityUnchecked
+		for _, candidate := range []entities.FixityStatus{entities.FixityCorrupted, entities.FixityMissing, entities.FixityOK} {
+			if slices.Contains(statuses, string(candidate)) {
+				worst = candidate
+				break
+			}
+		}
+		err = tx.Model(&Seed{}).Where("id = ?", record.SeedID).Update("fixity_status", string(worst)).Error
+		if err != nil {
+			return fmt.Errorf("failed to update Seed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("CaptureRepository.UpdateFixity failed for capture %d: %w", captureID, err)
+	}
+	return nil
+}
+
+func (repository *CaptureRepository) FindCapturesForChange(limit int) ([]*entities.SeedCapture, error) {
+	records := make([]*Capture, 0)
+	db := repository.DB.
+		Joins("Seed").
+		Where("captures.state = ? AND captures.wacz_key <> '' AND captures.captured_at IS NOT NULL", entities.DoneSuccess).
+		Where("captures.change_status = ?", entities.ChangeUnchecked).
+		Order("captures.captured_at").
+		Order("captures.id")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("CaptureRepository.FindCapturesForChange failed to fetch captures: %w", err)
+	}
+	captures := make([]*entities.SeedCapture, 0, len(records))
+	for _, record := range records {
+		captures = append(captures, record.ToEntity())
+	}
+	return captures, nil
+}
+
+func (repository *CaptureRepository) GetPreviousCapture(captureID uint) (*entities.SeedCapture, error) {
+	capture := new(Capture)
+	err := repository.DB.First(capture, captureID).Error
+	if err != nil {
+		return nil, fmt.Errorf("CaptureRepository.GetPreviousCapture failed to fetch Capture %d: %w", captureID, err)
+	}
+	records := make([]*Capture, 0, 1)
+	err = repository.DB.
+		Joins("Seed").
+		Where("captures.seed_id = ? AND captures.id <> ?", capture.SeedID, capture.ID).
+		Where("captures.content_hash <> '' AND captures.captured_at < ?", capture.CapturedAt).
+		Order("captures.captured_at DESC").
+		Limit(1).
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("CaptureRepository.GetPreviousCapture failed to fetch previous capture of %d: %w", captureID, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0].ToEntity(), nil
+}
+
+func (repository *CaptureRepository) UpdateChange(captureID uint, contentHash string, status entities.ChangeStatus, previousCaptureID uint) error {
+	if !status.IsChangeStatus() {
+		return errors.New("CaptureRepository.UpdateChange recieved invalid status")
+	}
+	update := Capture{ContentHash: contentHash, ChangeStatus: string(status)}
+	if previousCaptureID != 0 {
+		update.PreviousCaptureID = &previousCaptureID
+	}
+	err := repository.DB.Model(&Capture{}).
+		Where("id = ?", captureID).
+		Select("ContentHash", "ChangeStatus", "PreviousCaptureID").
+		Updates(update).Error
+	if err != nil {
+		return fmt.Errorf("CaptureRepository.UpdateChange failed for capture %d: %w", captureID, err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package gormStorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"jinovatka/assert"
+	"jinovatka/entities"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schedule of captures of a group or a single seed.
+type Schedule struct {
+	gorm.Model
+
+	// Foreign key for SeedsGroup. Null if the schedule belongs to seed.
+	SeedsGroupID *uint `gorm:"index"`
+	SeedsGroup   *SeedsGroup
+
+	// Foreign key for Seed. Null if the schedule belongs to group.
+	SeedID *uint `gorm:"index"`
+	Seed   *Seed
+
+	Kind  string
+	Start time.Time
+	Cron  string
+
+	// Null if no run is left.
+	NextRunAt sql.NullTime `gorm:"index"`
+	// Null if the schedule didn't run yet.
+	LastRunAt sql.NullTime
+}
+
+// SeedsGroup or Seed must be preloaded.
+func (schedule *Schedule) ToEntity() *entities.Schedule {
+	entity := &entities.Schedule{
+		ID:    schedule.ID,
+		Kind:  entities.ScheduleKind(schedule.Kind),
+		Start: schedule.Start,
+		Cron:  schedule.Cron,
+	}
+	if schedule.SeedsGroup != nil {
+		entity.GroupShadowID = schedule.SeedsGroup.ShadowID
+	}
+	if schedule.Seed != nil {
+		entity.SeedShadowID = schedule.Seed.ShadowID
+	}
+	if schedule.NextRunAt.Valid {
+		entity.NextRunAt = schedule.NextRunAt.Time
+	}
+	if schedule.LastRunAt.Valid {
+		entity.LastRunAt = schedule.LastRunAt.Time
+	}
+	return entity
+}
+
+// Single run of schedule for one seed.
+type ScheduleRun struct {
+	gorm.Model
+
+	// Foreign key for Seed.
+	SeedID uint `gorm:"index"`
+	Seed   *Seed
+
+	// Schedule that made the run. It may be deleted already.
+	ScheduleID uint
+
+	ScheduledAt time.Time
+	RanAt       time.Time
+	Skipped     bool
+	Error       string
+}
+
+func NewScheduleRepository(log *slog.Logger, db *gorm.DB) *ScheduleRepository {
+	assert.Must(log != nil, "NewScheduleRepository: log can't be nil")
+	assert.Must(db != nil, "NewScheduleRepository: db can't be nil")
+	var err error
+	err = db.AutoMigrate(Schedule{})
+	assert.Must(err == nil, "NewScheduleRepository: db.AutoMigrate failed for Schedule with error: "+assert.AddErrorMessage(err))
+	err = db.AutoMigrate(ScheduleRun{})
+	assert.Must(err == nil, "NewScheduleRepository: db.AutoMigrate failed for ScheduleRun with error: "+assert.AddErrorMessage(err))
+	return &ScheduleRepository{
+		Log: log,
+		DB:  db,
+	}
+}
+
+type ScheduleRepository struct {
+	Log *slog.Logger
+	DB  *gorm.DB
+}
+
+func (repository *ScheduleRepository) SaveSchedule(schedule *entities.Schedule) error {
+	if schedule == nil {
+		return errors.New("ScheduleRepository.SaveSchedule recieved nil schedule")
+	}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		record := &Schedule{
+			Kind:  string(schedule.Kind),
+			Start: schedule.Start,
+			Cron:  schedule.Cron,
+		}
+		if !schedule.NextRunAt.IsZero() {
+			record.NextRunAt = sql.NullTime{Valid: true, Time: schedule.NextRunAt}
+		}
+		if !schedule.LastRunAt.IsZero() {
+			record.LastRunAt = sql.NullTime{Valid: true, Time: schedule.LastRunAt}
+		}
+		owner, err := scheduleOwner(tx, schedule.GroupShadowID, schedule.SeedShadowID)
+		if err != nil {
+			return err
+		}
+		err = owner.Delete(&Schedule{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete previous Schedule: %w", err)
+		}
+		record.SeedsGroupID, record.SeedID, err = scheduleOwnerIDs(tx, schedule.GroupShadowID, schedule.SeedShadowID)
+		if err != nil {
+			return err
+		}
+		err = tx.Create(record).Error
+		if err != nil {
+			return fmt.Errorf("failed to create Schedule: %w", err)
+		}
+		schedule.ID = record.ID
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ScheduleRepository.SaveSchedule failed: %w", err)
+	}
+	return nil
+}
+
+func (repository *ScheduleRepository) GetSchedule(groupShadow string, seedShadow string) (*entities.Schedule, error) {
+	owner, err := scheduleOwner(repository.DB, groupShadow, seedShadow)
+	if err != nil {
+		return nil, fmt.Errorf("ScheduleRepository.GetSchedule failed: %w", err)
+	}
+	records := make([]*Schedule, 0, 1)
+	err = owner.Preload("SeedsGroup").Preload("Seed").Limit(1).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("ScheduleRepository.GetSchedule failed to fetch Schedule: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0].ToEntity(), nil
+}
+
+func (repository *ScheduleRepository) DeleteSchedule(groupShadow string, seedShadow string) error {
+	owner, err := scheduleOwner(repository.DB, groupShadow, seedShadow)
+	if err != nil {
+		return fmt.Errorf("ScheduleRepository.DeleteSchedule failed: %w", err)
+	}
+	err = owner.Delete(&Schedule{}).Error
+	if err != nil {
+		return fmt.Errorf("ScheduleRepository.DeleteSchedule failed to delete Schedule: %w", err)
+	}
+	return nil
+}
+
+func (repository *ScheduleRepository) FindDueSchedules(now time.Time, limit int) ([]*entities.Schedule, error) {
+	records := make([]*Schedule, 0)
+	db := repository.DB.
+		Preload("SeedsGroup").
+		Preload("Seed").
+		Where("next_run_at <= ?", now).
+		Order("next_run_at").
+		Order("id")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("ScheduleRepository.FindDueSchedules failed to fetch schedules: %w", err)
+	}
+	schedules := make([]*entities.Schedule, 0, len(records))
+	for _, record := range records {
+		schedules = append(schedules, record.ToEntity())
+	}
+	return schedules, nil
+}
+
+func (repository *ScheduleRepository) RecordRuns(schedule *entities.Schedule, runs []*entities.ScheduleRun) error {
+	if schedule == nil {
+		return errors.New("ScheduleRepository.RecordRuns recieved nil schedule")
+	}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		for _, run := range runs {
+			seed := new(Seed)
+			err := tx.First(seed, "shadow_id = ?", run.SeedShadowID).Error
+			if err != nil {
+				return fmt.Errorf("failed to fetch Seed: %w", err)
+			}
+			record := &ScheduleRun{
+				SeedID:      seed.ID,
+				ScheduleID:  schedule.ID,
+				ScheduledAt: run.ScheduledAt,
+				RanAt:       run.RanAt,
+				Skipped:     run.Skipped,
+				Error:       run.Error,
+			}
+			err = tx.Create(record).Error
+			if err != nil {
+				return fmt.Errorf("failed to create ScheduleRun: %w", err)
+			}
+		}
+		update := map[string]any{
+			"next_run_at": sql.NullTime{Valid: !schedule.NextRunAt.IsZero(), Time: schedule.NextRunAt},
+			"last_run_at": sql.NullTime{Valid: !schedule.LastRunAt.IsZero(), Time: schedule.LastRunAt},
+		}
+		// The schedule may have been replaced or cancelled in the meantime, that is fine.
+		err := tx.Model(&Schedule{}).Where("id = ?", schedule.ID).Updates(update).Error
+		if err != nil {
+			return fmt.Errorf("failed to update Schedule: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ScheduleRepository.RecordRuns failed for schedule %d: %w", schedule.ID, err)
+	}
+	return nil
+}
+
+func (repository *ScheduleRepository) GetScheduleRuns(seedShadow string, limit int) ([]*entities.ScheduleRun, error) {
+	records := make([]*ScheduleRun, 0)
+	db := repository.DB.
+		Joins("Seed").
+		Where("Seed.shadow_id = ?", seedShadow).
+		Order("schedule_runs.ran_at DESC").
+		Order("schedule_runs.id DESC")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("ScheduleRepository.GetScheduleRuns failed to fetch runs: %w", err)
+	}
+	runs := make([]*entities.ScheduleRun, 0, len(records))
+	for _, record := range records {
+		runs = append(runs, &entities.ScheduleRun{
+			SeedShadowID: seedShadow,
+			ScheduledAt:  record.ScheduledAt,
+			RanAt:        record.RanAt,
+			Skipped:      record.Skipped,
+			Error:        record.Error,
+		})
+	}
+	return runs, nil
+}
+
+// Query of schedules of the group or the seed. Exactly one of the ShadowIDs must be set.
+func scheduleOwner(db *gorm.DB, groupShadow string, seedShadow string) (*gorm.DB, error) {
+	switch {
+	case groupShadow != "" && seedShadow == "":
+		groupID := db.Model(&SeedsGroup{}).Select("id").Where("shadow_id = ?", groupShadow)
+		return db.Where("seeds_group_id = (?)", groupID), nil
+	case seedShadow != "" && groupShadow == "":
+		seedID := db.Model(&Seed{}).Select("id").Where("shadow_id = ?", seedShadow)
+		return db.Where("seed_id = (?)", seedID), nil
+	}
+	return nil, errors.New("schedule must belong to either group or seed")
+}
+
+// Foreign keys of the owner of the schedule, see scheduleOwner.
+func scheduleOwnerIDs(db *gorm.DB, groupShadow string, seedShadow string) (*uint, *uint, error) {
+	if groupShadow != "" {
+		group := new(SeedsGroup)
+		err := db.First(group, "shadow_id = ?", groupShadow).Error
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch SeedsGroup: %w", err)
+		}
+		return &group.ID, nil, nil
+	}
+	seed := new(Seed)
+	err := db.First(seed, "shadow_id = ?", seedShadow).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch Seed: %w", err)
+	}
+	return nil, &seed.ID, nil
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"jinovatka/assert"
 	"jinovatka/entities"
+	"jinovatka/storage"
 	"log/slog"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,6 +20,9 @@ type Seed struct {
 	// The original seed URL
 	URL string `gorm:"index"`
 
+	// Sort-friendly key of the canonical URL. Empty for old seeds.
+	SURT string `gorm:"index"`
+
 	// If the seed is public, hten it may be visible on the main page and can be searched for.
 	Public bool
 
@@ -31,6 +36,25 @@ type Seed struct {
 	// If Null, the seed wasn't harvested yet (it may be waiting in a queue, or error happend during harvest)
 	HarvestedAt sql.NullTime
 
+	// Time the seed was last enqueued for capture.
+	// If Null, the seed was never enqueued or it was enqueued before this column existed.
+	EnqueuedAt sql.NullTime
+
+	// Number of times the seed was enqueued for capture.
+	CaptureAttempts int
+
+	// Errors of the last capture. Empty if the last capture succeeded.
+	ErrorMessages []string `gorm:"serializer:json"`
+
+	// Category of the last capture error. Empty if the last capture succeeded.
+	ErrorCategory string
+
+	// Metadata of the page from the capture ArchivalURL points to. Null if unknown.
+	PageMetadata *entities.PageMetadata `gorm:"serializer:json"`
+
+	// The worst fixity status of the captures. Empty if none was checked yet.
+	FixityStatus string `gorm:"index"`
+
 	// Unique randomly generated base32 encoded string with at least 128 bits of randomness.
 	// Exact size is unspecified. This allowes the use of rand.Text to generate it.
 	//
@@ -56,6 +80,7 @@ func NewSeedRecord(seed *entities.Seed) *Seed {
 	// Ignore ID, Create, Update adn Delete time. We are creating new record. GORM will fill it in.
 	seedRecord := &Seed{
 		URL:      seed.URL,
+		SURT:     seed.SURT,
 		Public:   seed.Public,
 		State:    string(seed.State),
 		ShadowID: seed.ShadowID,
@@ -77,10 +102,19 @@ func NewSeedRecord(seed *entities.Seed) *Seed {
 
 func (seed *Seed) ToEntity() *entities.Seed {
 	entity := &entities.Seed{
-		URL:      seed.URL,
-		Public:   seed.Public,
-		State:    entities.CaptureState(seed.State),
-		ShadowID: seed.ShadowID,
+		URL:             seed.URL,
+		SURT:            seed.SURT,
+		Public:          seed.Public,
+		State:           entities.CaptureState(seed.State),
+		ShadowID:        seed.ShadowID,
+		CaptureAttempts: seed.CaptureAttempts,
+		ErrorMessages:   seed.ErrorMessages,
+		ErrorCategory:   entities.CaptureErrorCategory(seed.ErrorCategory),
+		PageMetadata:    seed.PageMetadata,
+		FixityStatus:    entities.FixityStatus(seed.FixityStatus),
+	}
+	if seed.EnqueuedAt.Valid {
+		entity.EnqueuedAt = seed.EnqueuedAt.Time
 	}
 	if seed.ArchivalURL.Valid {
 		entity.ArchivalURL = seed.ArchivalURL.String
@@ -213,14 +247,97 @@ func (repository *SeedRepository) UpdateState(shadow string, state entities.Capt
 	return nil
 }
 
-func (repository *SeedRepository) UpdateMetadata(shadow string, archivalURL string, harvestedAt time.Time) error {
-	seed := Seed{
-		ArchivalURL: sql.NullString{Valid: true, String: archivalURL},
-		HarvestedAt: sql.NullTime{Valid: true, Time: harvestedAt},
+func (repository *SeedRepository) MarkEnqueued(shadow string, enqueuedAt time.Time, attempt int) error {
+	updates := map[string]any{
+		"state":            string(entities.Pending),
+		"enqueued_at":      sql.NullTime{Valid: true, Time: enqueuedAt},
+		"capture_attempts": attempt,
 	}
-	err := repository.DB.Model(Seed{}).Where("shadow_id = ?", shadow).Select("ArchivalURL", "HarvestedAt").Updates(seed).Error
+	err := repository.DB.Model(Seed{}).Where("shadow_id = ?", shadow).Updates(updates).Error
 	if err != nil {
-		return fmt.Errorf("SeedRepository.UpdateMetadata failed to update Seed with shadow %s : %w", shadow, err)
+		return fmt.Errorf("SeedRepository.MarkEnqueued failed to update Seed with shadow %s : %w", shadow, err)
 	}
 	return nil
 }
+
+func (repository *SeedRepository) FindStalePending(before time.Time, limit int) ([]*entities.Seed, error) {
+	seedRecords := make([]*Seed, 0)
+	db := repository.DB.
+		Where("state = ?", string(entities.Pending)).
+		// Seeds enqueued before the enqueued_at column existed only have updated_at.
+		Where("enqueued_at < ? OR (enqueued_at IS NULL AND updated_at < ?)", before, before).
+		Order("id")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	err := db.Find(&seedRecords).Error
+	if err != nil {
+		return nil, fmt.Errorf("SeedRepository.FindStalePending failed to fetch seeds: %w", err)
+	}
+	seeds := make([]*entities.Seed, 0, len(seedRecords))
+	for _, seedRecord := range seedRecords {
+		seeds = append(seeds, seedRecord.ToEntity())
+	}
+	return seeds, nil
+}
+
+func (repository *SeedRepository) FindSeeds(query *storage.SeedQuery) ([]*entities.Seed, int, error) {
+	if query == nil {
+		return nil, 0, errors.New("SeedRepository.FindSeeds recieved nil query")
+	}
+	db := repository.DB.Model(&Seed{})
+	if query.URL != "" {
+		// Escape LIKE wildcards, so the user input is matched literally.
+		pattern := likeEscaper.Replace(query.URL) + "%"
+		if !query.URLPrefix {
+			pattern = "%" + pattern
+		}
+		db = db.Where(`url LIKE ? ESCAPE '\'`, pattern)
+	}
+	if query.SURT != "" {
+		db = db.Where("surt = ?", query.SURT)
+	}
+	if !query.HarvestedFrom.IsZero() {
+		db = db.Where("harvested_at >= ?", query.HarvestedFrom)
+	}
+	if !query.HarvestedTo.IsZero() {
+		db = db.Where("harvested_at < ?", query.HarvestedTo)
+	}
+	if query.State != "" {
+		db = db.Where("state = ?", string(query.State))
+	}
+	if query.Public != nil {
+		db = db.Where("public = ?", *query.Public)
+	}
+	if query.GroupShadowID != "" {
+		groupID := repository.DB.Model(&SeedsGroup{}).Select("id").Where("shadow_id = ?", query.GroupShadowID)
+		db = db.Where("seeds_group_id = (?)", groupID)
+	}
+	if query.FixityProblem {
+		db = db.Where("fixity_status IN ?", []string{string(entities.FixityMissing), string(entities.FixityCorrupted)})
+	}
+
+	var count int64
+	err := db.Count(&count).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("SeedRepository.FindSeeds failed to count seeds: %w", err)
+	}
+
+	seedRecords := make([]*Seed, 0)
+	db = db.Order("created_at DESC").Order("id DESC").Offset(query.Offset)
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	err = db.Find(&seedRecords).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("SeedRepository.FindSeeds failed to fetch seeds: %w", err)
+	}
+
+	seeds := make([]*entities.Seed, 0, len(seedRecords))
+	for _, seedRecord := range seedRecords {
+		seeds = append(seeds, seedRecord.ToEntity())
+	}
+	return seeds, int(count), nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
@@ -6,15 +6,21 @@ import (
 	"time"
 )
 
-func NewRepository(seed SeedRepository) *Repository {
+func NewRepository(seed SeedRepository, capture CaptureRepository, schedule ScheduleRepository) *Repository {
 	assert.Must(seed != nil, "NewRepository: seed repository can't be nil")
+	assert.Must(capture != nil, "NewRepository: capture repository can't be nil")
+	assert.Must(schedule != nil, "NewRepository: schedule repository can't be nil")
 	return &Repository{
-		SeedRepository: seed,
+		SeedRepository:     seed,
+		CaptureRepository:  capture,
+		ScheduleRepository: schedule,
 	}
 }
 
 type Repository struct {
-	SeedRepository SeedRepository
+	SeedRepository     SeedRepository
+	CaptureRepository  CaptureRepository
+	ScheduleRepository ScheduleRepository
 }
 
 type SeedRepository interface {
@@ -23,5 +29,83 @@ type SeedRepository interface {
 	GetGroup(shadow string) (*entities.SeedsGroup, error)
 	GetSeed(shadow string) (*entities.Seed, error)
 	UpdateState(shadow string, state entities.CaptureState) error
-	UpdateMetadata(shadow, archivalURL string, harvestedAt time.Time) error
+	// Set state of the seed to Pending, record the time it was enqueued and the number of the capture attempt.
+	MarkEnqueued(shadow string, enqueuedAt time.Time, attempt int) error
+	// Find seeds that are Pending since before the given time.
+	FindStalePending(before time.Time, limit int) ([]*entities.Seed, error)
+	// Find seeds matching the query. Returns one page of seeds and total number of matching seeds.
+	FindSeeds(query *SeedQuery) ([]*entities.Seed, int, error)
+}
+
+type CaptureRepository interface {
+	// Store the capture. If the capture is successful and newer than the latest successful capture of the seed,
+	// the seed ArchivalURL and HarvestedAt are updated to match it. State and errors of the seed are updated
+	// only if the capture is not older than the latest capture of the seed (failures count as taken when they are saved).
+	// Saving the same capture twice (the same DeliveryID, or the same time and URL of successful capture) stores it only once.
+	SaveCapture(*entities.SeedCapture) error
+	// All captures of the seed, newest first.
+	GetCaptures(seedShadow string) ([]*entities.SeedCapture, error)
+	// Successful captures of public seeds with the given URL (seed URL or captured URL), oldest first.
+	FindSuccessfulCaptures(url string) ([]*entities.SeedCapture, error)
+	// The latest successful capture of other public seed than excludedSeedShadow with exactly the given URL (seed URL or captured URL)
+	// taken at or after capturedAfter. SURT keys are not used, different pages can share them. Captures reused from other seeds
+	// are skipped, so the seed never gets back its own capture. Returns nil capture and nil error if there is none.
+	FindReusableCapture(url string, excludedSeedShadow string, capturedAfter time.Time) (*entities.SeedCapture, error)
+	// Successful captures with WACZ in the artifact storage that weren't checked since checkedBefore.
+	// Never checked captures go first, then the ones checked longest ago.
+	FindCapturesForFixity(checkedBefore time.Time, limit int) ([]*entities.SeedCapture, error)
+	// Store result of fixity check of the capture and update the fixity status of its seed.
+	UpdateFixity(captureID uint, status entities.FixityStatus, checkedAt time.Time) error
+	// Successful captures with WACZ in the artifact storage that weren't compared with the previous capture yet, oldest first.
+	FindCapturesForChange(limit int) ([]*entities.SeedCapture, error)
+	// The latest capture of the same seed taken before the given capture that has content hash.
+	// Returns nil capture and nil error if there is none.
+	GetPreviousCapture(captureID uint) (*entities.SeedCapture, error)
+	// Store the content hash and result of comparison of the capture.
+	UpdateChange(captureID uint, contentHash string, status entities.ChangeStatus, previousCaptureID uint) error
+}
+
+type ScheduleRepository interface {
+	// Store the schedule of its group or seed. The previous schedule of the same group or seed is replaced.
+	SaveSchedule(*entities.Schedule) error
+	// Schedule of the group (groupShadow) or the seed (seedShadow), the other one must be empty.
+	// Returns nil schedule and nil error if there is no schedule.
+	GetSchedule(groupShadow string, seedShadow string) (*entities.Schedule, error)
+	// Remove the schedule of the group or the seed, see GetSchedule. Removing missing schedule is not an error.
+	DeleteSchedule(groupShadow string, seedShadow string) error
+	// Schedules with next run at or before the given time, the most overdue first.
+	FindDueSchedules(now time.Time, limit int) ([]*entities.Schedule, error)
+	// Store the runs and the new NextRunAt and LastRunAt of the schedule together.
+	RecordRuns(schedule *entities.Schedule, runs []*entities.ScheduleRun) error
+	// Runs of schedules that enqueued the seed, newest first.
+	GetScheduleRuns(seedShadow string, limit int) ([]*entities.ScheduleRun, error)
+}
+
+// Filter used by SeedRepository.FindSeeds. Zero value fields are ignored.
+type SeedQuery struct {
+	// Part of the seed URL. How it is matched is decided by URLPrefix.
+	URL string
+	// If true, URL must match the beginning of the seed URL, otherwise it can be anywhere in it.
+	URLPrefix bool
+	// Only seeds with this SURT key.
+	SURT string
+
+	// Only seeds harvested at or after this time.
+	HarvestedFrom time.Time
+	// Only seeds harvested before this time.
+	HarvestedTo time.Time
+
+	// Only seeds in this state.
+	State entities.CaptureState
+	// Only public (true) or private (false) seeds.
+	Public *bool
+	// Only seeds from group with this ShadowID.
+	GroupShadowID string
+	// Only seeds with missing or corrupted WACZ.
+	FixityProblem bool
+
+	// Number of seeds to skip.
+	Offset int
+	// Maximum number of seeds returned. If zero, all matching seeds are returned.
+	Limit int
 }
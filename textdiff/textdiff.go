@@ -0,0 +1,196 @@
+package textdiff
+
+// Package textdiff compares texts line by line using the Myers algorithm
+// http://www.xmailserver.org/diff2.pdf and groups the differences into hunks like unified diff.
+
+type Op int
+
+const (
+	// Line is in both texts.
+	Equal Op = iota
+	// Line is only in the new text.
+	Insert
+	// Line is only in the old text.
+	Delete
+)
+
+// Single line of the diff.
+type Line struct {
+	Op   Op
+	Text string
+	// Line numbers in the old and new text, starting at 1. Zero if the line is not in that text.
+	OldNumber int
+	NewNumber int
+}
+
+// Maximum number of edits the algorithm looks for. Texts differing more than this are reported as all old lines
+// deleted and all new lines inserted, memory and time of the algorithm grow with square of the edits.
+const MaxEdits = 1000
+
+// Compare the old and new lines. Returns all lines of both texts in order, with their operation.
+func Lines(old, new []string) []Line {
+	// Common prefix and suffix are cheap to find and usually most of the page.
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]Op, 0, len(old)+len(new))
+	for range prefix {
+		ops = append(ops, Equal)
+	}
+	ops = append(ops, middle(old[prefix:len(old)-suffix], new[prefix:len(new)-suffix])...)
+	for range suffix {
+		ops = append(ops, Equal)
+	}
+
+	lines := make([]Line, 0, len(ops))
+	oldIndex, newIndex := 0, 0
+	for _, op := range ops {
+		switch op {
+		case Equal:
+			lines = append(lines, Line{Op: Equal, Text: old[oldIndex], OldNumber: oldIndex + 1, NewNumber: newIndex + 1})
+			oldIndex++
+			newIndex++
+		case Delete:
+			lines = append(lines, Line{Op: Delete, Text: old[oldIndex], OldNumber: oldIndex + 1})
+			oldIndex++
+		case Insert:
+			lines = append(lines, Line{Op: Insert, Text: new[newIndex], NewNumber: newIndex + 1})
+			newIndex++
+		}
+	}
+	return lines
+}
+
+// True if any line was inserted or deleted.
+func Changed(lines []Line) bool {
+	for _, line := range lines {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Operations turning old into new. Deletions go before insertions of the same change.
+func middle(old, new []string) []Op {
+	n, m := len(old), len(new)
+	if n == 0 || m == 0 {
+		return replace(n, m)
+	}
+	maxEdits := min(n+m, MaxEdits)
+	offset := maxEdits + 1
+	// v[k+offset] is the furthest x on diagonal k. trace[d] keeps diagonals -d..d of v after step d for backtracking.
+	v := make([]int, 2*offset+1)
+	trace := make([][]int, 0)
+	snapshot := func(d int) []int {
+		return append([]int(nil), v[offset-d:offset+d+1]...)
+	}
+	for d := 0; d <= maxEdits; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && old[x] == new[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				trace = append(trace, snapshot(d))
+				return backtrack(trace, n, m)
+			}
+		}
+		trace = append(trace, snapshot(d))
+	}
+	return replace(n, m)
+}
+
+func backtrack(trace [][]int, n, m int) []Op {
+	ops := make([]Op, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		// Diagonal k of the previous step is at v[k+d-1].
+		v := trace[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d-1] < v[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, Equal)
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, Insert)
+		} else {
+			ops = append(ops, Delete)
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, Equal)
+		x--
+		y--
+	}
+	// Ops were collected from the end.
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func replace(n, m int) []Op {
+	ops := make([]Op, 0, n+m)
+	for range n {
+		ops = append(ops, Delete)
+	}
+	for range m {
+		ops = append(ops, Insert)
+	}
+	return ops
+}
+
+// Group of changed lines with surrounding unchanged lines.
+type Hunk struct {
+	Lines []Line
+}
+
+// Group changed lines into hunks with up to context unchanged lines around them. Hunks closer than
+// 2*context lines are merged. Returns no hunks if nothing changed.
+func Hunks(lines []Line, context int) []Hunk {
+	hunks := make([]Hunk, 0)
+	start, end := -1, -1
+	for i, line := range lines {
+		if line.Op == Equal {
+			continue
+		}
+		from, to := max(i-context, 0), min(i+context+1, len(lines))
+		if start >= 0 && from <= end {
+			end = to
+			continue
+		}
+		if start >= 0 {
+			hunks = append(hunks, Hunk{Lines: lines[start:end]})
+		}
+		start, end = from, to
+	}
+	if start >= 0 {
+		hunks = append(hunks, Hunk{Lines: lines[start:end]})
+	}
+	return hunks
+}
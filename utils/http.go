@@ -1,6 +1,7 @@
 package utils
 
 const (
-	ContentType = "Content-Type"
-	TextHTML    = "text/html; charset=utf-8"
+	ContentType     = "Content-Type"
+	TextHTML        = "text/html; charset=utf-8"
+	ApplicationJSON = "application/json; charset=utf-8"
 )
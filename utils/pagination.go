@@ -15,3 +15,11 @@ type Pagination struct {
 	NoPages      int
 	LinesPerPage int
 }
+
+// Number of pages needed to show count lines. There is always at least one page.
+func CountPages(count, linesPerPage int) int {
+	if linesPerPage <= 0 || count <= 0 {
+		return 1
+	}
+	return (count + linesPerPage - 1) / linesPerPage
+}
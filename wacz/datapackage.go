@@ -0,0 +1,27 @@
+package wacz
+
+// Content of datapackage.json https://specs.webrecorder.net/wacz/1.1.1/#datapackage-json
+type Datapackage struct {
+	Profile      string     `json:"profile"`
+	WaczVersion  string     `json:"wacz_version"`
+	Title        string     `json:"title,omitempty"`
+	Created      string     `json:"created"`
+	Software     string     `json:"software,omitempty"`
+	MainPageURL  string     `json:"mainPageUrl,omitempty"`
+	MainPageDate string     `json:"mainPageDate,omitempty"`
+	Resources    []Resource `json:"resources"`
+}
+
+// File stored in the WACZ.
+type Resource struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Content of datapackage-digest.json https://specs.webrecorder.net/wacz/1.1.1/#datapackage-digest-json
+type DatapackageDigest struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
@@ -0,0 +1,26 @@
+package wacz
+
+import (
+	"jinovatka/cdxj"
+	"time"
+)
+
+// JSON block of CDXJ line https://specs.webrecorder.net/cdxj/0.1.0/#json-block
+type IndexEntry struct {
+	URL      string `json:"url"`
+	Mime     string `json:"mime,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Length   string `json:"length,omitempty"`
+	Offset   string `json:"offset,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// Create CDXJ line of the entry captured at date.
+func (entry *IndexEntry) Line(date time.Time) (string, error) {
+	record, err := cdxj.NewRecord(entry.URL, date, entry)
+	if err != nil {
+		return "", err
+	}
+	return record.String(), nil
+}
@@ -0,0 +1,348 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jinovatka/cdxj"
+	"net/http"
+	"net/textproto"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidWACZ = errors.New("invalid WACZ")
+	ErrNotInIndex  = errors.New("capture not found in the index")
+)
+
+// Longest accepted CDXJ line. Lines of our index have few hundred bytes, URLs can be long though.
+const maxIndexLineLength = 1 << 20
+
+// Opened WACZ for reading and validation.
+type Archive struct {
+	Zip         *zip.Reader
+	Datapackage *Datapackage
+
+	// datapackage.json as stored, its hash is in datapackage-digest.json.
+	datapackageData []byte
+}
+
+// Open WACZ of the given size. Only datapackage.json is read, the rest is read on demand.
+func Open(r io.ReaderAt, size int64) (*Archive, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("wacz.Open failed to read zip: %w: %w", ErrInvalidWACZ, err)
+	}
+	data, err := readZipFile(archive, DatapackagePath)
+	if err != nil {
+		return nil, fmt.Errorf("wacz.Open failed to read %s: %w: %w", DatapackagePath, ErrInvalidWACZ, err)
+	}
+	datapackage := new(Datapackage)
+	err = json.Unmarshal(data, datapackage)
+	if err != nil {
+		return nil, fmt.Errorf("wacz.Open failed to parse %s: %w: %w", DatapackagePath, ErrInvalidWACZ, err)
+	}
+	return &Archive{Zip: archive, Datapackage: datapackage, datapackageData: data}, nil
+}
+
+// Check that datapackage.json matches its digest and that all listed resources exist and have the listed size and hash.
+// All problems are returned joined together, each wraps ErrInvalidWACZ.
+func (archive *Archive) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidWACZ, fmt.Sprintf(format, args...)))
+	}
+
+	// The digest file is optional in the specification.
+	digestData, err := readZipFile(archive.Zip, DatapackageDigestPath)
+	if err == nil {
+		digest := new(DatapackageDigest)
+		err = json.Unmarshal(digestData, digest)
+		if err != nil {
+			invalid("failed to parse %s: %s", DatapackageDigestPath, err.Error())
+		} else if err = checkHash(bytes.NewReader(archive.datapackageData), digest.Hash); err != nil {
+			invalid("%s doesn't match its digest: %s", DatapackagePath, err.Error())
+		}
+	} else if !errors.Is(err, errMissingFile) {
+		invalid("failed to read %s: %s", DatapackageDigestPath, err.Error())
+	}
+
+	if len(archive.Datapackage.Resources) == 0 {
+		invalid("%s lists no resources", DatapackagePath)
+	}
+	for _, resource := range archive.Datapackage.Resources {
+		file := findZipFile(archive.Zip, resource.Path)
+		if file == nil {
+			invalid("resource %s is missing", resource.Path)
+			continue
+		}
+		if int64(file.UncompressedSize64) != resource.Bytes {
+			invalid("resource %s has %d bytes, datapackage says %d", resource.Path, file.UncompressedSize64, resource.Bytes)
+			continue
+		}
+		content, err := file.Open()
+		if err != nil {
+			invalid("failed to open resource %s: %s", resource.Path, err.Error())
+			continue
+		}
+		err = checkHash(content, resource.Hash)
+		_ = content.Close()
+		if err != nil {
+			invalid("resource %s: %s", resource.Path, err.Error())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Line of CDXJ index with its JSON block decoded.
+type IndexLine struct {
+	*cdxj.Record
+	Entry IndexEntry
+}
+
+// Parse single CDXJ line "<key> <timestamp> <json>".
+func ParseIndexLine(line string) (*IndexLine, error) {
+	record, err := cdxj.ParseRecord(line)
+	if err != nil {
+		return nil, fmt.Errorf("wacz.ParseIndexLine: %w: %w", ErrInvalidWACZ, err)
+	}
+	parsed := &IndexLine{Record: record}
+	err = record.Decode(&parsed.Entry)
+	if err != nil {
+		return nil, fmt.Errorf("wacz.ParseIndexLine: %w: %w", ErrInvalidWACZ, err)
+	}
+	return parsed, nil
+}
+
+// All lines of all CDXJ indexes in the WACZ (indexes/*.cdxj or *.cdx as written by Scoop, optionally gzipped).
+// Compressed ZipNum indexes (.idx with .cdx.gz) are not supported.
+func (archive *Archive) Index() ([]*IndexLine, error) {
+	lines := make([]*IndexLine, 0)
+	found := false
+	for _, file := range archive.Zip.File {
+		name := strings.TrimSuffix(file.Name, ".gz")
+		if path.Dir(name) != "indexes" || !(strings.HasSuffix(name, ".cdxj") || strings.HasSuffix(name, ".cdx")) {
+			continue
+		}
+		found = true
+		err := archive.readIndex(file, func(line *IndexLine) bool {
+			lines = append(lines, line)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("Archive.Index: %w: no CDXJ index", ErrInvalidWACZ)
+	}
+	return lines, nil
+}
+
+// Find the index line of the capture of the URL at the timestamp. Timestamps are compared with second precision,
+// so 17 digit timestamp of the worker matches 14 digit timestamp of the index and the other way around.
+// Returns ErrNotInIndex if there is no such capture.
+func (archive *Archive) FindCapture(capturedURL string, timestamp string) (*IndexLine, error) {
+	lines, err := archive.Index()
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if line.Entry.URL == capturedURL && line.SameSecond(timestamp) {
+			return line, nil
+		}
+	}
+	return nil, fmt.Errorf("Archive.FindCapture: %w: %s at %s", ErrNotInIndex, capturedURL, timestamp)
+}
+
+// HTTP response stored in the WARC.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// Body as stored in the WARC, at most MaxResponseBody bytes.
+	Body []byte
+	// True if the body was longer than MaxResponseBody.
+	Truncated bool
+}
+
+// Longest body read by Response. Pages for comparison are much smaller, the limit protects memory.
+const MaxResponseBody = 32 << 20
+
+// Read the response record the index line points to from the WARC in archive/.
+// Records can be plain or compressed as separate gzip members (as required by WACZ).
+func (archive *Archive) Response(line *IndexLine) (*Response, error) {
+	offset, err := strconv.ParseInt(line.Entry.Offset, 10, 64)
+	if err != nil || offset < 0 {
+		return nil, fmt.Errorf("Archive.Response: %w: invalid offset %q", ErrInvalidWACZ, line.Entry.Offset)
+	}
+	file := findZipFile(archive.Zip, path.Join("archive", line.Entry.Filename))
+	if line.Entry.Filename == "" || file == nil {
+		return nil, fmt.Errorf("Archive.Response: %w: WARC %q is missing", ErrInvalidWACZ, line.Entry.Filename)
+	}
+	content, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("Archive.Response failed to open %s: %w: %w", file.Name, ErrInvalidWACZ, err)
+	}
+	defer content.Close()
+	// Zip entries can't seek, WARC files are usually stored uncompressed though, so skipping is just reading.
+	_, err = io.CopyN(io.Discard, content, offset)
+	if err != nil {
+		return nil, fmt.Errorf("Archive.Response failed to skip to offset %d of %s: %w: %w", offset, file.Name, ErrInvalidWACZ, err)
+	}
+	record := bufio.NewReader(content)
+	if magic, err := record.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipped, err := gzip.NewReader(record)
+		if err != nil {
+			return nil, fmt.Errorf("Archive.Response failed to decompress record in %s: %w: %w", file.Name, ErrInvalidWACZ, err)
+		}
+		defer unzipped.Close()
+		unzipped.Multistream(false)
+		record = bufio.NewReader(unzipped)
+	}
+	response, err := readResponseRecord(record)
+	if err != nil {
+		return nil, fmt.Errorf("Archive.Response failed to read record at offset %d of %s: %w: %w", offset, file.Name, ErrInvalidWACZ, err)
+	}
+	return response, nil
+}
+
+// Parse WARC response record with HTTP response block.
+func readResponseRecord(record *bufio.Reader) (*Response, error) {
+	reader := textproto.NewReader(record)
+	version, err := reader.ReadLine()
+	if err != nil || !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("record doesn't start with WARC version: %q", version)
+	}
+	headers, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WARC headers: %w", err)
+	}
+	if headers.Get("Warc-Type") != "response" {
+		return nil, fmt.Errorf("record is %q, not response", headers.Get("Warc-Type"))
+	}
+	length, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid record Content-Length %q", headers.Get("Content-Length"))
+	}
+	block := bufio.NewReader(io.LimitReader(record, length))
+	response, err := http.ReadResponse(block, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP response: %w", err)
+	}
+	defer response.Body.Close()
+	// The block length is what counts, Content-Length of the response can be the length before decoding.
+	// Chunked and gzipped bodies are stored as they were sent by some crawlers, this writer stores them decoded.
+	var body io.Reader = block
+	if slices.Contains(response.TransferEncoding, "chunked") {
+		body = response.Body
+	}
+	if strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+		unzipped, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress HTTP body: %w", err)
+		}
+		defer unzipped.Close()
+		body = unzipped
+	}
+	data, err := io.ReadAll(io.LimitReader(body, MaxResponseBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP body: %w", err)
+	}
+	result := &Response{StatusCode: response.StatusCode, Header: response.Header, Body: data}
+	if len(data) > MaxResponseBody {
+		result.Body = data[:MaxResponseBody]
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+func (archive *Archive) readIndex(file *zip.File, yield func(*IndexLine) bool) error {
+	content, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("Archive.readIndex failed to open %s: %w: %w", file.Name, ErrInvalidWACZ, err)
+	}
+	defer content.Close()
+	var reader io.Reader = content
+	if strings.HasSuffix(file.Name, ".gz") {
+		unzipped, err := gzip.NewReader(content)
+		if err != nil {
+			return fmt.Errorf("Archive.readIndex failed to decompress %s: %w: %w", file.Name, ErrInvalidWACZ, err)
+		}
+		defer unzipped.Close()
+		reader = unzipped
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxIndexLineLength)
+	number := 0
+	for scanner.Scan() {
+		number++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		line, err := ParseIndexLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("Archive.readIndex failed to parse %s line %d: %w", file.Name, number, err)
+		}
+		if !yield(line) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Archive.readIndex failed to read %s: %w: %w", file.Name, ErrInvalidWACZ, err)
+	}
+	return nil
+}
+
+var errMissingFile = errors.New("file is missing")
+
+func findZipFile(archive *zip.Reader, name string) *zip.File {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	file := findZipFile(archive, name)
+	if file == nil {
+		return nil, errMissingFile
+	}
+	content, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	// Metadata files are small, the limit protects from zip bombs.
+	const maxMetadataSize = 16 << 20
+	return io.ReadAll(io.LimitReader(content, maxMetadataSize))
+}
+
+// Compare hash of the content with hash in the "sha256:<hex>" format used by WACZ.
+func checkHash(content io.Reader, expected string) error {
+	algorithm, value, ok := strings.Cut(expected, ":")
+	if !ok || algorithm != "sha256" {
+		return fmt.Errorf("unsupported hash %q", expected)
+	}
+	hasher := sha256.New()
+	_, err := io.Copy(hasher, content)
+	if err != nil {
+		return fmt.Errorf("failed to read: %w", err)
+	}
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if !strings.EqualFold(actual, value) {
+		return fmt.Errorf("hash is sha256:%s, expected %s", actual, expected)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jinovatka/assert"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Package wacz creates Web Archive Collection Zipped files https://specs.webrecorder.net/wacz/1.1.1/
+// The WACZ contains single WARC file with request and response records, CDXJ index, pages list and datapackage.json.
+
+// Paths of the files inside of the WACZ.
+const (
+	WarcPath              = "archive/data.warc.gz"
+	IndexPath             = "indexes/index.cdxj"
+	PagesPath             = "pages/pages.jsonl"
+	DatapackagePath       = "datapackage.json"
+	DatapackageDigestPath = "datapackage-digest.json"
+
+	warcName = "data.warc.gz"
+)
+
+const Version = "1.1.1"
+
+// Single HTTP request and response pair, that will be stored in WARC.
+type Exchange struct {
+	// Requested URL.
+	URL string
+	// Time when the request was sent.
+	Date time.Time
+	// Request as sent to server. Body is not stored.
+	Request *http.Request
+	// Recieved response. The body must already be read into Body.
+	Response *http.Response
+	// Response body without transfer and content encoding.
+	Body []byte
+}
+
+// Writer collects exchanges and creates WACZ from them.
+// Writer is not safe for concurrent use.
+type Writer struct {
+	// URL of the main page of the capture.
+	MainPageURL string
+	// Title of the main page. Optional.
+	MainPageTitle string
+	// Name of software that created the capture.
+	Software string
+	// Time the capture was created.
+	Created time.Time
+
+	warc        bytes.Buffer
+	index       []string
+	mainPageTS  time.Time
+	hasMainPage bool
+}
+
+func NewWriter(mainPageURL, software string, created time.Time) *Writer {
+	assert.Must(mainPageURL != "", "wacz/NewWriter: mainPageURL can't be empty")
+	w := &Writer{
+		MainPageURL: mainPageURL,
+		Software:    software,
+		Created:     created.UTC(),
+	}
+	w.writeWarcinfo()
+	return w
+}
+
+// Add exchange to the WARC and the index.
+func (w *Writer) AddExchange(exchange *Exchange) error {
+	if exchange == nil || exchange.Request == nil || exchange.Response == nil {
+		return errors.New("Writer.AddExchange recieved incomplete exchange")
+	}
+	date := exchange.Date.UTC()
+	responseID := newRecordID()
+
+	// Response record
+	responseBlock := httpResponseBlock(exchange.Response, exchange.Body)
+	responseHeaders := [][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date.Format(time.RFC3339)},
+		{"WARC-Target-URI", exchange.URL},
+		{"WARC-Payload-Digest", digest(exchange.Body)},
+		{"Content-Type", "application/http; msgtype=response"},
+	}
+	offset := w.warc.Len()
+	err := w.writeRecord(responseHeaders, responseBlock)
+	if err != nil {
+		return fmt.Errorf("Writer.AddExchange failed to write response record: %w", err)
+	}
+	length := w.warc.Len() - offset
+
+	// Request record
+	requestHeaders := [][2]string{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", date.Format(time.RFC3339)},
+		{"WARC-Target-URI", exchange.URL},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/http; msgtype=request"},
+	}
+	err = w.writeRecord(requestHeaders, httpRequestBlock(exchange.Request))
+	if err != nil {
+		return fmt.Errorf("Writer.AddExchange failed to write request record: %w", err)
+	}
+
+	// Index entry
+	mime, _, _ := strings.Cut(exchange.Response.Header.Get("Content-Type"), ";")
+	entry := IndexEntry{
+		URL:      exchange.URL,
+		Mime:     strings.TrimSpace(mime),
+		Status:   strconv.Itoa(exchange.Response.StatusCode),
+		Digest:   digest(exchange.Body),
+		Length:   strconv.Itoa(length),
+		Offset:   strconv.Itoa(offset),
+		Filename: warcName,
+	}
+	line, err := entry.Line(date)
+	if err != nil {
+		return fmt.Errorf("Writer.AddExchange failed to create index entry: %w", err)
+	}
+	w.index = append(w.index, line)
+
+	if !w.hasMainPage && exchange.URL == w.MainPageURL {
+		w.hasMainPage = true
+		w.mainPageTS = date
+	}
+	return nil
+}
+
+// Write the WACZ to out. The writer should not be used after this.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	if !w.hasMainPage {
+		return 0, errors.New("Writer.WriteTo: main page was not captured")
+	}
+	counter := &countingWriter{Writer: out}
+	archive := zip.NewWriter(counter)
+	resources := make([]Resource, 0, 3)
+
+	// WARC files are already compressed, store them as they are.
+	slices.Sort(w.index)
+	indexData := []byte(strings.Join(w.index, "\n") + "\n")
+	pagesData, err := w.pages()
+	if err != nil {
+		return counter.n, err
+	}
+	files := []struct {
+		path   string
+		data   []byte
+		method uint16
+	}{
+		{WarcPath, w.warc.Bytes(), zip.Store},
+		{IndexPath, indexData, zip.Deflate},
+		{PagesPath, pagesData, zip.Deflate},
+	}
+	for _, file := range files {
+		err = writeZipFile(archive, file.path, file.data, file.method, w.Created)
+		if err != nil {
+			return counter.n, fmt.Errorf("Writer.WriteTo failed to write %s: %w", file.path, err)
+		}
+		resources = append(resources, Resource{
+			Name:  file.path[strings.LastIndex(file.path, "/")+1:],
+			Path:  file.path,
+			Hash:  digest(file.data),
+			Bytes: int64(len(file.data)),
+		})
+	}
+
+	datapackage := &Datapackage{
+		Profile:      "data-package",
+		WaczVersion:  Version,
+		Title:        w.MainPageTitle,
+		Created:      w.Created.Format(time.RFC3339),
+		Software:     w.Software,
+		MainPageURL:  w.MainPageURL,
+		MainPageDate: w.mainPageTS.Format(time.RFC3339),
+		Resources:    resources,
+	}
+	datapackageData, err := json.MarshalIndent(datapackage, "", "  ")
+	if err != nil {
+		return counter.n, fmt.Errorf("Writer.WriteTo failed to marshal datapackage: %w", err)
+	}
+	err = writeZipFile(archive, DatapackagePath, datapackageData, zip.Deflate, w.Created)
+	if err != nil {
+		return counter.n, fmt.Errorf("Writer.WriteTo failed to write datapackage: %w", err)
+	}
+
+	digestData, err := json.MarshalIndent(&DatapackageDigest{Path: DatapackagePath, Hash: digest(datapackageData)}, "", "  ")
+	if err != nil {
+		return counter.n, fmt.Errorf("Writer.WriteTo failed to marshal datapackage digest: %w", err)
+	}
+	err = writeZipFile(archive, DatapackageDigestPath, digestData, zip.Deflate, w.Created)
+	if err != nil {
+		return counter.n, fmt.Errorf("Writer.WriteTo failed to write datapackage digest: %w", err)
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return counter.n, fmt.Errorf("Writer.WriteTo failed to finish zip: %w", err)
+	}
+	return counter.n, nil
+}
+
+// Timestamp of the main page record. Zero if main page wasn't added yet.
+func (w *Writer) MainPageTimestamp() time.Time {
+	return w.mainPageTS
+}
+
+func (w *Writer) pages() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	encoder := json.NewEncoder(buffer)
+	header := map[string]string{"format": "json-pages-1.0", "id": "pages", "title": "All Pages"}
+	err := encoder.Encode(header)
+	if err != nil {
+		return nil, fmt.Errorf("Writer.pages failed to encode header: %w", err)
+	}
+	page := map[string]string{
+		"id":  newUUID(),
+		"url": w.MainPageURL,
+		"ts":  w.mainPageTS.Format(time.RFC3339),
+	}
+	if w.MainPageTitle != "" {
+		page["title"] = w.MainPageTitle
+	}
+	err = encoder.Encode(page)
+	if err != nil {
+		return nil, fmt.Errorf("Writer.pages failed to encode page: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func (w *Writer) writeWarcinfo() {
+	block := []byte("software: " + w.Software + "\r\nformat: WARC File Format 1.1\r\n")
+	headers := [][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", w.Created.Format(time.RFC3339)},
+		{"WARC-Filename", warcName},
+		{"Content-Type", "application/warc-fields"},
+	}
+	err := w.writeRecord(headers, block)
+	// Writing into bytes.Buffer can't fail.
+	assert.Must(err == nil, "wacz/Writer.writeWarcinfo: failed to write record: "+assert.AddErrorMessage(err))
+}
+
+// Write single WARC record as separate gzip member, so every record can be read on its own using the index offset.
+func (w *Writer) writeRecord(headers [][2]string, block []byte) error {
+	zipper := gzip.NewWriter(&w.warc)
+	record := new(bytes.Buffer)
+	record.WriteString("WARC/1.1\r\n")
+	for _, header := range headers {
+		record.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	record.WriteString("WARC-Block-Digest: " + digest(block) + "\r\n")
+	record.WriteString("Content-Length: " + strconv.Itoa(len(block)) + "\r\n\r\n")
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+	_, err := zipper.Write(record.Bytes())
+	if err != nil {
+		return err
+	}
+	return zipper.Close()
+}
+
+func httpRequestBlock(request *http.Request) []byte {
+	block := new(bytes.Buffer)
+	target := request.URL.RequestURI()
+	block.WriteString(request.Method + " " + target + " HTTP/1.1\r\n")
+	block.WriteString("Host: " + request.URL.Host + "\r\n")
+	_ = request.Header.Write(block)
+	block.WriteString("\r\n")
+	return block.Bytes()
+}
+
+// The body is stored decoded, so the headers describing the original encoding are replaced.
+func httpResponseBlock(response *http.Response, body []byte) []byte {
+	header := response.Header.Clone()
+	header.Del("Transfer-Encoding")
+	header.Del("Content-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	block := new(bytes.Buffer)
+	status := response.Status
+	if status == "" {
+		status = strconv.Itoa(response.StatusCode) + " " + http.StatusText(response.StatusCode)
+	}
+	block.WriteString("HTTP/1.1 " + status + "\r\n")
+	_ = header.Write(block)
+	block.WriteString("\r\n")
+	block.Write(body)
+	return block.Bytes()
+}
+
+func writeZipFile(archive *zip.Writer, path string, data []byte, method uint16, modified time.Time) error {
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: path, Method: method, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	return err
+}
+
+// SHA-256 digest in the format used by WACZ and WARC.
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Random UUID v4 in the format required by WARC-Record-ID.
+func newRecordID() string {
+	return "<urn:uuid:" + newUUID() + ">"
+}
+
+// Random UUID v4.
+func newUUID() string {
+	uuid := make([]byte, 16)
+	_, _ = rand.Read(uuid) // Never returns error.
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"jinovatka/artifact"
+	"jinovatka/capture"
+	"jinovatka/config"
+	"jinovatka/hostcheck"
+	"jinovatka/queue"
+	valkeyq "jinovatka/queue/valkey"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Lightweight capture worker. Takes CaptureRequests from Valkey, captures the pages without browser
+// and pushes CaptureResults back. See package capture for what is captured.
+//
+// Settings are taken from enviroment:
+//   - CONFIG_PATH, VALKEY_*, ARTIFACT_* - Valkey server and artifact storage, the same as in the server configuration (see package config)
+//   - REJECT_NON_PUBLIC_HOSTS, HOST_LOOKUP_TIMEOUT - refuse to fetch URLs pointing to non-public addresses, see package hostcheck
+//   - OUTPUT_DIR - directory for WACZ files when no artifact backend is configured, default ./captures/
+//   - WORKER_CONCURRENCY - number of requests captured at once, default 1
+//   - WORKER_VISIBILITY_TIMEOUT - how long can one capture take before the request is delivered again, default 10m
+func main() {
+	log := slog.New(slog.Default().Handler())
+
+	var err error
+	concurrency := 1
+	if value, ok := os.LookupEnv("WORKER_CONCURRENCY"); ok {
+		concurrency, err = strconv.Atoi(value)
+		if err != nil || concurrency < 1 {
+			log.Error("WORKER_CONCURRENCY must be positive integer")
+			os.Exit(1)
+		}
+	}
+
+	visibilityTimeout := 10 * time.Minute
+	if value, ok := os.LookupEnv("WORKER_VISIBILITY_TIMEOUT"); ok {
+		visibilityTimeout, err = time.ParseDuration(value)
+		if err != nil || visibilityTimeout <= 0 {
+			log.Error("WORKER_VISIBILITY_TIMEOUT must be positive duration")
+			os.Exit(1)
+		}
+	}
+
+	// The worker shares the configuration with the server. Only the valkey and artifacts sections
+	// and the host checks from the input section are used.
+	cfg, err := config.Load(os.Getenv(config.PathEnv))
+	if err != nil {
+		log.Error("could not load configuration", "error", err.Error())
+		os.Exit(1)
+	}
+	if cfg.Artifacts.Backend == "" {
+		const defaultOutputDir = "./captures/"
+		outputDir, ok := os.LookupEnv("OUTPUT_DIR")
+		if !ok {
+			log.Warn("neither artifact backend nor the output directory is set, using default " + defaultOutputDir)
+			outputDir = defaultOutputDir
+		}
+		cfg.Artifacts.Backend = "filesystem"
+		cfg.Artifacts.Dir = outputDir
+	}
+	storage, err := artifact.NewStorage(&cfg.Artifacts, &http.Client{})
+	if err != nil {
+		log.Error("could not create artifact storage", "error", err.Error())
+		os.Exit(1)
+	}
+	valkeyOptions := valkeyq.NewValkeyOptions(&cfg.Valkey)
+	client, err := valkey.NewClient(valkeyOptions.ClientOption())
+	if err != nil {
+		log.Error("failed to create valkey client", "error", err.Error())
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	signals := []os.Signal{os.Interrupt}
+	if runtime.GOOS == "linux" {
+		signals = append(signals, syscall.SIGHUP, syscall.SIGTERM)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), signals...)
+	defer stop()
+
+	workerQueue := valkeyq.NewWorkerQueue(log, client, visibilityTimeout)
+	httpClient := &http.Client{Timeout: time.Minute}
+	if cfg.Input.RejectNonPublicHosts {
+		// Redirects and requisites can point anywhere, so every URL is checked before it is fetched.
+		// The dialer checks the address again, the host could resolve differently the second time.
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = hostcheck.NewDialer(30 * time.Second).DialContext
+		// Proxy would be refused by the dialer if it is on private network.
+		transport.Proxy = nil
+		httpClient.Transport = transport
+	}
+	capturer := capture.NewCapturer(log, httpClient, storage)
+	if cfg.Input.RejectNonPublicHosts {
+		capturer.CheckURL = hostcheck.NewChecker(net.DefaultResolver, cfg.Input.HostLookupTimeout.Duration).CheckURL
+	}
+	// Capture must finish before the request is delivered to another worker.
+	capturer.Timeout = visibilityTimeout / 2
+	hostname, _ := os.Hostname()
+	capturer.WorkerID = "go-worker@" + hostname + ":" + strconv.Itoa(os.Getpid())
+
+	log.Info("Worker is listening for CaptureRequests", "concurrency", concurrency, "artifacts", cfg.Artifacts.Backend)
+	wg := new(sync.WaitGroup)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx, log, workerQueue, capturer)
+		}()
+	}
+	wg.Wait()
+	log.Info("Worker shutdown")
+}
+
+// Handle requests until the context is done.
+func run(ctx context.Context, log *slog.Logger, workerQueue *valkeyq.WorkerQueue, capturer *capture.Capturer) {
+	for ctx.Err() == nil {
+		const pollTimeout = 30 * time.Second
+		request, err := workerQueue.AwaitRequest(ctx, pollTimeout)
+		if errors.Is(err, queue.QueueTimeoutError) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error("failed to fetch request", "error", err.Error())
+				time.Sleep(time.Second) // Don't spin when Valkey is down.
+			}
+			continue
+		}
+		log.Info("Capturing", "URL", request.SeedURL, "ID", request.SeedShadowID, "attempt", request.Attempt)
+
+		result := capturer.Capture(ctx, request)
+		if ctx.Err() != nil {
+			// Interrupted capture. Leave the request unacknowledged, it will be delivered again.
+			return
+		}
+		log.Info("Captured", "ID", request.SeedShadowID, "errors", result.ErrorMessages)
+
+		err = workerQueue.PushResult(ctx, result)
+		if err != nil {
+			log.Error("failed to push result", "ID", request.SeedShadowID, "error", err.Error())
+			continue
+		}
+		// Acknowledge the request only after the result was enqueued.
+		err = workerQueue.AckRequest(ctx, request)
+		if err != nil {
+			log.Error("failed to acknowledge request", "ID", request.SeedShadowID, "error", err.Error())
+		}
+	}
+}
@@ -1,13 +1,22 @@
 import { Scoop } from "@harvard-lil/scoop";
 import Valkey from "iovalkey";
 import fs from "fs/promises";
-import "process";
+import process from "process";
+import os from "os";
 import path from "path";
+import { createHash, randomUUID } from "crypto";
 import JSZip from "jszip";
 
 // Global constants
 const requestQueueKey = "queue:requests";
 const resultQueueKey = "queue:results";
+// Requests that are being captured. They are moved back to requestQueueKey by the server if not acknowledged before deadline.
+const requestProcessingKey = "queue:requests:processing";
+const requestDeadlinesKey = "queue:requests:deadlines";
+// Default time in seconds the capture of one request can take before the request is delivered again.
+const defaultVisibilityTimeout = 600;
+// Identifier of this worker reported in results.
+const workerID = `scoop-worker@${os.hostname()}:${process.pid}`;
 
 async function main() {
   // Prepare config
@@ -99,12 +108,20 @@ async function run(captureSettings, config) {
   while (true) {
     // Fetch step
     let request;
+    let rawRequest;
     try {
-      request = await fetchRequest(valkey);
+      rawRequest = await fetchRequest(valkey, config);
     } catch (err) {
       console.error("Fetch error: " + err.message);
       continue; // Don't fail. continue to another request.
     }
+    try {
+      request = JSON.parse(rawRequest);
+    } catch (err) {
+      console.error("Malformed request: " + err.message);
+      await ackRequest(valkey, rawRequest); // It would only be delivered again.
+      continue;
+    }
 
     /** @type {CaptureResult} */
     const result = {
@@ -112,6 +129,13 @@ async function run(captureSettings, config) {
       done: false,
       errorMessages: [],
       captureMetadata: null,
+      workerID: workerID,
+      waczLocation: "",
+      waczKey: "",
+      waczSize: 0,
+      waczSha256: "",
+      errorCategory: "",
+      pageMetadata: null,
     };
 
     console.log(request);
@@ -120,7 +144,9 @@ async function run(captureSettings, config) {
     // Capture step
     let wacz;
     try {
-      wacz = await captureRequest(request, captureSettings, config);
+      const captured = await captureRequest(request, captureSettings, config);
+      wacz = captured.wacz;
+      result.pageMetadata = captured.pageMetadata;
     } catch (err) {
       const errorMsg = "Capture error: " + err.message;
       console.error(errorMsg);
@@ -131,17 +157,24 @@ async function run(captureSettings, config) {
     // If there was error during capture then skip writing and extraction
     if (wacz !== undefined) {
       // Write step
-      const waczPath = path.join(
-        config.outputDir,
-        request.seedShadowID + ".wacz"
-      );
+      // Every capture has its own file, older captures of the seed must stay as they were.
+      const waczKey = request.seedShadowID + "/" + waczTimestamp(new Date()) + ".wacz";
+      const waczPath = path.join(config.outputDir, waczKey);
       try {
-        await fs.writeFile(waczPath, Buffer.from(wacz));
+        const data = Buffer.from(wacz);
+        await fs.mkdir(path.dirname(waczPath), { recursive: true });
+        await fs.writeFile(waczPath, data);
+        // outputDir is the directory of the filesystem artifact storage, so the relative path is the key.
+        result.waczLocation = waczPath;
+        result.waczKey = waczKey;
+        result.waczSize = data.length;
+        result.waczSha256 = createHash("sha256").update(data).digest("hex");
       } catch (err) {
         const errorMsg = `failed to write file ${waczPath}, got error: ${err.message}`;
         console.error(errorMsg);
         console.log(request);
         result.errorMessages.push(errorMsg);
+        result.errorCategory = "Write";
       }
 
       // Extract step
@@ -151,6 +184,7 @@ async function run(captureSettings, config) {
         const errorMsg = `failed to extract capture metadata: ${err.message}`;
         console.error(errorMsg);
         result.errorMessages.push(errorMsg);
+        result.errorCategory ||= "Metadata";
       }
     }
 
@@ -158,26 +192,49 @@ async function run(captureSettings, config) {
     result.done = true;
 
     await enqueueResult(valkey, result);
+    // Acknowledge the request only after the result was enqueued.
+    await ackRequest(valkey, rawRequest);
   }
 }
 
 /**
  * See entities/capture.go for request format.
+ * The request is moved to processing list and stays there until ackRequest is called.
+ * If the worker crashes before that, the server will enqueue the request again after the deadline.
  *
  * @param { Valkey } valkey Valkey client
+ * @param { WorkerConfig } config
  *
- * @returns { Promise<CaptureRequest> } Returns deserialized request object
+ * @returns { Promise<string> } Returns serialized request
  */
-async function fetchRequest(valkey) {
-  const data = await valkey.blpop(requestQueueKey, 0);
+async function fetchRequest(valkey, config) {
+  const data = await valkey.blmove(
+    requestQueueKey,
+    requestProcessingKey,
+    "LEFT",
+    "RIGHT",
+    0
+  );
   if (data === null) {
     throw new Error("Valkey operation timed out. This should never happen.");
   }
-  // Data is list where data[0] is key of the list, data[1] is the returned value.
-  /** @type {CaptureRequest} */
-  const request = JSON.parse(data[1]);
+  const visibilityTimeout =
+    config.visibilityTimeout ?? defaultVisibilityTimeout;
+  const deadline = Math.floor(Date.now() / 1000) + visibilityTimeout;
+  await valkey.zadd(requestDeadlinesKey, "NX", deadline, data);
   // TODO: add some validation
-  return request;
+  return data;
+}
+
+/**
+ * Remove finished request from processing list.
+ *
+ * @param { Valkey } valkey
+ * @param { string } rawRequest Serialized request returned by fetchRequest
+ */
+async function ackRequest(valkey, rawRequest) {
+  await valkey.lrem(requestProcessingKey, 1, rawRequest);
+  await valkey.zrem(requestDeadlinesKey, rawRequest);
 }
 
 /**
@@ -185,7 +242,7 @@ async function fetchRequest(valkey) {
  * @param { CaptureRequest } request
  * @param { ScoopOptions } captureSettings
  * @param { WorkerConfig } config
- * @returns {Promise<ArrayBuffer>}
+ * @returns {Promise<{wacz: ArrayBuffer, pageMetadata: ?PageMetadata}>}
  */
 async function captureRequest(request, captureSettings, config) {
   const capture = await Scoop.capture(request.seedURL, captureSettings);
@@ -193,7 +250,30 @@ async function captureRequest(request, captureSettings, config) {
     throw new Error("Capture failed. The URL may not exist.");
   }
   // @ts-ignore Typescript type checker is very unhappy about this. The definition and jsdoc annotation for this function needs some love.
-  return await capture.toWACZ(false);
+  const wacz = await capture.toWACZ(false);
+  return { wacz: wacz, pageMetadata: extractPageMetadata(capture) };
+}
+
+/**
+ * Scoop only knows the title and the final URL of the page.
+ * The rest of the metadata is optional, see entities/pagemetadata.go.
+ * @param { any } capture Finished scoop capture
+ * @returns { ?PageMetadata }
+ */
+function extractPageMetadata(capture) {
+  const pageInfo = capture.pageInfo;
+  if (!pageInfo) {
+    return null;
+  }
+  /** @type { PageMetadata } */
+  const metadata = {};
+  if (pageInfo.title) {
+    metadata.title = String(pageInfo.title).trim();
+  }
+  if (pageInfo.url && pageInfo.url !== capture.url) {
+    metadata.redirectChain = [capture.url];
+  }
+  return metadata;
 }
 
 /**
@@ -296,16 +376,28 @@ class CaptureMetadata {
  * @param { CaptureResult } result
  */
 async function enqueueResult(valkey, result) {
-  const data = JSON.stringify(result);
+  // Unique ID keeps equal results distinct in the deadline set of the server.
+  const data = JSON.stringify({ ...result, deliveryID: randomUUID() });
   await valkey.rpush(resultQueueKey, data);
 }
 
+/**
+ * 14 digit UTC timestamp (YYYYMMDDhhmmss) used in WACZ file names, the same format as CDXJ timestamps.
+ *
+ * @param { Date } date
+ */
+function waczTimestamp(date) {
+  return date.toISOString().replace(/\D/g, "").slice(0, 14);
+}
+
 // --- Type definitions ---
 /**
  * @typedef { object } CaptureRequest
  * @property { string } seedURL
  * @property { string } seedShadowID
  * @property { RequestState } state
+ * @property { number } attempt
+ * @property { string } [deliveryID]
  */
 
 /**
@@ -314,8 +406,9 @@ async function enqueueResult(valkey, result) {
 
 /**
  * @typedef { object } WorkerConfig
- * @property { string } outputDir Path to directory where WACZ files will be stored be scoop
+ * @property { string } outputDir Path to directory where WACZ files will be stored be scoop, the dir of the filesystem artifact storage of the server
  * @property { string } valkeyUrl Adress and port of the valkey database used for request queue
+ * @property { number | undefined } visibilityTimeout Seconds before unfinished request is delivered again
  * @property { object | undefined } captureSettings Overrides for default CaptureOptions used in scoop capture
  */
 
@@ -325,6 +418,25 @@ async function enqueueResult(valkey, result) {
  * @property {boolean} done
  * @property {string[]} errorMessages
  * @property {?CaptureMetadata} captureMetadata
+ * @property {string} workerID
+ * @property {string} waczLocation
+ * @property {string} waczKey Key in the filesystem artifact storage (path relative to outputDir)
+ * @property {number} waczSize
+ * @property {string} waczSha256 Lowercase hex
+ * @property {string} errorCategory Empty if unknown, server classifies errorMessages then
+ * @property {?PageMetadata} pageMetadata
+ * @property {string} [deliveryID]
+ */
+
+/**
+ * @typedef { object } PageMetadata
+ * @property { string } [title]
+ * @property { string[] } [authors]
+ * @property { string } [publishedAt]
+ * @property { string } [language]
+ * @property { string } [canonicalURL]
+ * @property { number } [statusCode]
+ * @property { string[] } [redirectChain]
  */
 
 // ------------------------